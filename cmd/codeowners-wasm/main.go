@@ -0,0 +1,24 @@
+// Copyright 2017 The go-github-codeowners AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build js && wasm
+// +build js,wasm
+
+// codeowners-wasm exposes CODEOWNERS validation and matching to javascript, build it with
+//
+//	GOOS=js GOARCH=wasm go build -o codeowners.wasm ./cmd/codeowners-wasm
+//
+// and load it with the wasm_exec.js that ships with go
+package main
+
+import (
+	"github.com/ddub/go-github-codeowners/codeowners"
+)
+
+func main() {
+	codeowners.RegisterJS()
+	// keep the go runtime alive so javascript can keep calling in
+	select {}
+}
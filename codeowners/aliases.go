@@ -0,0 +1,119 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/github"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Aliases are named groups of owners, as read from a kubernetes style OWNERS_ALIASES file
+//
+//	aliases:
+//	  sig-docs:
+//	    - alice
+//	    - bob
+//
+// a rule refers to a group as @sig-docs and matching gives the members in its place
+type Aliases map[string][]string
+
+// ParseAliases reads an OWNERS_ALIASES file from any source
+func ParseAliases(r io.Reader) (Aliases, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parsealiases(string(content))
+}
+
+// parses the small part of yaml that OWNERS_ALIASES files use, a map of names to lists of logins
+// each list can be written either as - items on the following lines or as [a, b] on the same line
+func parsealiases(content string) (Aliases, error) {
+	aliases := make(Aliases)
+	inside, current := false, ""
+	for idx, line := range lines(content) {
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		text := strings.TrimSpace(line)
+		indented := strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+		switch {
+		case text == "":
+		case !indented:
+			inside, current = text == "aliases:", ""
+		case !inside:
+		case strings.HasPrefix(text, "-") && current != "":
+			aliases[current] = append(aliases[current], strings.Trim(strings.TrimSpace(text[1:]), `"'`))
+		case strings.Contains(text, ":"):
+			split := strings.Index(text, ":")
+			current = strings.ToLower(strings.Trim(strings.TrimSpace(text[:split]), `"'`))
+			aliases[current] = []string{}
+			if value := strings.TrimSpace(text[split+1:]); strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+				for _, member := range strings.Split(value[1:len(value)-1], ",") {
+					if member = strings.Trim(strings.TrimSpace(member), `"'`); member != "" {
+						aliases[current] = append(aliases[current], member)
+					}
+				}
+			}
+		default:
+			return nil, &Error{Code: CodeInvalidAliases, Message: fmt.Sprintf("Do not understand alias line %v", text), Line: idx + 1}
+		}
+	}
+	return aliases, nil
+}
+
+// WithAliases returns a copy of the CodeOwners where owners naming an alias, eg @sig-docs, are
+// replaced by its members when matching
+func (co CodeOwners) WithAliases(aliases Aliases) CodeOwners {
+	co.aliases = aliases
+	return co
+}
+
+// replaces the aliases in a list of owners with their members, who are written as @login unless
+// they are already an @owner or an email address, an empty list stays empty rather than nil
+func (aliases Aliases) expand(owners []string) []string {
+	if len(aliases) == 0 || owners == nil {
+		return owners
+	}
+	expanded := make([]string, 0, len(owners))
+	seen := make(map[string]bool)
+	add := func(ownertext string) {
+		if !seen[strings.ToLower(ownertext)] {
+			seen[strings.ToLower(ownertext)] = true
+			expanded = append(expanded, ownertext)
+		}
+	}
+	for _, ownertext := range owners {
+		members, ok := aliases[strings.ToLower(strings.TrimPrefix(ownertext, "@"))]
+		if !ok || !strings.HasPrefix(ownertext, "@") {
+			add(ownertext)
+			continue
+		}
+		for _, member := range members {
+			if !strings.Contains(member, "@") {
+				member = "@" + member
+			}
+			add(member)
+		}
+	}
+	return expanded
+}
+
+// fetches and parses an aliases file from the repository at ref
+func (s *Service) fetchaliases(ctx context.Context, owner string, repo string, path string, ref string) (Aliases, error) {
+	var content *github.RepositoryContent
+	_, err := s.call(ctx, "Repositories.GetContents", owner+"/"+repo, func() (resp *github.Response, err error) {
+		content, _, resp, err = s.client.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref})
+		return resp, err
+	})
+	if err != nil {
+		return nil, apierror(err, CodeNotFound)
+	}
+	text, err := content.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	return parsealiases(text)
+}
@@ -0,0 +1,67 @@
+package codeowners
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// a comment holding a single key and its value, eg # sla: 24h
+var annotation = regexp.MustCompile(`^#\s*([A-Za-z][\w.-]*)\s*:\s*(.*)$`)
+
+// Annotations are the key: value comments written about the rule, either on the lines straight above
+// it or at the end of its own line, so tooling can attach metadata to rules
+//
+//	# escalation: pagerduty-backend
+//	# sla: 24h
+//	api/ @org/backend # tier: 1
+//
+// keys are lowercased, a blank line or another rule ends the comments that belong to a rule and
+// where a key is written twice the one nearest the rule wins, other comments are ignored
+func (co CodeOwner) Annotations() map[string]string {
+	annotations := make(map[string]string, len(co.annotations))
+	for key, value := range co.annotations {
+		annotations[key] = value
+	}
+	return annotations
+}
+
+// reads the annotations of the rule on line idx of the text
+func annotations(text []string, idx int) map[string]string {
+	start := idx
+	for start > 0 && strings.HasPrefix(strings.TrimSpace(text[start-1]), "#") {
+		start--
+	}
+	comments := make([]string, 0, idx-start+1)
+	for _, line := range text[start:idx] {
+		comments = append(comments, strings.TrimSpace(line))
+	}
+	if _, comment := splitcomment(text[idx]); comment != "" {
+		comments = append(comments, "#"+comment)
+	}
+	var found map[string]string
+	for _, comment := range comments {
+		if parts := annotation.FindStringSubmatch(comment); parts != nil {
+			if found == nil {
+				found = make(map[string]string)
+			}
+			found[strings.ToLower(parts[1])] = strings.TrimSpace(parts[2])
+		}
+	}
+	return found
+}
+
+// the annotation giving the number of distinct owners that must approve changes to what a rule owns
+//
+//	/payments/ @org/payments # min-approvals: 2
+const minapprovals = "min-approvals"
+
+// MinApprovals is the number of distinct owners that must approve changes to what the rule owns, as written in its
+// min-approvals annotation, zero when it has none or it is not a whole number, see ApprovalStatus
+func (co CodeOwner) MinApprovals() int {
+	count, err := strconv.Atoi(co.annotations[minapprovals])
+	if err != nil || count < 0 {
+		return 0
+	}
+	return count
+}
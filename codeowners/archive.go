@@ -0,0 +1,109 @@
+package codeowners
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/google/go-github/github"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Files returns the paths of every file in the repository when it was read WithArchive, otherwise nil
+func (co CodeOwners) Files() []string {
+	if co.tree == nil {
+		return nil
+	}
+	return append([]string{}, co.tree.files...)
+}
+
+// archivetree is the files of a repository read from its tarball
+type archivetree struct {
+	// ref is the ref the tarball was asked for, empty for the default branch
+	ref   string
+	files []string
+}
+
+// the files in the repository at ref, from the tarball it was read from when that was at the same ref,
+// otherwise from the git tree
+func (co CodeOwners) files(ctx context.Context, ref string) ([]string, error) {
+	if co.tree != nil && (ref == "" || ref == co.tree.ref) {
+		return co.tree.files, nil
+	}
+	return co.service.treefiles(ctx, co.owner, co.repo, ref)
+}
+
+// downloads the tarball of a repository and finds the file in it, returning every path in the repository too
+func (s *Service) fetcharchive(ctx context.Context, owner string, repo string, opts getoptions) (string, Source, []string, error) {
+	var link string
+	_, err := s.call(ctx, "Repositories.GetArchiveLink", owner+"/"+repo, func() (resp *github.Response, err error) {
+		var location fmt.Stringer
+		location, resp, err = s.client.Repositories.GetArchiveLink(ctx, owner, repo, github.Tarball, &github.RepositoryContentGetOptions{Ref: opts.ref})
+		if err == nil {
+			link = location.String()
+		}
+		return resp, err
+	})
+	if err != nil {
+		return "", Source{}, nil, err
+	}
+	var archive bytes.Buffer
+	_, err = s.call(ctx, "Repositories.DownloadArchive", owner+"/"+repo, func() (*github.Response, error) {
+		// a retry starts the download again
+		archive.Reset()
+		req, err := s.client.NewRequest("GET", link, nil)
+		if err != nil {
+			return nil, err
+		}
+		return s.client.Do(ctx, req, &archive)
+	})
+	if err != nil {
+		return "", Source{}, nil, err
+	}
+	return readarchive(&archive, opts)
+}
+
+// lists the files in a tarball and reads the file from the first of the locations that has it
+// github puts everything in a directory named after the repository and commit, which is left off the paths
+func readarchive(r io.Reader, opts getoptions) (string, Source, []string, error) {
+	unzipped, err := gzip.NewReader(r)
+	if err != nil {
+		return "", Source{}, nil, err
+	}
+	wanted := make(map[string]int, len(opts.locations))
+	for idx, location := range opts.locations {
+		wanted[location+opts.filename] = idx
+	}
+	var files []string
+	found, content := len(opts.locations), ""
+	archive := tar.NewReader(unzipped)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", Source{}, nil, err
+		}
+		split := strings.Index(header.Name, "/")
+		if split < 0 || (header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeSymlink) {
+			continue
+		}
+		path := header.Name[split+1:]
+		files = append(files, path)
+		if idx, ok := wanted[path]; ok && idx < found && header.Typeflag == tar.TypeReg {
+			data, err := ioutil.ReadAll(archive)
+			if err != nil {
+				return "", Source{}, nil, err
+			}
+			found, content = idx, string(data)
+		}
+	}
+	if found == len(opts.locations) {
+		return "", Source{}, files, &Error{Code: CodeNoCodeowners, Message: fmt.Sprintf("No %v in the repository archive", opts.filename)}
+	}
+	return content, Source{Path: opts.locations[found] + opts.filename, Ref: opts.ref}, files, nil
+}
@@ -0,0 +1,230 @@
+package codeowners
+
+import (
+	"context"
+	"github.com/google/go-github/github"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AssignStrategy chooses which members of an owning team are asked to review, it is kept between pull requests
+// so that it can spread the reviews over the team, and must be safe for concurrent use
+type AssignStrategy interface {
+	// Pick chooses up to n of the candidates, which are the lower case logins of the members of the team that
+	// may be asked, in order of login, without recording that they were
+	Pick(team string, candidates []string, n int) []string
+	// Record notes that the members picked for the team were asked, it is only called once the request for
+	// their reviews has been made so that a failed request does not move the strategy on
+	Record(team string, picked []string)
+}
+
+// RoundRobin is an AssignStrategy that takes the members of each team in turn
+type RoundRobin struct {
+	lock sync.Mutex
+	// next is the login after which each team carries on
+	next map[string]string
+}
+
+// NewRoundRobin returns a RoundRobin starting each team from its first member
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{next: make(map[string]string)}
+}
+
+// Pick takes the n candidates after the last one picked for the team, going back to the start when it runs out
+// the place is kept by login so members joining or leaving the team don't disturb the order of the rest
+func (rr *RoundRobin) Pick(team string, candidates []string, n int) []string {
+	if n <= 0 || len(candidates) == 0 {
+		return nil
+	}
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+	start := sort.SearchStrings(candidates, rr.next[team])
+	if start < len(candidates) && candidates[start] == rr.next[team] {
+		start++
+	}
+	var picked []string
+	for idx := 0; idx < n && idx < len(candidates); idx++ {
+		picked = append(picked, candidates[(start+idx)%len(candidates)])
+	}
+	return picked
+}
+
+// Record carries the team on after the last member picked
+func (rr *RoundRobin) Record(team string, picked []string) {
+	if len(picked) == 0 {
+		return
+	}
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+	rr.next[team] = picked[len(picked)-1]
+}
+
+// LeastRecentlyAssigned is an AssignStrategy that takes the members who were asked to review longest ago,
+// members never asked come first, it counts assignments across every team a member is in
+type LeastRecentlyAssigned struct {
+	lock sync.Mutex
+	last map[string]time.Time
+	// now is the clock, it is replaced in tests
+	now func() time.Time
+}
+
+// NewLeastRecentlyAssigned returns a LeastRecentlyAssigned that has not seen any assignments
+func NewLeastRecentlyAssigned() *LeastRecentlyAssigned {
+	return &LeastRecentlyAssigned{last: make(map[string]time.Time), now: time.Now}
+}
+
+// Pick takes the n candidates asked longest ago, those asked at the same time by login
+func (lra *LeastRecentlyAssigned) Pick(team string, candidates []string, n int) []string {
+	if n <= 0 || len(candidates) == 0 {
+		return nil
+	}
+	lra.lock.Lock()
+	defer lra.lock.Unlock()
+	ordered := append([]string{}, candidates...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return lra.last[ordered[i]].Before(lra.last[ordered[j]])
+	})
+	if n < len(ordered) {
+		ordered = ordered[:n]
+	}
+	return ordered
+}
+
+// Record notes the members picked as asked now
+func (lra *LeastRecentlyAssigned) Record(team string, picked []string) {
+	lra.lock.Lock()
+	defer lra.lock.Unlock()
+	now := lra.now()
+	for _, login := range picked {
+		lra.last[login] = now
+	}
+}
+
+// AssignOptions changes how AssignReviewers asks for reviews
+type AssignOptions struct {
+	// PerTeam is how many members of each owning team are asked, counting those already asked or who have approved,
+	// one when zero
+	PerTeam int
+	// Strategy chooses the members of a team, when nil the first members by login are always asked
+	Strategy AssignStrategy
+	// Routing is how teams with github's code review assignment turned on are treated
+	Routing RoutingMode
+	// GetOptions are how the file is read, see ForPullRequest
+	GetOptions []GetOption
+}
+
+// AssignReviewers is shorthand for NewService(cl).AssignReviewers
+func AssignReviewers(ctx context.Context, cl *github.Client, owner string, repo string, number int, opts AssignOptions) ([]string, []error) {
+	return NewService(cl).AssignReviewers(ctx, owner, repo, number, opts)
+}
+
+// AssignReviewers asks the owners of the files changed in a pull request to review it, as matched by ForPullRequest,
+// users named in the file are asked themselves and teams through PerTeam of their members chosen by the Strategy,
+// so the same maintainer isn't asked every time, the author and those already asked or who have approved are left
+// out, the logins asked are returned, in the order the owners are first met, along with the teams asked as written
+func (s *Service) AssignReviewers(ctx context.Context, owner string, repo string, number int, opts AssignOptions) (assigned []string, error_slice []error) {
+	ctx = withrepo(s.operation(ctx), owner, repo)
+	result, error_slice := s.ForPullRequest(ctx, owner, repo, number, opts.GetOptions...)
+	if result.Files == nil {
+		return nil, error_slice
+	}
+	requested, err := s.requestedreviewers(ctx, owner, repo, number)
+	if err != nil {
+		return nil, append(error_slice, err)
+	}
+	approved, err := s.approvers(ctx, owner, repo, number)
+	if err != nil {
+		return nil, append(error_slice, err)
+	}
+	author := strings.ToLower(result.PullRequest.GetUser().GetLogin())
+	involved := func(login string) bool {
+		return requested[login] || approved[login]
+	}
+	chosen := make(map[string]bool)
+	choose := func(login string) {
+		if !chosen[login] {
+			chosen[login] = true
+			assigned = append(assigned, login)
+		}
+	}
+	// the members the strategy picked for each team, recorded once they have been asked
+	picks := make(map[string][]string)
+	var teams []string
+	askteam := func(fullteam string) {
+		teams = append(teams, fullteam[strings.Index(fullteam, "/")+1:])
+		assigned = append(assigned, fullteam)
+	}
+	perteam := opts.PerTeam
+	if perteam <= 0 {
+		perteam = 1
+	}
+	for _, ownertext := range result.File.aliases.expand(result.Owners) {
+		switch {
+		case strings.HasPrefix(ownertext, "@") && strings.Contains(ownertext, "/"):
+			routing := s.routingfor(ctx, ownertext, opts.Routing)
+			if routing.Enabled && opts.Routing == RoutingDelegate {
+				askteam(ownertext)
+				continue
+			}
+			members, err := s.teammembers(ownertext, ctx)
+			if err != nil {
+				error_slice = append(error_slice, err)
+				continue
+			}
+			var candidates []string
+			needed := perteam
+			if routing.Enabled && routing.MemberCount > 0 {
+				needed = routing.MemberCount
+			}
+			if routing.Enabled && routing.NotifyTeam {
+				askteam(ownertext)
+			}
+			for _, member := range members {
+				login := strings.ToLower(member)
+				switch {
+				case login == author:
+				case involved(login) || chosen[login]:
+					needed--
+				default:
+					candidates = append(candidates, login)
+				}
+			}
+			sort.Strings(candidates)
+			if opts.Strategy != nil {
+				candidates = opts.Strategy.Pick(ownertext, candidates, needed)
+				picks[ownertext] = candidates
+			} else if needed < len(candidates) {
+				candidates = candidates[:max(needed, 0)]
+			}
+			for _, login := range candidates {
+				choose(login)
+			}
+		case strings.HasPrefix(ownertext, "@"):
+			if login := strings.ToLower(ownertext[1:]); login != author && !involved(login) {
+				choose(login)
+			}
+		}
+	}
+	if len(assigned) == 0 {
+		return assigned, error_slice
+	}
+	var reviewers []string
+	for _, login := range assigned {
+		if !strings.HasPrefix(login, "@") {
+			reviewers = append(reviewers, login)
+		}
+	}
+	_, err = s.call(ctx, "PullRequests.RequestReviewers", owner+"/"+repo, func() (resp *github.Response, err error) {
+		_, resp, err = s.client.PullRequests.RequestReviewers(ctx, owner, repo, number, github.ReviewersRequest{Reviewers: reviewers, TeamReviewers: teams})
+		return resp, err
+	})
+	if err != nil {
+		return nil, append(error_slice, err)
+	}
+	for team, picked := range picks {
+		opts.Strategy.Record(team, picked)
+	}
+	return assigned, error_slice
+}
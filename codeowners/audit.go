@@ -0,0 +1,102 @@
+package codeowners
+
+import (
+	"context"
+	"github.com/google/go-github/github"
+	"strings"
+)
+
+// TwoFactorFinding is a rule with owners who are members of the org without two factor authentication
+type TwoFactorFinding struct {
+	Pattern string
+	Owners  []string
+	// Logins are the users behind the rule's owners that have two factor authentication disabled
+	Logins []string
+}
+
+// lists every member of the org that does not have two factor authentication enabled, by lower case login
+// only organization owners are allowed to ask github for this
+func (s *Service) withouttwofactor(ctx context.Context, org string) (map[string]string, error) {
+	logins := make(map[string]string)
+	opt := github.ListMembersOptions{Filter: "2fa_disabled"}
+	for {
+		var users []*github.User
+		resp, err := s.call(ctx, "Organizations.ListMembers", repoof(ctx), func() (resp *github.Response, err error) {
+			users, resp, err = s.client.Organizations.ListMembers(ctx, org, &opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			logins[strings.ToLower(user.GetLogin())] = user.GetLogin()
+		}
+		if resp.NextPage == 0 {
+			return logins, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// AuditTwoFactor expands the owners of every rule and flags the rules where any of the owners
+// has two factor authentication disabled, so they fail the org's security baseline
+// logins are compared as written, and teams by the logins of their members, so only email owners are looked up
+func (co CodeOwners) AuditTwoFactor(ctx context.Context) (findings []TwoFactorFinding, error_slice []error) {
+	ctx = co.operation(ctx)
+	insecure, err := co.service.withouttwofactor(ctx, co.owner)
+	if err != nil {
+		return nil, append(error_slice, err)
+	}
+	// the logins behind each owner, so an owner named by several rules is only expanded once
+	expanded := make(map[string][]string)
+	loginsof := func(ownertext string) []string {
+		if logins, ok := expanded[ownertext]; ok {
+			return logins
+		}
+		var logins []string
+		if err := checkowner(ownertext); err != nil {
+			error_slice = append(error_slice, err)
+			expanded[ownertext] = nil
+			return nil
+		}
+		switch {
+		case strings.HasPrefix(ownertext, "@") && strings.Contains(ownertext, "/"):
+			members, err := co.service.teammembers(ownertext, ctx)
+			if err != nil {
+				error_slice = append(error_slice, err)
+			}
+			logins = members
+		case strings.HasPrefix(ownertext, "@"):
+			logins = []string{ownertext[1:]}
+		default:
+			resolutions, errs := co.expand(ctx, []string{ownertext})
+			error_slice = append(error_slice, errs...)
+			for _, resolution := range resolutions {
+				logins = append(logins, resolution.User.GetLogin())
+			}
+		}
+		expanded[ownertext] = logins
+		return logins
+	}
+	for _, pattern := range co.patterns {
+		var logins []string
+		seen := make(map[string]bool)
+		for _, ownertext := range co.aliases.expand(pattern.owners) {
+			for _, login := range loginsof(ownertext) {
+				key := strings.ToLower(login)
+				if insecure[key] != "" && !seen[key] {
+					seen[key] = true
+					logins = append(logins, insecure[key])
+				}
+			}
+		}
+		if len(logins) > 0 {
+			findings = append(findings, TwoFactorFinding{
+				Pattern: pattern.path,
+				Owners:  pattern.owners,
+				Logins:  logins,
+			})
+		}
+	}
+	return findings, error_slice
+}
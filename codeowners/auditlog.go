@@ -0,0 +1,117 @@
+package codeowners
+
+import (
+	"context"
+	"github.com/google/go-github/github"
+	"sync/atomic"
+	"time"
+)
+
+// AuditRecord describes a single request the package made to the github api
+type AuditRecord struct {
+	// Operation names the api call, eg Repositories.GetContents
+	Operation string
+	Method    string
+	URL       string
+	// Repo is owner/repo of the repository the request was made for, including the team and user lookups
+	// made to resolve its owners, or the org for requests about a whole org, empty for files from Parse
+	Repo string
+	// Status is the http status code, zero when no response was received
+	Status  int
+	Err     error
+	Latency time.Duration
+}
+
+// AuditSink receives a record of every github api request the package makes, for compliance and
+// for tracking down quota consumption, Record is called from many goroutines at once
+type AuditSink interface {
+	Record(AuditRecord)
+}
+
+// AuditSinkFunc lets an ordinary function be used as an AuditSink
+type AuditSinkFunc func(AuditRecord)
+
+// Record calls the function
+func (f AuditSinkFunc) Record(record AuditRecord) {
+	f(record)
+}
+
+// the sink set with SetAuditSink, kept in a box as atomic.Value can't hold nil
+var defaultsink atomic.Value
+
+// the sink in defaultsink
+type sinkbox struct {
+	sink AuditSink
+}
+
+// SetAuditSink starts sending a record of every api request of services without their own sink to the sink,
+// nil stops auditing
+//
+// Deprecated: use Service.WithAuditSink, which only audits the requests of that service
+func SetAuditSink(s AuditSink) {
+	defaultsink.Store(sinkbox{sink: s})
+}
+
+// WithAuditSink returns a copy of the service that sends a record of every api request it makes to the sink
+func (s *Service) WithAuditSink(sink AuditSink) *Service {
+	return s.with(func(s *Service) {
+		s.auditsink = sink
+	})
+}
+
+// WithAuditSink returns a copy of the code owners whose requests are audited, see Service.WithAuditSink
+func (co CodeOwners) WithAuditSink(sink AuditSink) CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.auditsink = sink
+	})
+}
+
+// the context key of the repository an operation is for
+type repokey struct{}
+
+// the context for an operation on a repository, so the audit records of every request it makes name it
+func withrepo(ctx context.Context, owner string, repo string) context.Context {
+	if owner == "" && repo == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, repokey{}, owner+"/"+repo)
+}
+
+// the owner/repo the operation the context is for is about, empty when it is not about a repository
+func repoof(ctx context.Context) string {
+	repo, _ := ctx.Value(repokey{}).(string)
+	return repo
+}
+
+// the context for an operation on the repository the file was read from
+func (co CodeOwners) operation(ctx context.Context) context.Context {
+	return withrepo(co.service.operation(ctx), co.owner, co.repo)
+}
+
+// hands a finished api request to the audit sink of the service, or the one set with SetAuditSink
+func (s *Service) audit(operation string, repo string, start time.Time, resp *github.Response, err error) {
+	var sink AuditSink
+	if s != nil {
+		sink = s.auditsink
+	}
+	if box, ok := defaultsink.Load().(sinkbox); ok && sink == nil {
+		sink = box.sink
+	}
+	if sink == nil {
+		return
+	}
+	record := AuditRecord{
+		Operation: operation,
+		Repo:      repo,
+		Err:       err,
+		Latency:   time.Since(start),
+	}
+	if resp != nil && resp.Response != nil {
+		record.Status = resp.StatusCode
+		if resp.Request != nil {
+			record.Method = resp.Request.Method
+			record.URL = resp.Request.URL.String()
+		}
+	}
+	sink.Record(record)
+}
@@ -0,0 +1,69 @@
+package codeowners
+
+import (
+	"fmt"
+	"github.com/google/go-github/github"
+	"sync"
+	"time"
+)
+
+// breaker stops api calls for a cooldown once enough of them have failed in a row, so a big run
+// against a github that is having trouble fails fast rather than making thousands of doomed requests
+type breaker struct {
+	failures int
+	cooldown time.Duration
+	lock     sync.Mutex
+	// failed counts the calls that have failed since the last one that succeeded
+	failed int
+	// open is when the breaker tripped, calls are refused until cooldown after it
+	open time.Time
+}
+
+// WithCircuitBreaker returns a copy of the service that stops calling github for cooldown after failures
+// calls in a row have failed, during which every call fails at once with ErrCircuitOpen, after the
+// cooldown calls are let through again and the first to fail trips the breaker straight back
+// only failures that say github is in trouble count, that is server errors, failed connections and
+// rate limits, not eg a user that does not exist, the breaker is shared by every copy of the service
+func (s *Service) WithCircuitBreaker(failures int, cooldown time.Duration) *Service {
+	return s.with(func(s *Service) {
+		s.breaker = &breaker{failures: failures, cooldown: cooldown}
+	})
+}
+
+// WithCircuitBreaker returns a copy of the code owners whose calls go through a circuit breaker, see Service.WithCircuitBreaker
+func (co CodeOwners) WithCircuitBreaker(failures int, cooldown time.Duration) CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.breaker = &breaker{failures: failures, cooldown: cooldown}
+	})
+}
+
+// the error for a call the breaker refused, nil when the call can go ahead
+func (b *breaker) allow(operation string) error {
+	if b == nil {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.failed < b.failures || time.Since(b.open) >= b.cooldown {
+		return nil
+	}
+	return &Error{Code: CodeCircuitOpen, Message: fmt.Sprintf("Not calling %v after %v failures in a row, trying again after %v", operation, b.failed, b.open.Add(b.cooldown).Format(time.RFC3339))}
+}
+
+// records how a call went, tripping the breaker when it is the last of too many failures
+func (b *breaker) record(resp *github.Response, err error) {
+	if b == nil {
+		return
+	}
+	_, ratelimited := retryafter(err, 0)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err == nil || !(ratelimited || RetryTransient(resp, err)) {
+		b.failed = 0
+		return
+	}
+	b.failed++
+	if b.failed >= b.failures {
+		b.open = time.Now()
+	}
+}
@@ -0,0 +1,37 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithMaxAPIRequests returns a copy of the service where each operation, eg a Get, a Match or an ApprovalProgress,
+// makes at most n requests to github, retries included, once they are used up the operation returns what it has
+// resolved along with ErrBudgetExceeded for the rest, zero means no limit
+func (s *Service) WithMaxAPIRequests(n int) *Service {
+	return s.with(func(s *Service) {
+		s.maxrequests = n
+	})
+}
+
+// WithMaxAPIRequests returns a copy of the code owners whose operations are limited, see Service.WithMaxAPIRequests
+func (co CodeOwners) WithMaxAPIRequests(n int) CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.maxrequests = n
+	})
+}
+
+// takes a request from the budget of the operation, the error is for a request there is no budget left for
+func spend(ctx context.Context, operation string) error {
+	u := usageof(ctx)
+	if u == nil {
+		return nil
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.limit > 0 && u.stats.Requests >= u.limit {
+		return &Error{Code: CodeBudgetExceeded, Message: fmt.Sprintf("Not calling %v as all %v requests have been made", operation, u.limit)}
+	}
+	u.stats.Requests++
+	return nil
+}
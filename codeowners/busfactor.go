@@ -0,0 +1,127 @@
+package codeowners
+
+import (
+	"context"
+	"github.com/google/go-github/github"
+	"path"
+	"sort"
+)
+
+// SinglePoint is a rule whose owners come down to one person once teams are expanded into their members,
+// so that reviews of what it owns stall whenever that person is away
+type SinglePoint struct {
+	Rule CodeOwner
+	User *github.User
+}
+
+// SingleOwnedDir is a directory of the tree where every file is owned by the same one person
+type SingleOwnedDir struct {
+	// Path is the directory with no trailing slash
+	Path  string
+	Files int
+	User  *github.User
+}
+
+// BusFactor lists the rules, in file order, whose owners are a single person after teams are expanded,
+// eg a lone user or a team of one, rules without owners are left out as FindUnowned reports those,
+// as are rules with an owner that could not be resolved, whose errors are returned
+func (co CodeOwners) BusFactor(ctx context.Context) (points []SinglePoint, error_slice []error) {
+	singles, error_slice := co.singlepoints(ctx)
+	for idx, pattern := range co.patterns {
+		if user, ok := singles[idx]; ok {
+			points = append(points, SinglePoint{Rule: pattern, User: user})
+		}
+	}
+	return points, error_slice
+}
+
+// BusFactorDirs lists the directories of the tree at ref (or the default branch when ref is empty) where every
+// file is owned by the same single person, which BusFactor can't tell when several rules share the directory
+// only the outermost such directories are listed, in order of path, the repository root is never listed
+func (co CodeOwners) BusFactorDirs(ctx context.Context, ref string) (dirs []SingleOwnedDir, error_slice []error) {
+	ctx = co.operation(ctx)
+	files, err := co.files(ctx, ref)
+	if err != nil {
+		return nil, append(error_slice, err)
+	}
+	singles, error_slice := co.singlepoints(ctx)
+	// the one person owning every file below each directory so far, nil once the files have different owners
+	owners := make(map[string]*github.User)
+	counts := make(map[string]int)
+	for _, file := range files {
+		user := co.singleowner(singles, file)
+		for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+			counts[dir]++
+			previous, seen := owners[dir]
+			switch {
+			case !seen:
+				owners[dir] = user
+			case previous != nil && (user == nil || userkey(previous) != userkey(user)):
+				owners[dir] = nil
+			}
+		}
+	}
+	for dir, user := range owners {
+		if user == nil {
+			continue
+		}
+		if parent := path.Dir(dir); parent != "." && owners[parent] != nil {
+			continue
+		}
+		dirs = append(dirs, SingleOwnedDir{Path: dir, Files: counts[dir], User: user})
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].Path < dirs[j].Path
+	})
+	return dirs, error_slice
+}
+
+// the person owning a file alone, nil when it has no owners or more than one
+func (co CodeOwners) singleowner(singles map[int]*github.User, file string) *github.User {
+	var owner *github.User
+	for _, idx := range co.rulesfor(file) {
+		user, ok := singles[idx]
+		if !ok || (owner != nil && userkey(owner) != userkey(user)) {
+			return nil
+		}
+		owner = user
+	}
+	return owner
+}
+
+// the rules, by index, whose owners are one person, each owner is expanded once however many rules name it
+func (co CodeOwners) singlepoints(ctx context.Context) (map[int]*github.User, []error) {
+	ctx = co.operation(ctx)
+	var distinct []string
+	seen := make(map[string]bool)
+	for _, pattern := range co.patterns {
+		for _, ownertext := range co.ruleowners(pattern) {
+			if !seen[ownertext] {
+				seen[ownertext] = true
+				distinct = append(distinct, ownertext)
+			}
+		}
+	}
+	resolutions, error_slice := co.expand(ctx, distinct)
+	users := make(map[string][]*github.User)
+	for _, resolution := range resolutions {
+		if resolution.User != nil {
+			users[resolution.Owner] = append(users[resolution.Owner], resolution.User)
+		}
+	}
+	complete := completeowners(resolutions)
+	singles := make(map[int]*github.User)
+	for idx, pattern := range co.patterns {
+		var ruleusers []*github.User
+		resolved := true
+		for _, ownertext := range co.ruleowners(pattern) {
+			// as for MatchMany an owner without a complete resolution is taken to have failed
+			resolved = resolved && (len(error_slice) == 0 || complete[ownertext])
+			ruleusers = append(ruleusers, users[ownertext]...)
+		}
+		if ruleusers = distinctusers(ruleusers); resolved && len(ruleusers) == 1 {
+			singles[idx] = ruleusers[0]
+		}
+	}
+	return singles, error_slice
+}
@@ -0,0 +1,203 @@
+package codeowners
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache keeps the results of team and user lookups so that repeated calls to Match don't fetch them again
+// values are json, so a cache can be backed by any store such as redis or memcached, and an entry should be
+// dropped once its ttl has passed, keys start with the api url of the client and the scope given to
+// WithCacheScope, each followed by a space, then the kind of lookup and what it is for, eg
+// "https://api.github.com/ installation-1 teams:org", so services for different hosts and credentials can share one
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// MemoryCache is a Cache held in memory, it is safe for concurrent use
+type MemoryCache struct {
+	lock    sync.Mutex
+	entries map[string]cacheentry
+	// swept is when the expired entries were last removed, see Set
+	swept time.Time
+}
+
+// how often Set removes expired entries that are never read again
+const sweepevery = time.Minute
+
+// a cached value and when it stops being used
+type cacheentry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache returns an empty MemoryCache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]cacheentry)}
+}
+
+// Get returns the value for the key if it was set and has not expired
+func (mc *MemoryCache) Get(key string) ([]byte, bool) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	entry, ok := mc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(mc.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Set keeps the value for the key for ttl, every sweepevery it also removes the entries that have expired
+// so that those nobody asks for again don't stay in memory
+func (mc *MemoryCache) Set(key string, value []byte, ttl time.Duration) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	now := time.Now()
+	if now.Sub(mc.swept) >= sweepevery {
+		mc.swept = now
+		for key, entry := range mc.entries {
+			if now.After(entry.expires) {
+				delete(mc.entries, key)
+			}
+		}
+	}
+	mc.entries[key] = cacheentry{value: value, expires: now.Add(ttl)}
+}
+
+// WithCache returns a copy of the service that keeps the teams, team members and users it looks up in
+// the cache for ttl, the copy can be shared across repositories so they all benefit
+func (s *Service) WithCache(cache Cache, ttl time.Duration) *Service {
+	return s.with(func(s *Service) {
+		s.cache, s.cachettl = cache, ttl
+	})
+}
+
+// WithCache returns a copy of the code owners whose lookups go through the cache, see Service.WithCache
+func (co CodeOwners) WithCache(cache Cache, ttl time.Duration) CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.cache, s.cachettl = cache, ttl
+	})
+}
+
+// WithCacheScope returns a copy of the service whose cache entries are kept apart from those of services
+// sharing the cache with another scope, for when their tokens can see different teams and users, eg the
+// installation id of a github app, entries are always kept apart by the api url of the client
+func (s *Service) WithCacheScope(scope string) *Service {
+	return s.with(func(s *Service) {
+		s.cachescope = scope
+	})
+}
+
+// WithCacheScope returns a copy of the code owners whose cache entries are kept apart, see Service.WithCacheScope
+func (co CodeOwners) WithCacheScope(scope string) CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.cachescope = scope
+	})
+}
+
+// CacheTTLs are how long each kind of thing read is cached, see WithCacheTTLs and NewCachedService
+type CacheTTLs struct {
+	// Files are the CODEOWNERS and CODENOTIFY files themselves
+	Files time.Duration
+	// Teams are the teams of an org and their members
+	Teams time.Duration
+	// Users are user profiles and the logins found for email addresses
+	Users time.Duration
+}
+
+// WithCacheTTLs returns a copy of the service whose cache keeps each kind of lookup for its own ttl, zero
+// falls back to the ttl given to WithCache, except for Files which are only cached when it is set, a cached
+// file is its content and where it was found so Get makes no request for it, included and aliases files are read as ever
+func (s *Service) WithCacheTTLs(ttls CacheTTLs) *Service {
+	return s.with(func(s *Service) {
+		s.cachettls = ttls
+	})
+}
+
+// WithCacheTTLs returns a copy of the code owners whose cache keeps each kind of lookup for its own ttl, see Service.WithCacheTTLs
+func (co CodeOwners) WithCacheTTLs(ttls CacheTTLs) CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.cachettls = ttls
+	})
+}
+
+// fills value from the cache, reporting whether it was there, a hit counts towards the operation's Stats
+func (s *Service) cached(ctx context.Context, key string, value interface{}) bool {
+	if s.cache == nil {
+		return false
+	}
+	content, ok := s.cache.Get(s.scoped(key))
+	if !ok || json.Unmarshal(content, value) != nil {
+		return false
+	}
+	hits(ctx, 1)
+	return true
+}
+
+// puts a value in the cache
+func (s *Service) store(key string, value interface{}) {
+	if s.cache == nil {
+		return
+	}
+	if content, err := json.Marshal(value); err == nil {
+		s.cache.Set(s.scoped(key), content, s.ttl(key))
+	}
+}
+
+// how long to keep a value, by the kind of thing its key is for, see CacheTTLs
+func (s *Service) ttl(key string) time.Duration {
+	ttl := s.cachettl
+	switch key[:strings.Index(key, ":")+1] {
+	case "file:":
+		ttl = s.cachettls.Files
+	case "teams:", "members:", "routing:":
+		if s.cachettls.Teams > 0 {
+			ttl = s.cachettls.Teams
+		}
+	case "user:", "email:":
+		if s.cachettls.Users > 0 {
+			ttl = s.cachettls.Users
+		}
+	}
+	return ttl
+}
+
+// Delete removes the value for the key
+func (mc *MemoryCache) Delete(key string) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	delete(mc.entries, key)
+}
+
+// removes every value whose key starts with the prefix
+func (mc *MemoryCache) deleteprefix(prefix string) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	for key := range mc.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(mc.entries, key)
+		}
+	}
+}
+
+// the cache key for something looked up by name, names on github ignore case
+func cachekey(kind string, name string) string {
+	return kind + ":" + strings.ToLower(name)
+}
+
+// the key as it is kept in the cache, after the api url of the client and the scope of the service
+func (s *Service) scoped(key string) string {
+	host := ""
+	if s.client != nil && s.client.BaseURL != nil {
+		host = s.client.BaseURL.String()
+	}
+	return host + " " + s.cachescope + " " + key
+}
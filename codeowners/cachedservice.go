@@ -0,0 +1,92 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/github"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedService is a Service for long running processes that answer ownership questions continuously,
+// it keeps the files it reads as well as the teams and users it resolves in memory, each for its own ttl
+// the Service it embeds does the lookups, so its methods, and Match on the files it returns, share the cache
+type CachedService struct {
+	*Service
+	cache *MemoryCache
+	ttls  CacheTTLs
+	lock  sync.Mutex
+	files map[string]cachedfile
+}
+
+// a parsed file and when it stops being used
+type cachedfile struct {
+	owner   string
+	repo    string
+	co      CodeOwners
+	expires time.Time
+}
+
+// NewCachedService returns a CachedService that makes its api calls with the given client
+func NewCachedService(cl *github.Client, ttls CacheTTLs) *CachedService {
+	cache := NewMemoryCache()
+	return &CachedService{
+		Service: NewService(cl).with(func(s *Service) {
+			// the files are kept parsed rather than in the cache
+			s.cache, s.cachettls = cache, CacheTTLs{Teams: ttls.Teams, Users: ttls.Users}
+		}),
+		cache: cache,
+		ttls:  ttls,
+		files: make(map[string]cachedfile),
+	}
+}
+
+// Get is Service.Get answered from memory while the file read last time is within its ttl
+func (cs *CachedService) Get(ctx context.Context, owner string, repo string, opts ...GetOption) (CodeOwners, error) {
+	return cs.get(ctx, owner, repo, newgetoptions("CODEOWNERS", opts), false)
+}
+
+// GetNotify is Service.GetNotify answered from memory while the file read last time is within its ttl
+func (cs *CachedService) GetNotify(ctx context.Context, owner string, repo string, opts ...GetOption) (CodeOwners, error) {
+	return cs.get(ctx, owner, repo, newgetoptions("CODENOTIFY", opts), true)
+}
+
+// reads a file unless it is in memory, only files that were read without error are kept
+func (cs *CachedService) get(ctx context.Context, owner string, repo string, opts getoptions, notify bool) (CodeOwners, error) {
+	ctx = cs.operation(ctx)
+	key := strings.ToLower(fmt.Sprintf("%v/%v %+v", owner, repo, opts))
+	cs.lock.Lock()
+	file, ok := cs.files[key]
+	cs.lock.Unlock()
+	if ok && time.Now().Before(file.expires) {
+		hits(ctx, 1)
+		return file.co, nil
+	}
+	obj, err := cs.Service.get(ctx, owner, repo, opts)
+	obj.notify = notify
+	if err == nil && cs.ttls.Files > 0 {
+		cs.lock.Lock()
+		cs.files[key] = cachedfile{owner: owner, repo: repo, co: obj, expires: time.Now().Add(cs.ttls.Files)}
+		cs.lock.Unlock()
+	}
+	return obj, err
+}
+
+// Invalidate forgets the files read from a repository, eg when a push changes its CODEOWNERS file
+// an empty repo forgets the files of every repository of the owner along with the teams of the org,
+// for when its teams have changed, users are kept until their ttl as they belong to no one org,
+// teams are only forgotten for the cache scope of the service, see WithCacheScope
+func (cs *CachedService) Invalidate(owner string, repo string) {
+	cs.lock.Lock()
+	for key, file := range cs.files {
+		if strings.EqualFold(file.owner, owner) && (repo == "" || strings.EqualFold(file.repo, repo)) {
+			delete(cs.files, key)
+		}
+	}
+	cs.lock.Unlock()
+	if repo == "" {
+		cs.cache.Delete(cs.scoped(cachekey("teams", owner)))
+		cs.cache.deleteprefix(cs.scoped(cachekey("members", "@"+owner+"/")))
+	}
+}
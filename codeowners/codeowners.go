@@ -1,39 +1,147 @@
 package codeowners
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
-	"github.com/bmatcuk/doublestar"
 	"github.com/google/go-github/github"
+	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"net/mail"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
-// comms holds the channels that are used for communicating async
-type comms struct {
-	data chan *github.User
-	err  chan error
-	wait *sync.WaitGroup
+// Resolution is a single owner entry returned from MatchGraded
+// when the context deadline is too close to look up full user profiles the entry only carries
+// the login (or only the Team for a team whose members were not all found) and Complete is false
+type Resolution struct {
+	// Owner is the owner as it was written in the CODEOWNERS file, eg @org/team
+	Owner string
+	User  *github.User
+	// Team is set, with only its slug and organization, on the entry standing in for a team that was not
+	// fully expanded
+	Team     *github.Team
+	Complete bool
 }
 
-// this struct holds the description of a whole codeowners file
-type codeOwners struct {
+// DeadlineMargin is how close to the context deadline expansion has to be before it stops
+// hydrating full user profiles and falls back to returning logins and team slugs
+// it is read when NewService is called, later changes only affect services made after them
+//
+// Deprecated: use Service.WithDeadlineMargin
+var DeadlineMargin = 500 * time.Millisecond
+
+// CodeOwners holds the description of a whole codeowners file, it is returned from Get for calling Match on
+type CodeOwners struct {
 	owner    string
 	repo     string
-	patterns []codeOwner
+	patterns []CodeOwner
+	memo     *memo
+	// notify is set for CODENOTIFY files where every matching rule applies rather than the last
+	notify bool
+	// approvals raise the number of owner approvals needed for some paths
+	approvals []approvalpolicy
+	// source is where the file was read from
+	source    Source
+	matcher   MatcherKind
+	semantics semantics
+	sections  SectionMode
+	// document is the text the rules were parsed from
+	document document
+	// aliases name groups of owners that are expanded when matching
+	aliases Aliases
+	// service makes the api calls, it is nil for files read with Parse until WithClient is called
+	service *Service
+	// tree is every file in the repository when it was read WithArchive
+	tree *archivetree
 }
 
-// this struct holds a single line from a codeowners file
-type codeOwner struct {
+// the most paths a memo remembers the rule of, see rule
+const maxremembered = 1 << 16
+
+// memo remembers which pattern won for each path that has been matched, up to maxremembered paths
+// it is a pointer so that copies of a CodeOwners value share the same cache
+type memo struct {
+	lock  sync.RWMutex
+	rules map[string]int
+	// queries counts lookups that missed the cache, see MatcherAuto
+	queries int
+	index   *index
+	// expansions are the owners already resolved into users, see Refresh
+	expansions map[string][]Resolution
+}
+
+// CodeOwner holds a single rule (line) from a codeowners file
+type CodeOwner struct {
 	path   string
 	owners []string
+	// line is where the rule is in the file, counting from 1
+	line int
+	// comment is the text of a # comment at the end of the line
+	comment string
+	// file is the included file the rule came from, empty for the file itself
+	file string
+	// section is the gitlab section the rule is written in, see SectionsGitLab
+	section Section
+	// annotations are the key: value comments written about the rule
+	annotations map[string]string
+	// globs are the pattern compiled when the rule was parsed, see compileall
+	globs *globs
+}
+
+// Owner is the owner of the repository the file was read from
+func (co CodeOwners) Owner() string {
+	return co.owner
+}
+
+// Repo is the name of the repository the file was read from
+func (co CodeOwners) Repo() string {
+	return co.repo
+}
+
+// Source returns where the file was read from, it is empty for files read with Parse
+func (co CodeOwners) Source() Source {
+	return co.source
+}
+
+// Rules returns the rules in the order they appear in the file, later rules take precedence
+func (co CodeOwners) Rules() []CodeOwner {
+	rules := make([]CodeOwner, len(co.patterns))
+	copy(rules, co.patterns)
+	return rules
+}
+
+// Pattern is the path pattern of the rule
+func (co CodeOwner) Pattern() string {
+	return co.path
+}
+
+// Owners are the owners of the rule as written in the file, eg @login, @org/team or an email address
+func (co CodeOwner) Owners() []string {
+	owners := make([]string, len(co.owners))
+	copy(owners, co.owners)
+	return owners
+}
+
+// Line is the line of the file the rule was read from, counting from 1
+func (co CodeOwner) Line() int {
+	return co.line
+}
+
+// Comment is the text of a comment at the end of the rule's line, without the #
+func (co CodeOwner) Comment() string {
+	return co.comment
 }
 
-// format a codeOwners struct back into a string
-func (co codeOwners) String() string {
+// format a CodeOwners struct back into a string
+func (co CodeOwners) String() string {
 	lines := make([]string, len(co.patterns))
 	for idx, owner := range co.patterns {
 		lines[idx] = owner.String()
@@ -42,188 +150,1107 @@ func (co codeOwners) String() string {
 }
 
 // format a single line of a codeowners file
-func (co codeOwner) String() string {
+func (co CodeOwner) String() string {
+	if len(co.owners) == 0 {
+		return co.path
+	}
 	return fmt.Sprintf("%v %v", co.path, strings.Join(co.owners, " "))
 }
 
-var (
+// Service talks to the github api with a single client
+// each Service is independent so several can be used at once with different clients or base urls
+type Service struct {
 	client *github.Client
-)
+	// expansion changes which users a team is expanded into
+	expansion expansion
+	// cache keeps lookups for cachettl, see WithCache
+	cache    Cache
+	cachettl time.Duration
+	// slots limits the lookups made at once by every expansion sharing the service, see WithMaxConcurrency
+	slots chan struct{}
+	// retry is how rate limited calls are retried, DefaultRetryPolicy when nil, see WithRetry
+	retry *RetryPolicy
+	// breaker fails calls fast while github is having trouble, see WithCircuitBreaker
+	breaker *breaker
+	// maxrequests is how many requests each operation can make, see WithMaxAPIRequests
+	maxrequests int
+	// fetched holds the files read by GetCached
+	fetched *fetchstore
+	// flights are the lookups in flight, so copies of the service don't make the same one at once
+	flights *flightgroup
+	// cachettls override cachettl for each kind of lookup, see NewCachedService
+	cachettls CacheTTLs
+	// cachescope keeps the cache entries of services with different credentials apart, see WithCacheScope
+	cachescope string
+	// auditsink receives a record of every request, see WithAuditSink
+	auditsink AuditSink
+	// margin is how close to the deadline expansion falls back to logins and team slugs, see WithDeadlineMargin
+	margin time.Duration
+}
+
+// NewService returns a Service that makes its api calls with the given client
+// copies of it made by the With methods share one limit on concurrent lookups, the lookups in flight and the files read by GetCached
+func NewService(cl *github.Client) *Service {
+	return &Service{client: cl, slots: newslots(expandconcurrency), fetched: &fetchstore{fetched: make(map[string]CodeOwners)}, flights: newflightgroup(), margin: DeadlineMargin}
+}
+
+// Source describes the version of the file that a CodeOwners was read from
+type Source struct {
+	// Path is the location in the repository, eg .github/CODEOWNERS
+	Path string
+	// SHA is the blob the content was read from
+	SHA     string
+	HTMLURL string
+	// Ref is the branch, tag or commit that was asked for, empty for the default branch
+	Ref string
+	// ETag is the entity tag github sent with the file, which GetCached uses to ask whether it has changed
+	ETag string
+}
 
-// this will attempt to get the CODEOWNERS file from the various locations in the github repo
-func fetch(ctx context.Context, owner string, repo string) (string, error) {
-	options := github.RepositoryContentGetOptions{}
-	var files [3]string
-	files[0] = ""
-	files[1] = "docs/"
-	files[2] = ".github/"
+// this will attempt to get the named file (CODEOWNERS or CODENOTIFY) from each location in the github repo in turn
+// at the given ref, which is the default branch when empty, where the file was found is returned with its content
+func (s *Service) fetch(ctx context.Context, owner string, repo string, opts getoptions) (string, Source, error) {
+	if opts.previous.ETag != "" {
+		content, resp, err := s.fetchchanged(ctx, owner, repo, opts.previous)
+		switch {
+		case resp != nil && resp.Response != nil && resp.StatusCode == http.StatusNotModified:
+			return "", opts.previous, errnotmodified
+		case err == nil:
+			text, err := content.GetContent()
+			return text, contentsource(content, opts.previous.Path, opts.ref, resp), err
+		}
+		// the file may have moved, so look for it again
+	}
+	key := cachekey("file", fmt.Sprintf("%v/%v@%v:%v", owner, repo, opts.ref, strings.Join(opts.locations, ",")+"/"+opts.filename))
+	var file cachedcontent
+	if s.cachettls.Files > 0 && s.cached(ctx, key, &file) {
+		return file.Content, file.Source, nil
+	}
+	options := github.RepositoryContentGetOptions{Ref: opts.ref}
 	var content *github.RepositoryContent
-	var err error
-	for _, filepath := range files {
-		content, _, _, err = client.Repositories.GetContents(ctx, owner, repo, filepath+"CODEOWNERS", &options)
+	err := fmt.Errorf("No locations to look for %v in", opts.filename)
+	for _, filepath := range opts.locations {
+		var resp *github.Response
+		resp, err = s.call(ctx, "Repositories.GetContents", owner+"/"+repo, func() (resp *github.Response, err error) {
+			content, _, resp, err = s.client.Repositories.GetContents(ctx, owner, repo, filepath+opts.filename, &options)
+			return resp, err
+		})
 		if err != nil {
 			log.Print("Error getting code owners ", err)
 			continue
 		}
-		return content.GetContent()
+		text, err := content.GetContent()
+		source := contentsource(content, filepath+opts.filename, opts.ref, resp)
+		if err == nil && s.cachettls.Files > 0 {
+			s.store(key, cachedcontent{Content: text, Source: source})
+		}
+		return text, source, err
+	}
+	return "", Source{}, err
+}
+
+// a file as it is kept in the cache
+type cachedcontent struct {
+	Content string
+	Source  Source
+}
+
+// describes where a file was read from
+func contentsource(content *github.RepositoryContent, path string, ref string, resp *github.Response) Source {
+	source := Source{
+		Path:    path,
+		SHA:     content.GetSHA(),
+		HTMLURL: content.GetHTMLURL(),
+		Ref:     ref,
+	}
+	if resp != nil && resp.Response != nil {
+		source.ETag = resp.Header.Get("ETag")
+	}
+	return source
+}
+
+// WithDeadlineMargin returns a copy of the service whose expansions stop hydrating full user profiles, and
+// fall back to returning logins and team slugs, once the context deadline is closer than margin
+func (s *Service) WithDeadlineMargin(margin time.Duration) *Service {
+	return s.with(func(s *Service) {
+		s.margin = margin
+	})
+}
+
+// WithDeadlineMargin returns a copy of the code owners with a different deadline margin, see Service.WithDeadlineMargin
+func (co CodeOwners) WithDeadlineMargin(margin time.Duration) CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.margin = margin
+	})
+}
+
+// reports whether the context deadline is too close to spend api calls hydrating users
+func (s *Service) hurried(ctx context.Context) bool {
+	margin := DeadlineMargin
+	if s != nil {
+		margin = s.margin
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) < margin
+}
+
+// builds the partial Resolution for an owner that was never expanded
+// logins are kept as a bare github.User, teams as a bare github.Team
+func placeholder(ownertext string) Resolution {
+	partial := Resolution{Owner: ownertext}
+	split := strings.Index(ownertext, "/")
+	switch {
+	case islogin(ownertext):
+		login := ownertext[1:]
+		partial.User = &github.User{Login: &login}
+	case strings.HasPrefix(ownertext, "@") && split > 0:
+		org, slug := ownertext[1:split], ownertext[split+1:]
+		partial.Team = &github.Team{Slug: &slug, Organization: &github.Organization{Login: &org}}
+	}
+	return partial
+}
+
+// whether each owner was completely resolved, which is only so when every one of its resolutions is complete
+func completeowners(resolutions []Resolution) map[string]bool {
+	complete := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, resolution := range resolutions {
+		complete[resolution.Owner] = (complete[resolution.Owner] || !seen[resolution.Owner]) && resolution.Complete
+		seen[resolution.Owner] = true
+	}
+	return complete
+}
+
+// takes a username and asks the github api for full information about a user which is sent to the workers as a github.User struct
+// if the deadline is close only the login is sent back and the Resolution is marked incomplete
+func (s *Service) fetchuser(name string, ownertext string, ctx context.Context, w *workers) {
+	var cached github.User
+	if s.cached(ctx, cachekey("user", name), &cached) {
+		w.send(Resolution{Owner: ownertext, User: &cached, Complete: true})
+		return
+	}
+	if s.hurried(ctx) {
+		w.send(Resolution{Owner: ownertext, User: &github.User{Login: &name}})
+		return
+	}
+	value, err := s.flight(ctx, cachekey("user", name), func() (interface{}, error) {
+		var user *github.User
+		_, err := s.call(ctx, "Users.Get", repoof(ctx), func() (resp *github.Response, err error) {
+			user, resp, err = s.client.Users.Get(ctx, name)
+			return resp, err
+		})
+		return user, err
+	})
+	user, _ := value.(*github.User)
+	switch {
+	case apicode(err, CodeUnknownOwner) == CodeUnknownOwner:
+		w.fail(unknownowner(err.Error(), ErrUserNotFound, err))
+	case err != nil:
+		w.fail(apierror(err, CodeUnknownOwner))
+	default:
+		s.store(cachekey("user", name), user)
+		w.send(Resolution{Owner: ownertext, User: user, Complete: true})
+	}
+}
+
+// how many users are requested in a single graphql query
+const hydratebatch = 100
+
+// the fields of a graphql User that are copied onto a github.User
+type graphqluser struct {
+	Login      string `json:"login"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	DatabaseID int64  `json:"databaseId"`
+	AvatarURL  string `json:"avatarUrl"`
+	URL        string `json:"url"`
+}
+
+// convert a graphql user into the github.User shape the rest of the package returns
+// graphql uses empty strings where the rest api uses null so those are left unset
+func (gu graphqluser) user() *github.User {
+	user := &github.User{
+		Login: &gu.Login,
+		ID:    &gu.DatabaseID,
+	}
+	if gu.Name != "" {
+		user.Name = &gu.Name
+	}
+	if gu.Email != "" {
+		user.Email = &gu.Email
+	}
+	if gu.AvatarURL != "" {
+		user.AvatarURL = &gu.AvatarURL
+	}
+	if gu.URL != "" {
+		user.HTMLURL = &gu.URL
+	}
+	return user
+}
+
+// the graphql endpoint sits beside the rest api, which on enterprise is /api/v3/ rather than the root
+func (s *Service) graphqlendpoint() string {
+	if strings.HasSuffix(s.client.BaseURL.Path, "/v3/") {
+		return "../graphql"
+	}
+	return "graphql"
+}
+
+// takes a list of logins and fetches their details with as few graphql queries as possible
+// logins that graphql could not return are left out of the map for the caller to fetch some other way
+func (s *Service) hydrate(ctx context.Context, logins []string) (map[string]*github.User, error) {
+	users := make(map[string]*github.User, len(logins))
+	var missing []string
+	for _, login := range logins {
+		var cached github.User
+		if s.cached(ctx, cachekey("user", login), &cached) {
+			users[login] = &cached
+			continue
+		}
+		missing = append(missing, login)
+	}
+	logins = missing
+	for start := 0; start < len(logins); start += hydratebatch {
+		end := start + hydratebatch
+		if end > len(logins) {
+			end = len(logins)
+		}
+		var query bytes.Buffer
+		query.WriteString("query {")
+		for idx, login := range logins[start:end] {
+			fmt.Fprintf(&query, " u%d: user(login: %s) { login name email databaseId avatarUrl url }", idx, strconv.Quote(login))
+		}
+		query.WriteString(" }")
+		var response struct {
+			Data map[string]*graphqluser `json:"data"`
+		}
+		// the request is made afresh for every attempt as sending it uses up its body
+		_, err := s.call(ctx, "GraphQL", repoof(ctx), func() (*github.Response, error) {
+			req, err := s.client.NewRequest("POST", s.graphqlendpoint(), map[string]string{"query": query.String()})
+			if err != nil {
+				return nil, err
+			}
+			return s.client.Do(ctx, req, &response)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for idx, login := range logins[start:end] {
+			if gu := response.Data[fmt.Sprintf("u%d", idx)]; gu != nil {
+				users[login] = gu.user()
+				s.store(cachekey("user", login), users[login])
+			}
+		}
+	}
+	return users, nil
+}
+
+// WithGraphQLUsers returns a copy of the code owners that fetches the owners written as logins with batched
+// graphql queries, as is always done for the members of a team, rather than a Users.Get for each of them
+// logins graphql can't return, or all of them if graphql fails, are still fetched one at a time
+func (co CodeOwners) WithGraphQLUsers() CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.expansion.graphqlusers = true
+	})
+}
+
+// the login owners to fetch together with graphql, in the order they are written
+func (s *Service) batchable(owners []string, ctx context.Context) []string {
+	if s == nil || s.client == nil || !s.expansion.graphqlusers || s.hurried(ctx) {
+		return nil
+	}
+	var batch []string
+	for _, ownertext := range owners {
+		if islogin(ownertext) {
+			batch = append(batch, ownertext)
+		}
+	}
+	// a single login costs the same either way
+	if len(batch) < 2 {
+		return nil
 	}
-	return "", err
+	return batch
+}
+
+// reports whether an owner is written as the login of a user, eg @juan
+func islogin(ownertext string) bool {
+	return strings.HasPrefix(ownertext, "@") && !strings.Contains(ownertext, "/")
 }
 
-// takes a username and asks the github api for full information about a user which is sent through the data channel as a github.User struct
-func fetchuser(name string, ctx context.Context, ch comms) {
-	defer ch.wait.Done()
-	user, _, err := client.Users.Get(ctx, name)
+// takes login owners and sends their github.User objects to the workers, fetching those graphql
+// could not return one at a time
+func (s *Service) fetchusers(ownertexts []string, ctx context.Context, w *workers) {
+	logins := make([]string, len(ownertexts))
+	for idx, ownertext := range ownertexts {
+		logins[idx] = ownertext[1:]
+	}
+	hydrated, err := s.hydrate(ctx, logins)
 	if err != nil {
-		ch.err <- err
-	} else {
-		ch.data <- user
+		log.Print("Falling back to fetching users one at a time ", err)
+	}
+	for _, ownertext := range ownertexts {
+		if user, ok := hydrated[ownertext[1:]]; ok {
+			w.send(Resolution{Owner: ownertext, User: user, Complete: true})
+			continue
+		}
+		ownertext := ownertext
+		w.fork(func() {
+			s.fetchuser(ownertext[1:], ownertext, ctx, w)
+		})
 	}
 }
 
-// takes an email string, parses it out to ensure validity and then constructs a github.User struct to send back down the data channel
+// takes an email string, parses it out to ensure validity and then constructs a github.User struct to send to the workers
 // the github api does not allow for searching by an email address so this is the best that I can manage
-func finduseremail(email string, ctx context.Context, ch comms) {
-	defer ch.wait.Done()
+func finduseremail(email string, ctx context.Context, w *workers) {
 	e, err := mail.ParseAddress(email)
 	if err != nil {
-		ch.err <- err
+		w.fail(&Error{Code: CodeInvalidOwner, Message: fmt.Sprintf("Do not understand user specification %v", email), Err: err})
 		return
 	}
-	ch.data <- &github.User{
-		Email: &e.Address,
+	w.send(Resolution{
+		Owner:    email,
+		User:     &github.User{Email: &e.Address},
+		Complete: true,
+	})
+}
+
+// how many teams or members are asked for in each page
+const pagesize = 100
+
+// lists every team in an org, following the pages of results
+func (s *Service) listteams(org string, ctx context.Context) ([]*github.Team, error) {
+	var teams []*github.Team
+	key := cachekey("teams", org)
+	if s.cached(ctx, key, &teams) {
+		return teams, nil
+	}
+	value, err := s.flight(ctx, key, func() (interface{}, error) {
+		return s.fetchteams(org, ctx)
+	})
+	if err != nil {
+		return nil, err
 	}
+	teams = value.([]*github.Team)
+	s.store(key, teams)
+	return teams, nil
 }
 
-// this takes a string team name in the form of org/slug and sends the github users back through the data channel
-func expandteam(fullteam string, ctx context.Context, ch comms) {
-	defer ch.wait.Done()
+// fetches every page of the teams in an org
+func (s *Service) fetchteams(org string, ctx context.Context) ([]*github.Team, error) {
+	var teams []*github.Team
+	opt := github.ListOptions{PerPage: pagesize}
+	for {
+		var page []*github.Team
+		resp, err := s.call(ctx, "Organizations.ListTeams", repoof(ctx), func() (resp *github.Response, err error) {
+			page, resp, err = s.client.Organizations.ListTeams(ctx, org, &opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, page...)
+		if resp.NextPage == 0 {
+			return teams, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// this takes a string team name in the form of @org/slug and finds the matching github.Team
+// every team in the org is returned too so that callers can walk the team hierarchy
+func (s *Service) findteam(fullteam string, ctx context.Context) (*github.Team, []*github.Team, error) {
 	split := strings.Index(fullteam, "/")
-	teams, _, err := client.Organizations.ListTeams(ctx, fullteam[1:split], &github.ListOptions{})
+	teams, err := s.listteams(fullteam[1:split], ctx)
+	if apicode(err, CodeUnknownOwner) == CodeUnknownOwner {
+		return nil, nil, unknownowner(err.Error(), ErrTeamNotFound, err)
+	}
 	if err != nil {
-		ch.err <- err
-		return
+		return nil, nil, apierror(err, CodeUnknownOwner)
 	}
 	teamname := fullteam[split+1:]
-	var teamid int64
 	for _, team := range teams {
 		if teamname == *team.Slug {
-			teamid = *team.ID
-			break
+			return team, teams, nil
 		}
 	}
-	if teamid == 0 {
-		ch.err <- errors.New(fmt.Sprintf("Failed to find team matching %v", teamname))
-		return
+	return nil, teams, unknownowner(fmt.Sprintf("Failed to find team matching %v", teamname), ErrTeamNotFound, nil)
+}
+
+// this takes a string team name in the form of @org/slug and returns the logins of its members
+// with child teams expanded too, see WithChildTeams, the members of every team below it are included
+func (s *Service) teammembers(fullteam string, ctx context.Context) ([]string, error) {
+	key := cachekey("members", fmt.Sprintf("%v:%v:%v", fullteam, s.expansion.role, s.expansion.childteams))
+	var logins []string
+	if s.cached(ctx, key, &logins) {
+		return logins, nil
 	}
-	opt := github.OrganizationListTeamMembersOptions{}
-	users, _, err := client.Organizations.ListTeamMembers(ctx, teamid, &opt)
+	value, err := s.flight(ctx, key, func() (interface{}, error) {
+		return s.fetchmembers(fullteam, ctx)
+	})
 	if err != nil {
-		ch.err <- err
+		return nil, err
+	}
+	logins = value.([]string)
+	s.store(key, logins)
+	return logins, nil
+}
+
+// fetches the logins of the members of a team, and of its child teams when they are expanded too
+func (s *Service) fetchmembers(fullteam string, ctx context.Context) ([]string, error) {
+	if s.expansion.graphqlteams {
+		return s.graphqlmembers(fullteam, ctx)
+	}
+	return s.restmembers(fullteam, ctx)
+}
+
+// fetchmembers by listing the teams of the org and then the members of each team
+func (s *Service) restmembers(fullteam string, ctx context.Context) ([]string, error) {
+	team, teams, err := s.findteam(fullteam, ctx)
+	if err != nil {
+		return nil, err
+	}
+	expanded := []*github.Team{team}
+	if s.expansion.childteams {
+		expanded = append(expanded, children(team, teams)...)
+	}
+	logins := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, team := range expanded {
+		members, err := s.listmembers(team.GetID(), ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, login := range members {
+			if !seen[strings.ToLower(login)] {
+				seen[strings.ToLower(login)] = true
+				logins = append(logins, login)
+			}
+		}
+	}
+	return logins, nil
+}
+
+// lists the logins of the direct members of a team with the role chosen by WithTeamRole, following the pages of results
+func (s *Service) listmembers(id int64, ctx context.Context) ([]string, error) {
+	logins := make([]string, 0)
+	opt := github.OrganizationListTeamMembersOptions{
+		Role:        string(s.expansion.role),
+		ListOptions: github.ListOptions{PerPage: pagesize},
+	}
+	for {
+		var users []*github.User
+		resp, err := s.call(ctx, "Organizations.ListTeamMembers", repoof(ctx), func() (resp *github.Response, err error) {
+			users, resp, err = s.client.Organizations.ListTeamMembers(ctx, id, &opt)
+			return resp, err
+		})
+		if apicode(err, CodeUnknownOwner) == CodeUnknownOwner {
+			return nil, unknownowner(err.Error(), ErrTeamNotFound, err)
+		}
+		if err != nil {
+			return nil, apierror(err, CodeUnknownOwner)
+		}
+		for _, user := range users {
+			logins = append(logins, *user.Login)
+		}
+		if resp.NextPage == 0 {
+			return logins, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// this takes a string team name in the form of org/slug and sends the github users to the workers
+func (s *Service) expandteam(fullteam string, ctx context.Context, w *workers) {
+	logins, err := s.teammembers(fullteam, ctx)
+	if err != nil {
+		w.fail(err)
 		return
 	}
-	for _, user := range users {
-		ch.wait.Add(1)
-		go fetchuser(*user.Login, ctx, ch)
+	w.expect(fullteam, len(logins))
+	var hydrated map[string]*github.User
+	if !s.hurried(ctx) {
+		hydrated, err = s.hydrate(ctx, logins)
+		if err != nil {
+			log.Print("Falling back to fetching team members one at a time ", err)
+		}
+	}
+	for _, login := range logins {
+		if user, ok := hydrated[login]; ok {
+			w.send(Resolution{Owner: fullteam, User: user, Complete: true})
+			continue
+		}
+		login := login
+		w.fork(func() {
+			s.fetchuser(login, fullteam, ctx, w)
+		})
 	}
 }
 
-// this takes an individual owner (team, email or login) and sends github.User objects to the data channel
-func expandowners(ownertext string, ctx context.Context, ch comms) {
-	defer ch.wait.Done()
+// this takes an individual owner (team, email or login) and sends github.User objects to the workers
+func (s *Service) expandowners(ownertext string, ctx context.Context, w *workers) {
 	switch {
+	case strings.HasPrefix(ownertext, "@") && (s == nil || s.client == nil):
+		w.fail(noclient(ownertext))
+	case strings.HasPrefix(ownertext, "@") && strings.Contains(ownertext, "/") && s.hurried(ctx):
+		w.send(placeholder(ownertext))
 	case strings.HasPrefix(ownertext, "@") && strings.Contains(ownertext, "/"):
-		ch.wait.Add(1)
-		go expandteam(ownertext, ctx, ch)
+		w.spawn(func() {
+			s.expandteam(ownertext, ctx, w)
+		})
 	case strings.HasPrefix(ownertext, "@"):
-		ch.wait.Add(1)
-		go fetchuser(ownertext[1:], ctx, ch)
+		w.spawn(func() {
+			s.fetchuser(ownertext[1:], ownertext, ctx, w)
+		})
+	case strings.Contains(ownertext, "@") && s != nil && s.client != nil && s.expansion.emails:
+		w.spawn(func() {
+			s.findemail(ownertext, ctx, w)
+		})
 	case strings.Contains(ownertext, "@"):
-		ch.wait.Add(1)
-		go finduseremail(ownertext, ctx, ch)
+		finduseremail(ownertext, ctx, w)
 	default:
-		ch.err <- errors.New(fmt.Sprintf("Do not understand user specification ", ownertext))
+		w.fail(&Error{Code: CodeInvalidOwner, Message: fmt.Sprintf("Do not understand user specification %v", ownertext)})
 	}
 }
 
-// Get is the "entrypoint" where a codeOwners struct is returned for calling Match on
-func Get(ctx context.Context, cl *github.Client, owner string, repo string) (codeOwners, error) {
-	client = cl
-	obj := codeOwners{
-		owner: owner,
-		repo:  repo,
+// Get is the "entrypoint" where a CodeOwners struct is returned for calling Match on
+// it is shorthand for NewService(cl).Get
+//
+// Deprecated: use NewService(cl).Get, or any Provider, so the client and options are set up once
+func Get(ctx context.Context, cl *github.Client, owner string, repo string, opts ...GetOption) (CodeOwners, error) {
+	return NewService(cl).Get(ctx, owner, repo, opts...)
+}
+
+// GetNotify is shorthand for NewService(cl).GetNotify
+//
+// Deprecated: use NewService(cl).GetNotify, or any Provider
+func GetNotify(ctx context.Context, cl *github.Client, owner string, repo string, opts ...GetOption) (CodeOwners, error) {
+	return NewService(cl).GetNotify(ctx, owner, repo, opts...)
+}
+
+// Get fetches and parses the CODEOWNERS file of a repository
+// by default the root, docs/ and .github/ directories of the default branch are searched, see GetOption
+// the returned CodeOwners keeps using this Service for Match and the other methods that call github
+func (s *Service) Get(ctx context.Context, owner string, repo string, opts ...GetOption) (CodeOwners, error) {
+	return s.get(ctx, owner, repo, newgetoptions("CODEOWNERS", opts))
+}
+
+// GetNotify fetches a CODENOTIFY file, which has the same syntax as CODEOWNERS but only drives notifications
+// unlike CODEOWNERS the owners of every rule matching a path are returned from Match, not just the last one
+func (s *Service) GetNotify(ctx context.Context, owner string, repo string, opts ...GetOption) (CodeOwners, error) {
+	obj, err := s.get(ctx, owner, repo, newgetoptions("CODENOTIFY", opts))
+	obj.notify = true
+	return obj, err
+}
+
+// fetch and parse the named file
+func (s *Service) get(ctx context.Context, owner string, repo string, opts getoptions) (CodeOwners, error) {
+	ctx = withrepo(s.operation(ctx), owner, repo)
+	obj := CodeOwners{
+		owner:   owner,
+		repo:    repo,
+		memo:    &memo{rules: make(map[string]int)},
+		service: s,
+	}
+	var content string
+	var source Source
+	var err error
+	if opts.archive {
+		var files []string
+		content, source, files, err = s.fetcharchive(ctx, owner, repo, opts)
+		obj.tree = &archivetree{ref: opts.ref, files: files}
+	} else {
+		content, source, err = s.fetch(ctx, owner, repo, opts)
 	}
-	patterns := make([]codeOwner, 0)
-	content, err := fetch(ctx, owner, repo)
 	if err != nil {
-		return obj, err
+		return obj, apierror(err, CodeNoCodeowners)
 	}
-	for _, line := range strings.Split(content, "\n") {
-		words := strings.Fields(line)
-		if len(words) > 1 {
-			if words[0] == "*" {
-				words[0] = "**"
-			}
-			patterns = append(patterns, codeOwner{
-				path:   words[0],
-				owners: words[1:],
-			})
+	obj.source = source
+	obj.patterns = parse(content)
+	obj.document = newdocument(content)
+	if opts.includes {
+		obj, err = obj.Include(s.loader(ctx, owner, repo, opts.ref))
+		if err != nil {
+			return obj, err
+		}
+	}
+	if opts.aliases != "" {
+		obj.aliases, err = s.fetchaliases(ctx, owner, repo, opts.aliases, opts.ref)
+		if err != nil {
+			return obj, err
 		}
 	}
-	obj.patterns = patterns
 	return obj, nil
 }
 
-// Match a file to some github users (or email addresses)
-// called on a codeOwners struct
-func (co codeOwners) Match(ctx context.Context, path string) (users []*github.User, error_slice []error) {
+// Parse reads a CODEOWNERS file from any source, such as a file on disk, a git blob or stdin
+// nothing is fetched from github, owners are only resolved to users if Match is later called
+func Parse(r io.Reader) (CodeOwners, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return CodeOwners{}, err
+	}
+	return ParseString(string(content)), nil
+}
+
+// ParseString is Parse for content already held in memory
+func ParseString(content string) CodeOwners {
+	return CodeOwners{
+		patterns: parse(content),
+		document: newdocument(content),
+		memo:     &memo{rules: make(map[string]int)},
+	}
+}
+
+// splits the content of a CODEOWNERS file into its rules
+func parse(content string) []CodeOwner {
+	patterns := make([]CodeOwner, 0)
+	text := lines(content)
+	for idx, line := range text {
+		if rule, ok := parseline(line); ok {
+			rule.line = idx + 1
+			rule.annotations = annotations(text, idx)
+			patterns = append(patterns, rule)
+		}
+	}
+	return patterns
+}
+
+// reads the rule on a single line, if there is one
+func parseline(line string) (CodeOwner, bool) {
+	rule, comment := splitcomment(line)
+	words := strings.Fields(rule)
+	if len(words) == 0 {
+		return CodeOwner{}, false
+	}
+	if words[0] == "*" {
+		words[0] = "**"
+	}
+	return CodeOwner{
+		path:    words[0],
+		owners:  words[1:],
+		comment: comment,
+		globs:   compileall(words[0]),
+	}, true
+}
+
+// splits a file into lines, files written on windows have their \r\n endings and byte order mark removed
+func lines(content string) []string {
+	content = strings.TrimPrefix(content, "\ufeff")
+	split := strings.Split(content, "\n")
+	for idx, line := range split {
+		split[idx] = strings.TrimSuffix(line, "\r")
+	}
+	return split
+}
+
+// splits a line at the # starting a comment, which is either the first thing on the line or follows a space
+// a # inside a word, or escaped as \#, is part of the pattern
+func splitcomment(line string) (string, string) {
+	for idx := 0; idx < len(line); idx++ {
+		if line[idx] != '#' {
+			continue
+		}
+		if idx == 0 || line[idx-1] == ' ' || line[idx-1] == '\t' {
+			return line[:idx], strings.TrimSpace(line[idx+1:])
+		}
+	}
+	return line, ""
+}
+
+// finds the index of the last pattern matching the path or -1 if nothing matches
+// answers are remembered so hot paths skip glob evaluation on later calls
+func (co CodeOwners) rule(path string) int {
+	if co.memo != nil {
+		co.memo.lock.RLock()
+		idx, ok := co.memo.rules[path]
+		co.memo.lock.RUnlock()
+		if ok {
+			return idx
+		}
+	}
+	idx := co.lookup(path)
+	if co.memo != nil {
+		co.memo.lock.Lock()
+		if len(co.memo.rules) >= maxremembered {
+			// a long running service sees paths without end, starting again keeps the memory used bounded
+			co.memo.rules = make(map[string]int)
+		}
+		co.memo.rules[path] = idx
+		co.memo.lock.Unlock()
+	}
+	return idx
+}
+
+// the owners written against a path, or nil if no rule matches, a rule without owners gives an empty slice
+// for CODENOTIFY files the owners of every matching rule are combined in file order, a rule without
+// owners clears those of the rules above it
+func (co CodeOwners) ownersfor(path string) []string {
+	if co.sections == SectionsGitLab && !co.notify {
+		return co.sectionowners(path)
+	}
+	if !co.notify {
+		if idx := co.rule(path); idx >= 0 {
+			return co.aliases.expand(co.patterns[idx].owners)
+		}
+		return nil
+	}
 	var owners []string
+	seen := make(map[string]bool)
 	for _, pattern := range co.patterns {
-		match, _ := doublestar.Match(pattern.path, path)
-		if match {
-			owners = pattern.owners
+		if !co.matchesrule(pattern, path) {
+			continue
+		}
+		if len(pattern.owners) == 0 {
+			owners, seen = []string{}, make(map[string]bool)
+			continue
+		}
+		for _, ownertext := range co.aliases.expand(pattern.owners) {
+			if !seen[ownertext] {
+				seen[ownertext] = true
+				owners = append(owners, ownertext)
+			}
 		}
 	}
+	return owners
+}
+
+// the owners of a path, or the error for a path that no rule matches or that a rule leaves unowned
+func (co CodeOwners) owned(path string) ([]string, error) {
+	owners := co.ownersfor(path)
+	switch {
+	case owners == nil:
+		return nil, nomatch()
+	case len(owners) == 0:
+		rule, _ := co.RuleFor(path)
+		return nil, unowned(path, rule)
+	}
+	return owners, nil
+}
+
+// WithClient returns a copy of the CodeOwners that resolves owners through the given client
+// this is the optional step that lets a file read with Parse be used with Match
+func (co CodeOwners) WithClient(cl *github.Client) CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.client = cl
+	})
+}
+
+// OwnersOf returns the owners written against a path exactly as they appear in the file
+// it is nil when no rule matches and empty when the matching rule has no owners
+// unlike Match this never talks to github, so it works on the result of Parse
+func (co CodeOwners) OwnersOf(path string) []string {
+	owners := co.ownersfor(path)
 	if owners == nil {
-		error_slice = append(error_slice, errors.New("Failed to find match"))
+		return nil
+	}
+	return append([]string{}, owners...)
+}
+
+// RuleFor finds the rule that decides the owners of a path without talking to github
+// the second result is false when no rule matches
+func (co CodeOwners) RuleFor(path string) (CodeOwner, bool) {
+	idx := co.rule(path)
+	if idx < 0 {
+		return CodeOwner{}, false
+	}
+	return co.patterns[idx], true
+}
+
+// MatchResult is a path matched to its owners along with the rule that gave them ownership
+type MatchResult struct {
+	// Rule is the last rule matching the path, which for a CODENOTIFY file is one of several that apply
+	Rule  CodeOwner
+	Users []*github.User
+	// Partial is set when an error stopped some of the owners from being resolved, Users then only
+	// holds the users of the owners that were
+	Partial bool
+	// Stats is the api usage of the match, for MatchMany it is that of the whole batch
+	Stats Stats
+}
+
+// MatchRule matches a file like Match and also reports which rule matched, so callers can show
+// where in the file the ownership comes from, eg "owned by @org/team per line 42: src/api/"
+func (co CodeOwners) MatchRule(ctx context.Context, path string) (MatchResult, []error) {
+	rule, ok := co.RuleFor(path)
+	if !ok {
+		return MatchResult{}, []error{nomatch()}
+	}
+	ctx = co.operation(ctx)
+	resolutions, error_slice := co.MatchGraded(ctx, path)
+	return MatchResult{Rule: rule, Users: resolvedusers(resolutions), Partial: len(error_slice) > 0, Stats: statsof(ctx)}, error_slice
+}
+
+// Lookup matches a file to its owners like MatchRule, but any errors are joined into one with errors.Join
+// so each can still be found with errors.Is and errors.As, when only some of the owners could not be
+// resolved the users of the rest are returned with Partial set alongside the error
+// the users are distinct and in a stable order, see Match
+func (co CodeOwners) Lookup(ctx context.Context, path string) (MatchResult, error) {
+	result, error_slice := co.MatchRule(ctx, path)
+	return result, errors.Join(error_slice...)
+}
+
+// MatchMany matches a batch of paths, resolving each distinct owner only once however many paths it owns
+// paths that no rule matches are left out of the map, errors are for owners that could not be resolved
+func (co CodeOwners) MatchMany(ctx context.Context, paths []string) (map[string]MatchResult, []error) {
+	ctx = co.operation(ctx)
+	owners := make(map[string][]string, len(paths))
+	var distinct []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		texts := co.ownersfor(path)
+		if texts == nil {
+			continue
+		}
+		owners[path] = texts
+		for _, ownertext := range texts {
+			if !seen[ownertext] {
+				seen[ownertext] = true
+				distinct = append(distinct, ownertext)
+			}
+		}
+	}
+	resolutions, error_slice := co.expand(ctx, distinct)
+	stats := statsof(ctx)
+	users := make(map[string][]*github.User)
+	for _, resolution := range resolutions {
+		if resolution.User != nil {
+			users[resolution.Owner] = append(users[resolution.Owner], resolution.User)
+		}
+	}
+	complete := completeowners(resolutions)
+	results := make(map[string]MatchResult, len(owners))
+	for path, texts := range owners {
+		result := MatchResult{Stats: stats}
+		result.Rule, _ = co.RuleFor(path)
+		for _, ownertext := range texts {
+			result.Users = append(result.Users, users[ownertext]...)
+			// the errors don't say which owner they are for, so an owner without a complete resolution is taken to have failed
+			result.Partial = result.Partial || (len(error_slice) > 0 && !complete[ownertext])
+		}
+		result.Users = distinctusers(result.Users)
+		results[path] = result
+	}
+	return results, error_slice
+}
+
+// Match a file to some github users (or email addresses)
+// called on a CodeOwners struct, when the context ends first the errors include one wrapping ctx.Err()
+// each user is returned once, in the order their owners are written in the rule and by login within a team
+//
+// Deprecated: use Lookup, which returns a single error and says whether the users are only some of the owners
+func (co CodeOwners) Match(ctx context.Context, path string) (users []*github.User, error_slice []error) {
+	resolutions, error_slice := co.MatchGraded(ctx, path)
+	return resolvedusers(resolutions), error_slice
+}
+
+// the users of the resolutions that have one, each only once
+func resolvedusers(resolutions []Resolution) (users []*github.User) {
+	users = make([]*github.User, 0, len(resolutions))
+	for _, resolution := range resolutions {
+		if resolution.User != nil {
+			users = append(users, resolution.User)
+		}
+	}
+	return distinctusers(users)
+}
+
+// identifies a user by login, or by email address for an owner that is only an email, ignoring case
+func userkey(user *github.User) string {
+	if user.GetLogin() != "" {
+		return strings.ToLower(user.GetLogin())
+	}
+	return strings.ToLower(user.GetEmail())
+}
+
+// leaves out the users that appeared earlier in the list, eg a member of two owning teams
+func distinctusers(users []*github.User) []*github.User {
+	kept := users[:0]
+	if len(users) > smallset {
+		seen := make(map[string]bool)
+		for _, user := range users {
+			key := userkey(user)
+			if key != "" && seen[key] {
+				continue
+			}
+			seen[key] = true
+			kept = append(kept, user)
+		}
+		return kept
+	}
+	// the owners of most rules are few enough that looking back through them is cheaper than a map
+	for _, user := range users {
+		key, repeat := userkey(user), false
+		for _, earlier := range kept {
+			if key != "" && userkey(earlier) == key {
+				repeat = true
+				break
+			}
+		}
+		if !repeat {
+			kept = append(kept, user)
+		}
+	}
+	return kept
+}
+
+// how many owners or users are searched through rather than put in a map
+const smallset = 16
+
+// puts the resolutions in the order their owners are written in, and the users of each owner in order of
+// login, so the results don't depend on which lookups happened to finish first
+func ordered(owners []string, resolutions []Resolution) []Resolution {
+	var positions map[string]int
+	if len(owners) > smallset {
+		positions = make(map[string]int, len(owners))
+		for idx := len(owners) - 1; idx >= 0; idx-- {
+			positions[owners[idx]] = idx
+		}
+	}
+	position := func(owner string) int {
+		if positions != nil {
+			return positions[owner]
+		}
+		for idx, ownertext := range owners {
+			if ownertext == owner {
+				return idx
+			}
+		}
+		return 0
+	}
+	compare := func(a Resolution, b Resolution) int {
+		if pa, pb := position(a.Owner), position(b.Owner); pa != pb {
+			return pa - pb
+		}
+		return strings.Compare(userkey(a.User), userkey(b.User))
+	}
+	// owners remembered from earlier matches are usually in order already
+	if !slices.IsSortedFunc(resolutions, compare) {
+		slices.SortStableFunc(resolutions, compare)
+	}
+	return resolutions
+}
+
+// MatchGraded matches a file like Match but reports how far each owner was resolved
+// there is a Resolution for every user of every owner, in the same order as Match, so a user that is in
+// two owning teams is there twice
+// as the context deadline approaches user profiles stop being fetched, and if the context
+// ends before an owner was expanded it is still returned as an incomplete Resolution along
+// with a CodeCanceled error wrapping ctx.Err()
+func (co CodeOwners) MatchGraded(ctx context.Context, path string) (resolutions []Resolution, error_slice []error) {
+	owners, err := co.owned(path)
+	if err != nil {
+		error_slice = append(error_slice, err)
 		return nil, error_slice
 	}
-	var wg sync.WaitGroup
-	ch := comms{
-		data: make(chan *github.User),
-		err:  make(chan error),
-		wait: &wg,
+	return co.expand(ctx, owners)
+}
+
+// expands owners into Resolutions, owners already expanded by an earlier call on this CodeOwners are
+// answered from the memo and only owners that were resolved completely, without any errors, are kept
+func (co CodeOwners) expand(ctx context.Context, owners []string) (resolutions []Resolution, error_slice []error) {
+	ctx = co.operation(ctx)
+	if co.memo == nil {
+		return co.service.expand(ctx, owners)
 	}
+	defer func() {
+		resolutions = ordered(owners, resolutions)
+	}()
+	var missing []string
+	co.memo.lock.RLock()
+	size := 0
 	for _, ownertext := range owners {
-		ch.wait.Add(1)
-		go expandowners(ownertext, ctx, ch)
+		size += len(co.memo.expansions[ownertext])
+	}
+	resolutions = make([]Resolution, 0, size)
+	for _, ownertext := range owners {
+		if expanded, ok := co.memo.expansions[ownertext]; ok {
+			resolutions = append(resolutions, expanded...)
+		} else {
+			missing = append(missing, ownertext)
+		}
+	}
+	co.memo.lock.RUnlock()
+	hits(ctx, len(owners)-len(missing))
+	if len(missing) == 0 {
+		return resolutions, nil
 	}
-	go func() {
-		ch.wait.Wait()
-		close(ch.data)
-		close(ch.err)
+	fetched, error_slice := co.service.expand(ctx, missing)
+	resolutions = append(resolutions, fetched...)
+	if len(error_slice) > 0 {
+		return resolutions, error_slice
+	}
+	expanded := make(map[string][]Resolution)
+	complete := make(map[string]bool)
+	for _, ownertext := range missing {
+		complete[ownertext] = true
+	}
+	for _, resolution := range fetched {
+		expanded[resolution.Owner] = append(expanded[resolution.Owner], resolution)
+		complete[resolution.Owner] = complete[resolution.Owner] && resolution.Complete
+	}
+	co.memo.lock.Lock()
+	if co.memo.expansions == nil {
+		co.memo.expansions = make(map[string][]Resolution)
+	}
+	for _, ownertext := range missing {
+		if complete[ownertext] {
+			co.memo.expansions[ownertext] = expanded[ownertext]
+		}
+	}
+	co.memo.lock.Unlock()
+	return resolutions, nil
+}
+
+// Refresh forgets the owners that have been resolved into users, so the next Match looks them up on github again
+// it affects every copy of the CodeOwners that shares its rules
+func (co CodeOwners) Refresh() {
+	if co.memo == nil {
+		return
+	}
+	co.memo.lock.Lock()
+	co.memo.expansions = nil
+	co.memo.lock.Unlock()
+}
+
+// expands the owners of a single rule concurrently into Resolutions
+// if the context ends before an owner was expanded it is still returned as an incomplete Resolution
+func (s *Service) expand(ctx context.Context, owners []string) (resolutions []Resolution, error_slice []error) {
+	ctx = s.operation(ctx)
+	defer func() {
+		resolutions = ordered(owners, s.filtered(resolutions))
 	}()
-	err_closed, data_closed := false, false
-	for {
-		//if both channels are closed then we can stop
-		if err_closed && data_closed {
-			return users, error_slice
-		}
-		select {
-		case <-ctx.Done():
-			return // returning not to leak the goroutine
-		case err, err_ok := <-ch.err:
-			if !err_ok {
-				err_closed = true
-			} else {
-				error_slice = append(error_slice, err)
+	w := newworkers(ctx, s.semaphore())
+	batch := s.batchable(owners, ctx)
+	if batch != nil {
+		w.spawn(func() {
+			s.fetchusers(batch, ctx, w)
+		})
+	}
+	for _, ownertext := range owners {
+		if batch == nil || !islogin(ownertext) {
+			s.expandowners(ownertext, ctx, w)
+		}
+	}
+	resolutions, error_slice = w.wait()
+	if ctx.Err() != nil {
+		// hand back whatever was never fully expanded rather than nothing at all, a team counts as expanded
+		// only once a resolution came back for each of its members
+		found := make(map[string]int)
+		for _, resolution := range resolutions {
+			found[resolution.Owner]++
+		}
+		for _, ownertext := range owners {
+			expected, ok := w.expected(ownertext)
+			if !ok {
+				expected = 1
 			}
-		case user, data_ok := <-ch.data:
-			if !data_ok {
-				data_closed = true
-			} else {
-				users = append(users, user)
+			if found[ownertext] < expected {
+				found[ownertext] = expected
+				resolutions = append(resolutions, placeholder(ownertext))
 			}
 		}
+		error_slice = append(error_slice, canceled(ctx.Err()))
 	}
+	return resolutions, error_slice
 }
@@ -6,16 +6,29 @@
 package codeowners
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/bmatcuk/doublestar"
+	"github.com/ddub/go-github-codeowners/replay"
 	"github.com/google/go-github/github"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -34,7 +47,7 @@ var (
 // setup sets up a test HTTP server along with a github.Client that is
 // configured to talk to that test server. Tests should register handlers on
 // mux which provide mock responses for the API method being tested.
-func setup(t *testing.T) {
+func setup(t testing.TB) {
 	// test server
 	mux = http.NewServeMux()
 
@@ -58,6 +71,8 @@ func setup(t *testing.T) {
 	mux.HandleFunc("/teams/72/members", testHandler)
 	mux.HandleFunc("/users/juan", testHandler)
 	mux.HandleFunc("/users/joe", testHandler)
+	mux.HandleFunc("/orgs/example/memberships/juan", testHandler)
+	mux.HandleFunc("/orgs/example/memberships/joe", testHandler)
 }
 
 // teardown closes the test HTTP server.
@@ -91,17 +106,17 @@ func fakeresponder(content string) func(http.ResponseWriter, *http.Request) {
 		sha := "1234567890123456789012345678901234567890"
 		url := "https://github.com/"
 		info := github.RepositoryContent{
-			&ftype,
-			&encoding,
-			&size,
-			&path,
-			&path,
-			&content,
-			&sha,
-			&url,
-			&url,
-			&url,
-			&url,
+			Type:        &ftype,
+			Encoding:    &encoding,
+			Size:        &size,
+			Name:        &path,
+			Path:        &path,
+			Content:     &content,
+			SHA:         &sha,
+			URL:         &url,
+			GitURL:      &url,
+			HTMLURL:     &url,
+			DownloadURL: &url,
 		}
 		js, err := json.Marshal(info)
 		if err != nil {
@@ -269,7 +284,7 @@ func TestCodeOwnerString(t *testing.T) {
 	owners := make([]string, 2)
 	owners[0] = "@jon"
 	owners[1] = "@bill"
-	result := codeOwner{
+	result := CodeOwner{
 		path:   "*",
 		owners: owners,
 	}.String()
@@ -282,16 +297,16 @@ func TestCodeOwnersString(t *testing.T) {
 	names := make([]string, 2)
 	names[0] = "@jon"
 	names[1] = "@example/bills"
-	owners := make([]codeOwner, 2)
-	owners[0] = codeOwner{
+	owners := make([]CodeOwner, 2)
+	owners[0] = CodeOwner{
 		path:   "*",
 		owners: names,
 	}
-	owners[1] = codeOwner{
+	owners[1] = CodeOwner{
 		path:   "other.txt",
 		owners: names,
 	}
-	result := codeOwners{
+	result := CodeOwners{
 		owner:    "",
 		repo:     "",
 		patterns: owners,
@@ -302,7 +317,8 @@ func TestCodeOwnersString(t *testing.T) {
 }
 
 func TestCodeOwnerTimeOut(t *testing.T) {
-	ctx, _ := context.WithTimeout(context.Background(), time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
 	setup(t)
 	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", longresponder())
 	start := time.Now()
@@ -315,21 +331,3522 @@ func TestCodeOwnerTimeOut(t *testing.T) {
 
 func TestMatchTimeOut(t *testing.T) {
 	setup(t)
+	defer teardown()
 	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @example/long"))
+	var hit int32
 	longHandler := func(w http.ResponseWriter, r *http.Request) {
-		time.Sleep(1 * time.Minute)
-		t.Errorf("Failed timeout request: %s", r.URL.Path)
+		atomic.StoreInt32(&hit, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(1 * time.Minute):
+			t.Errorf("Failed timeout request: %s", r.URL.Path)
+		}
 	}
 	mux.HandleFunc("/teams/55/members", longHandler)
 	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	// a margin below the timeout so the slow request is made rather than given up on up front
+	co = co.WithDeadlineMargin(10 * time.Millisecond)
 	start := time.Now()
-	ctx, _ := context.WithTimeout(context.Background(), 100*time.Millisecond)
-	_, err := co.Match(ctx, "*")
-	if err != nil {
-		t.Errorf("Failed: %s", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, errs := co.Match(ctx, "*")
+	if len(errs) != 1 || CodeOf(errs[0]) != CodeCanceled {
+		t.Errorf("Expected the match to be canceled got %v", errs)
 	}
 	elapsed := time.Now().Sub(start)
 	if elapsed > 500*time.Millisecond {
 		t.Fatal("codeowners string rendered poorly, got ", elapsed)
 	}
+	if atomic.LoadInt32(&hit) == 0 {
+		t.Error("Expected the slow team members request to be made")
+	}
+}
+
+func TestMatchGradedDeadline(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan @example/team everyone@example.com"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	ctx, cancel := context.WithTimeout(context.Background(), DeadlineMargin/2)
+	defer cancel()
+	resolutions, errs := co.MatchGraded(ctx, "file.txt")
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	if len(resolutions) != 3 {
+		t.Fatalf("Expected 3 resolutions got %v", len(resolutions))
+	}
+	for _, r := range resolutions {
+		switch r.Owner {
+		case "@juan":
+			if r.Complete || r.User.GetLogin() != "juan" || r.User.Name != nil {
+				t.Errorf("Expected a bare login for @juan got %v", github.Stringify(r))
+			}
+		case "@example/team":
+			if r.Complete || r.User != nil || r.Team.GetSlug() != "team" || r.Team.GetOrganization().GetLogin() != "example" {
+				t.Errorf("Expected an unexpanded team got %v", github.Stringify(r))
+			}
+		case "everyone@example.com":
+			if !r.Complete {
+				t.Errorf("Expected email to be complete")
+			}
+		default:
+			t.Errorf("Unexpected owner %v", r.Owner)
+		}
+	}
+}
+
+// a cache that never has anything and holds up every lookup of one key after the first until released
+type stallcache struct {
+	stall    string
+	looked   int32
+	released chan struct{}
+}
+
+func (c *stallcache) Get(key string) ([]byte, bool) {
+	if strings.HasSuffix(key, " "+c.stall) && atomic.AddInt32(&c.looked, 1) > 1 {
+		<-c.released
+	}
+	return nil, false
+}
+
+func (c *stallcache) Set(key string, value []byte, ttl time.Duration) {}
+
+func TestMatchGradedPartialTeam(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @example/team"))
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": {"u0": {"login": "juan", "name": "Juan G", "databaseId": 6}}}`)
+	})
+	cache := &stallcache{stall: "user:joe", released: make(chan struct{})}
+	defer close(cache.released)
+	co, _ := NewService(testclient).WithCache(cache, time.Minute).WithDeadlineMargin(10*time.Millisecond).Get(context.TODO(), "example", "repo")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	resolutions, errs := co.MatchGraded(ctx, "file.txt")
+	if len(errs) != 1 || !errors.Is(errs[0], context.DeadlineExceeded) {
+		t.Fatal("Expected the deadline to be exceeded got ", errs)
+	}
+	var found []string
+	for _, r := range resolutions {
+		switch {
+		case r.User != nil && r.Complete:
+			found = append(found, r.User.GetLogin())
+		case r.User == nil && !r.Complete && r.Team.GetSlug() == "team":
+			found = append(found, "incomplete "+r.Owner)
+		default:
+			t.Errorf("Unexpected resolution %v", github.Stringify(r))
+		}
+	}
+	if result := strings.Join(found, ","); result != "incomplete @example/team,juan" {
+		t.Fatalf("Expected juan and the team marked incomplete got %v", result)
+	}
+	results, _ := co.MatchMany(ctx, []string{"file.txt"})
+	if !results["file.txt"].Partial {
+		t.Fatalf("Expected a partial result got %v", results["file.txt"])
+	}
+}
+
+func TestMatchMemo(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan\ntest/** @joe"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	if idx := co.rule("test/file.txt"); idx != 1 {
+		t.Fatalf("Expected rule 1 got %v", idx)
+	}
+	if idx := co.rule("none"); idx != 0 {
+		t.Fatalf("Expected rule 0 got %v", idx)
+	}
+	co.patterns[1].path = "other/**"
+	if idx := co.rule("test/file.txt"); idx != 1 {
+		t.Fatalf("Expected remembered rule 1 got %v", idx)
+	}
+	if len(co.memo.rules) != 2 {
+		t.Fatalf("Expected 2 remembered paths got %v", len(co.memo.rules))
+	}
+}
+
+func TestTeamGraphQLHydration(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @example/team"))
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(body), `u0: user(login: \"juan\")`) {
+			t.Errorf("Unexpected graphql query %s", body)
+		}
+		fmt.Fprint(w, `{"data": {"u0": {"login": "juan", "name": "Juan G", "databaseId": 6}, "u1": {"login": "joe", "name": "Joe G", "databaseId": 69}}}`)
+	})
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	match, errs := co.Match(context.TODO(), "file.txt")
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	sort.Slice(match, func(i, j int) bool { return *match[i].Login < *match[j].Login })
+	var users []string
+	for _, u := range match {
+		users = append(users, fmtuser(*u))
+	}
+	if result := strings.Join(users, ","); result != "joe:Joe G,juan:Juan G" {
+		t.Fatalf("Expected users from graphql got %v", result)
+	}
+}
+
+func TestMemberships(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @example/team everyone@example.com"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	users, _ := co.Match(context.TODO(), "file.txt")
+	memberships, errs := co.Memberships(context.TODO(), users)
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	if len(memberships) != 2 {
+		t.Fatalf("Expected 2 memberships got %v", len(memberships))
+	}
+	for _, m := range memberships {
+		switch m.User.GetLogin() {
+		case "juan":
+			if !m.Active() || m.Role != "admin" {
+				t.Errorf("Expected juan to be an active admin got %v %v", m.State, m.Role)
+			}
+		case "joe":
+			if m.Active() || m.Role != "member" {
+				t.Errorf("Expected joe to be a pending member got %v %v", m.State, m.Role)
+			}
+		}
+	}
+	ghost := "ghost"
+	if _, errs := co.Memberships(context.TODO(), []*github.User{{Login: &ghost}}); len(errs) != 1 || CodeOf(errs[0]) != CodeNotFound {
+		t.Errorf("Expected a coded error for a missing membership got %v", errs)
+	}
+	if _, errs := ParseString("* @juan").Memberships(context.TODO(), users); len(errs) != 1 || CodeOf(errs[0]) != CodeAPI {
+		t.Errorf("Expected memberships to fail without a client got %v", errs)
+	}
+}
+
+func TestMembershipsConcurrency(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var running, most int32
+	var users []*github.User
+	for idx := 0; idx < 6; idx++ {
+		login := fmt.Sprintf("user%v", idx)
+		users = append(users, &github.User{Login: &login})
+		mux.HandleFunc("/orgs/example/memberships/"+login, func(w http.ResponseWriter, r *http.Request) {
+			now := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				previous := atomic.LoadInt32(&most)
+				if now <= previous || atomic.CompareAndSwapInt32(&most, previous, now) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			fmt.Fprint(w, `{"state": "active", "role": "member"}`)
+		})
+	}
+	users = append(users, &github.User{Email: github.String("everyone@example.com")})
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan"))
+	co, _ := NewService(testclient).WithMaxConcurrency(2).Get(context.TODO(), "example", "repo")
+	memberships, errs := co.Memberships(context.TODO(), users)
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	var logins []string
+	for _, m := range memberships {
+		logins = append(logins, m.User.GetLogin())
+	}
+	if strings.Join(logins, ",") != "user0,user1,user2,user3,user4,user5" {
+		t.Errorf("Expected the memberships in the order of the users got %v", logins)
+	}
+	if most != 2 {
+		t.Errorf("Expected 2 lookups at once got %v", most)
+	}
+}
+
+func TestTeamHierarchy(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan @example/team @example/drumpf"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	teams, errs := co.Teams(context.TODO(), "file.txt")
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	if len(teams) != 2 {
+		t.Fatalf("Expected 2 teams got %v", len(teams))
+	}
+	if path := teams[0].Path(); path != "owners/team" {
+		t.Errorf("Expected owners/team got %v", path)
+	}
+	if parent := teams[0].Parent(); parent.GetName() != "Owners" {
+		t.Errorf("Expected the full parent team got %v", github.Stringify(parent))
+	}
+	if teams[1].Parent() != nil || teams[1].Path() != "drumpf" {
+		t.Errorf("Expected a top level team got %v", teams[1].Path())
+	}
+}
+
+func TestAuditTwoFactor(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan\ntest/** @example/team\ndocs/** @Joe @ghost"))
+	mux.HandleFunc("/orgs/example/members", func(w http.ResponseWriter, r *http.Request) {
+		if filter := r.URL.Query().Get("filter"); filter != "2fa_disabled" {
+			t.Errorf("Expected 2fa_disabled filter got %v", filter)
+		}
+		fmt.Fprint(w, `[{"login": "joe", "id": 69}]`)
+	})
+	var users []string
+	co, _ := NewService(testclient).WithAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		if record.Operation == "Users.Get" {
+			users = append(users, record.URL)
+		}
+	})).Get(context.TODO(), "example", "repo")
+	findings, errs := co.AuditTwoFactor(context.TODO())
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	if len(findings) != 2 || findings[0].Pattern != "test/**" || strings.Join(findings[0].Logins, ",") != "joe" || strings.Join(findings[1].Logins, ",") != "joe" {
+		t.Fatalf("Expected test/** and docs/** to be flagged for joe got %v", findings)
+	}
+	if len(users) != 0 {
+		t.Errorf("Expected the owners to be compared by login without looking them up got %v", users)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/.github/CODENOTIFY", fakeresponder("* @juan\ntest/** @joe @juan"))
+	co, err := GetNotify(context.TODO(), testclient, "example", "repo")
+	if err != nil {
+		t.Fatal("Expect to get no error; got ", err)
+	}
+	match, errs := co.Match(context.TODO(), "test/file.txt")
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	sort.Slice(match, func(i, j int) bool { return *match[i].Login < *match[j].Login })
+	var users []string
+	for _, u := range match {
+		users = append(users, fmtuser(*u))
+	}
+	if result := strings.Join(users, ","); result != "joe:Joe,juan:Juan" {
+		t.Fatalf("Expected every matching rule to notify got %v", result)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	names := []string{"@jon", "@example/bills"}
+	co := CodeOwners{
+		patterns: []CodeOwner{
+			{path: "**", owners: names},
+			{path: "docs/**", owners: names[:1]},
+		},
+	}
+	if result := co.Manifest(); result != "** @jon @example/bills\ndocs/** @jon" {
+		t.Fatal("manifest rendered incorrectly, got ", result)
+	}
+	if result := co.Manifest("@Example/Bills"); result != "** @example/bills" {
+		t.Fatal("filtered manifest rendered incorrectly, got ", result)
+	}
+}
+
+func TestMentionedPaths(t *testing.T) {
+	text := `Crash in test/file.txt, e.g. on version 1.2 see https://example.com/docs/page.html
+panic: boom
+	/home/runner/work/repo/repo/src/server.go:42 +0x1d
+File "/app/main.py", line 3`
+	result := strings.Join(mentionedpaths(text, "repo"), ",")
+	if result != "test/file.txt,src/server.go,app/main.py" {
+		t.Fatal("Found the wrong paths, got ", result)
+	}
+}
+
+func TestSuggestAssignees(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @juan\ntest/** @example/team"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	suggestion, errs := co.SuggestAssignees(context.TODO(), "Failure in test/file.txt", "main.go:12 and readme.md")
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	if result := strings.Join(suggestion.Paths, ","); result != "test/file.txt,main.go" {
+		t.Errorf("Expected owned paths got %v", result)
+	}
+	if result := strings.Join(suggestion.Assignees, ","); result != "joe,juan" {
+		t.Errorf("Expected assignees got %v", result)
+	}
+	if result := strings.Join(suggestion.Labels, ","); result != "team" {
+		t.Errorf("Expected team label got %v", result)
+	}
+}
+
+func TestMarkdownTable(t *testing.T) {
+	co := CodeOwners{
+		patterns: []CodeOwner{
+			{path: "*.go", owners: []string{"@juan"}},
+			{path: "test/**", owners: []string{"@example/team", "@joe"}},
+		},
+	}
+	paths := []string{"test/b.txt", "readme.md", "main.go", "test/a.txt"}
+	expected := MarkdownMarker + "\n" +
+		"| Files | Owners |\n| --- | --- |\n" +
+		"| `main.go` | @juan |\n" +
+		"| `test/a.txt`<br>`test/b.txt` | @example/team @joe |\n" +
+		"| `readme.md` | _none_ |\n"
+	if result := co.MarkdownTable(paths, nil); result != expected {
+		t.Fatal("markdown table rendered incorrectly, got ", result)
+	}
+	approved := co.MarkdownTable(paths, map[string]bool{"@joe": true})
+	if !strings.Contains(approved, "| `main.go` | @juan | :x: |\n") || !strings.Contains(approved, "@example/team @joe | :white_check_mark: |\n") {
+		t.Fatal("markdown approvals rendered incorrectly, got ", approved)
+	}
+}
+
+func pullresponder(files []string, reviews string) {
+	mux.HandleFunc("/repos/example/repo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		var changed []string
+		for _, file := range files {
+			changed = append(changed, fmt.Sprintf(`{"filename": %q}`, file))
+		}
+		fmt.Fprint(w, "["+strings.Join(changed, ",")+"]")
+	})
+	mux.HandleFunc("/repos/example/repo/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, reviews)
+	})
+}
+
+func TestIsApprovedByOwners(t *testing.T) {
+	cases := map[string]string{
+		`[{"user": {"login": "joe"}, "state": "APPROVED"}]`:                                                                                                              "@juan",
+		`[{"user": {"login": "juan"}, "state": "APPROVED"}, {"user": {"login": "juan"}, "state": "COMMENTED"}]`:                                                          "",
+		`[{"user": {"login": "Juan"}, "state": "APPROVED"}, {"user": {"login": "juan"}, "state": "CHANGES_REQUESTED"}, {"user": {"login": "joe"}, "state": "APPROVED"}]`: "@juan",
+		`[]`: "@example/team,@juan",
+	}
+	for reviews, expected := range cases {
+		setup(t)
+		mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @juan\ntest/** @example/team\nvendor/** @juan"))
+		pullresponder([]string{"main.go", "test/file.txt", "docs/readme.md"}, reviews)
+		co, _ := Get(context.TODO(), testclient, "example", "repo")
+		approved, outstanding, errs := co.IsApprovedByOwners(context.TODO(), 1)
+		if len(errs) != 0 {
+			t.Fatal("Expect to get no error; got ", errs)
+		}
+		if result := strings.Join(outstanding, ","); result != expected || approved != (expected == "") {
+			t.Errorf("Expected outstanding %v got %v (approved %v)", expected, result, approved)
+		}
+		teardown()
+	}
+}
+
+func TestApprovalProgress(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @juan\ntest/** @example/team @juan"))
+	pullresponder([]string{"main.go", "test/a.txt", "test/b.txt"}, `[{"user": {"login": "joe"}, "state": "APPROVED"}]`)
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	progress, errs := co.ApprovalProgress(context.TODO(), 1)
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	if len(progress) != 2 {
+		t.Fatalf("Expected 2 rules got %v", len(progress))
+	}
+	if progress[0].Pattern != "*.go" || progress[0].Satisfied() || strings.Join(progress[0].Pending, ",") != "@juan" {
+		t.Errorf("Expected *.go to be pending on @juan got %v", progress[0])
+	}
+	if !progress[1].Satisfied() || strings.Join(progress[1].Approved, ",") != "@example/team" || strings.Join(progress[1].Pending, ",") != "@juan" || len(progress[1].Files) != 2 {
+		t.Errorf("Expected test/** to be approved by the team got %v", progress[1])
+	}
+}
+
+func TestWithApprovals(t *testing.T) {
+	cases := map[string]string{
+		`[{"user": {"login": "joe"}, "state": "APPROVED"}]`:                                                   "@example/team",
+		`[{"user": {"login": "joe"}, "state": "APPROVED"}, {"user": {"login": "juan"}, "state": "APPROVED"}]`: "",
+	}
+	for reviews, expected := range cases {
+		setup(t)
+		mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("test/** @example/team"))
+		pullresponder([]string{"test/a.txt"}, reviews)
+		co, _ := Get(context.TODO(), testclient, "example", "repo")
+		approved, outstanding, errs := co.WithApprovals("test/**", 2).IsApprovedByOwners(context.TODO(), 1)
+		if len(errs) != 0 {
+			t.Fatal("Expect to get no error; got ", errs)
+		}
+		if result := strings.Join(outstanding, ","); result != expected || approved != (expected == "") {
+			t.Errorf("Expected outstanding %v got %v (approved %v)", expected, result, approved)
+		}
+		if len(co.approvals) != 0 {
+			t.Errorf("Expected WithApprovals to leave the original alone")
+		}
+		teardown()
+	}
+}
+
+func TestOnCall(t *testing.T) {
+	co := CodeOwners{
+		patterns: []CodeOwner{
+			{path: "**", owners: []string{"@example/team", "@joe", "everyone@example.com"}},
+		},
+	}
+	resolver := OnCallResolverFunc(func(ctx context.Context, team string) (*github.User, error) {
+		if team != "@example/team" {
+			t.Errorf("Unexpected team %v", team)
+		}
+		login := "juan"
+		return &github.User{Login: &login}, nil
+	})
+	users, errs := co.OnCall(context.TODO(), "src/main.go", resolver)
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	var result []string
+	for _, u := range users {
+		result = append(result, fmtuser(*u))
+	}
+	if strings.Join(result, ",") != "juan,joe,everyone@example.com" {
+		t.Fatal("Expected the on call engineer and individual owners, got ", result)
+	}
+}
+
+func TestOnCallNobody(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("** @example/team @ann"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	users, errs := co.OnCall(context.TODO(), "src/main.go", OnCallResolverFunc(func(ctx context.Context, team string) (*github.User, error) {
+		return nil, nil
+	}))
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	var result []string
+	for _, u := range users {
+		result = append(result, fmtuser(*u))
+	}
+	if strings.Join(result, ",") != "juan,joe,ann" {
+		t.Fatal("Expected the members of a team nobody is on call for, got ", result)
+	}
+	if _, errs := ParseString("** @example/team").OnCall(context.TODO(), "src/main.go", OnCallResolverFunc(func(ctx context.Context, team string) (*github.User, error) {
+		return nil, nil
+	})); len(errs) != 1 {
+		t.Errorf("Expected the members of a team not to be looked up without a client got %v", errs)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	co := CodeOwners{
+		patterns: []CodeOwner{
+			{path: "**", owners: []string{"@juan"}},
+			{path: "docs/", owners: []string{"@joe", "@juan"}},
+			{path: "src/*", owners: []string{"@joe"}},
+			{path: "docs/**", owners: []string{"@Juan", "@joe"}},
+			{path: "/**", owners: []string{"@example/team"}},
+			{path: "src/*", owners: []string{"@joe"}},
+		},
+	}
+	conflicts := co.Conflicts()
+	if len(conflicts) != 1 {
+		t.Fatalf("Expected 1 conflict got %v", conflicts)
+	}
+	if conflicts[0].Pattern != "**" || conflicts[0].Winner() != 4 || len(conflicts[0].Owners) != 2 {
+		t.Fatalf("Expected ** to be won by rule 4 got %v", conflicts[0])
+	}
+}
+
+func treeresponder(files ...string) {
+	mux.HandleFunc("/repos/example/repo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "repo", "default_branch": "main"}`)
+	})
+	mux.HandleFunc("/repos/example/repo/git/trees/main", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("recursive") != "1" {
+			http.Error(w, "expected a recursive tree", http.StatusBadRequest)
+		}
+		entries := []string{`{"path": "test", "type": "tree"}`}
+		for _, file := range files {
+			entries = append(entries, fmt.Sprintf(`{"path": %q, "type": "blob"}`, file))
+		}
+		fmt.Fprintf(w, `{"sha": "main", "tree": [%v]}`, strings.Join(entries, ","))
+	})
+}
+
+func TestImpact(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan\n*.md @joe\ntest/** @example/team"))
+	treeresponder("main.go", "readme.md", "test/a.txt", "test/b.txt", "test/c.md")
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	impact, err := co.Impact(context.TODO(), "")
+	if err != nil {
+		t.Fatal("Expect to get no error; got ", err)
+	}
+	var result []string
+	for _, rule := range impact {
+		result = append(result, fmt.Sprintf("%v:%v/%v", rule.Pattern, rule.Owned, rule.Matched))
+	}
+	if strings.Join(result, ",") != "test/**:3/3,**:1/5,*.md:1/2" {
+		t.Fatal("Expected rules ranked by impact, got ", result)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := CodeOwners{patterns: parse("* @juan\ndocs/ @joe\nsrc/** @joe\nold/** @juan")}
+	after := CodeOwners{patterns: parse("* @juan\ndocs/** @Joe\nsrc/** @example/team @joe\nnew/** @juan")}
+	js, err := json.Marshal(Diff(before, after))
+	if err != nil {
+		t.Fatal("Expect to get no error; got ", err)
+	}
+	// docs/ owns a docs directory at any depth while gitignore anchors docs/** to the root, so they are different rules
+	expected := `{"rules":[` +
+		`{"pattern":"docs/**","change":"added","after":["@Joe"],"gained":["@Joe"]},` +
+		`{"pattern":"src/**","change":"modified","before":["@joe"],"after":["@example/team","@joe"],"gained":["@example/team"]},` +
+		`{"pattern":"new/**","change":"added","after":["@juan"],"gained":["@juan"]},` +
+		`{"pattern":"docs/","change":"removed","before":["@joe"],"lost":["@joe"]},` +
+		`{"pattern":"old/**","change":"removed","before":["@juan"],"lost":["@juan"]}],` +
+		`"prefixes":[{"prefix":"/","lost":["@joe"]},{"prefix":"docs/","gained":["@Joe"]},{"prefix":"new/","gained":["@juan"]},` +
+		`{"prefix":"old/","lost":["@juan"]},{"prefix":"src/","gained":["@example/team"]}]}`
+	if string(js) != expected {
+		t.Fatal("diff rendered incorrectly, got ", string(js))
+	}
+	if changes := Diff(ParseString("/docs/ @joe"), ParseString("docs/** @Joe")); len(changes.Rules) != 0 {
+		t.Errorf("Expected /docs/ and docs/** to be the same rule got %+v", changes.Rules)
+	}
+	changes := Diff(ParseString("/src/api/** @ann\n/src/web/ @bob\n/docs/a.md @joe"), ParseString("/src/api/** @bob\n/src/web/ @ann\n/src/web/main.go @joe\n/docs/b.md @joe"))
+	var prefixes []string
+	for _, prefix := range changes.Prefixes {
+		prefixes = append(prefixes, fmt.Sprintf("%v+%v-%v", prefix.Prefix, strings.Join(prefix.Gained, " "), strings.Join(prefix.Lost, " ")))
+	}
+	if strings.Join(prefixes, ",") != "src/api/+@bob-@ann,src/web/+@ann @joe-@bob" {
+		t.Errorf("Expected the owners gained and lost under each directory got %v", prefixes)
+	}
+}
+
+func TestDiffPullRequest(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "base": {"sha": "aaa"}, "head": {"sha": "bbb", "repo": {"name": "repo", "owner": {"login": "example"}}}}`)
+	})
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") == "bbb" {
+			fakeresponder("* @joe")(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	})
+	changes, err := DiffPullRequest(context.TODO(), testclient, "example", "repo", 1)
+	if err != nil {
+		t.Fatal("Expect to get no error; got ", err)
+	}
+	if len(changes.Rules) != 1 || changes.Rules[0].Change != "added" {
+		t.Fatalf("Expected the new CODEOWNERS to be all additions got %v", changes)
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	missing := &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}
+	if !isnotfound(missing) || !isnotfound(fmt.Errorf("fetching CODEOWNERS: %w", missing)) {
+		t.Errorf("Expected a 404 to be found however it is wrapped")
+	}
+	if isnotfound(&github.ErrorResponse{}) || isnotfound(&github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusForbidden}}) || isnotfound(nil) {
+		t.Errorf("Expected only a 404 to be not found")
+	}
+}
+
+func TestValidateBlob(t *testing.T) {
+	snapshot := Snapshot{
+		Users: map[string]bool{"juan": true, "joe": true},
+		Teams: map[string]bool{"example/team": true},
+	}
+	content := "# owners\n* @Juan\n\ndocs/\nsrc/** @example/team @example/drumpf\ntest/** no-at @nobody everyone@example.com"
+	var result []string
+	for _, err := range ValidateBlob(content, snapshot) {
+		result = append(result, err.Error())
+	}
+	expected := "line 5: unknown team @example/drumpf,line 6: Do not understand user specification no-at,line 6: unknown user @nobody"
+	if strings.Join(result, ",") != expected {
+		t.Fatal("Validation reported the wrong errors, got ", result)
+	}
+	if errs := ValidateBlob(content, Snapshot{}); len(errs) != 1 {
+		t.Fatal("Expected only syntax errors without a snapshot, got ", errs)
+	}
+}
+
+func TestLinguistAttributes(t *testing.T) {
+	attrs := parseattributes("# generated code\n*.pb.go linguist-generated=true\nvendor/** linguist-vendored\nvendor/ours/** -linguist-vendored\n*.md text")
+	cases := map[string]bool{
+		"api/service.pb.go":     true,
+		"vendor/lib/lib.go":     true,
+		"vendor/ours/ours.go":   false,
+		"docs/readme.md":        false,
+		"api/service.go":        false,
+		"other/vendor/lib/x.go": false,
+	}
+	for file, expected := range cases {
+		if attrs.linguist(file) != expected {
+			t.Errorf("Expected linguist %v for %v", expected, file)
+		}
+	}
+}
+
+func TestFindUnowned(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @juan\ntest/** @example/team"))
+	mux.HandleFunc("/repos/example/repo/contents/.gitattributes", fakeresponder("gen/** linguist-generated"))
+	treeresponder("main.go", "readme.md", "test/a.txt", "gen/api.txt")
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	unowned, err := co.FindUnowned(context.TODO(), "", CoverageOptions{})
+	if err != nil || strings.Join(unowned, ",") != "readme.md,gen/api.txt" {
+		t.Fatalf("Expected readme.md and gen/api.txt unowned got %v %v", unowned, err)
+	}
+	unowned, err = co.FindUnowned(context.TODO(), "", CoverageOptions{SkipLinguist: true})
+	if err != nil || strings.Join(unowned, ",") != "readme.md" {
+		t.Fatalf("Expected generated files to be skipped got %v %v", unowned, err)
+	}
+}
+
+func TestFindUnownedLocal(t *testing.T) {
+	root, err := ioutil.TempDir("", "codeowners")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	files := map[string]string{
+		".gitignore":                "node_modules/\n*.log\n/build\n!keep.log\n",
+		".gitattributes":            "gen/** linguist-generated\n",
+		"main.go":                   "",
+		"debug.log":                 "",
+		"keep.log":                  "",
+		"build/out.bin":             "",
+		"src/build/notes.txt":       "",
+		"node_modules/lib/index.js": "",
+		"web/node_modules/x.js":     "",
+		"web/.gitignore":            "*.tmp\n",
+		"web/app.tmp":               "",
+		"gen/api.txt":               "",
+		".git/HEAD":                 "",
+	}
+	for name, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := ioutil.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	co := CodeOwners{patterns: parse("*.go @juan\n**/.git* @joe")}
+	unowned, err := co.FindUnownedLocal(root, CoverageOptions{SkipLinguist: true})
+	if err != nil {
+		t.Fatal("Expect to get no error; got ", err)
+	}
+	if result := strings.Join(unowned, ","); result != "keep.log,src/build/notes.txt" {
+		t.Fatal("Expected ignored files to be skipped, got ", result)
+	}
+}
+
+func TestScanOrg(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/orgs/example/repos", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name": "repo", "size": 10}, {"name": "old", "size": 10, "archived": true}, {"name": "new", "size": 0},
+			{"name": "secret", "size": 10}, {"name": "fresh", "size": 10}, {"name": "nocodeowner", "size": 10}]`)
+	})
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan"))
+	mux.HandleFunc("/repos/example/secret/contents/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Resource protected by organization SAML enforcement"}`, http.StatusForbidden)
+	})
+	mux.HandleFunc("/repos/example/fresh/contents/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "This repository is empty."}`, http.StatusConflict)
+	})
+	scans, err := ScanOrg(context.TODO(), testclient, "example")
+	if err != nil {
+		t.Fatal("Expect to get no error; got ", err)
+	}
+	var result []string
+	for _, scan := range scans {
+		result = append(result, fmt.Sprintf("%v:%v:%v", scan.Repo, scan.Skipped, scan.Err != nil))
+	}
+	expected := "repo::false,old:archived:false,new:empty:false,secret:access denied:false,fresh:empty:false,nocodeowner::true"
+	if strings.Join(result, ",") != expected {
+		t.Fatal("Repositories were classified incorrectly, got ", result)
+	}
+	if scans[0].Owners.String() != "** @juan" {
+		t.Fatal("Expected the CODEOWNERS to be read, got ", scans[0].Owners.String())
+	}
+}
+
+// replays the requests recorded in testdata/lastmodified, a request for a different query, eg without the ref the
+// file was read at, has no recording and fails
+func TestLastModified(t *testing.T) {
+	cl := github.NewClient(&http.Client{Transport: &replay.Replayer{Dir: "testdata/lastmodified"}})
+	co, err := NewService(cl).Get(context.TODO(), "example", "repo")
+	if err != nil {
+		t.Fatal("Expect to get no error; got ", err)
+	}
+	modified, err := co.LastModified(context.TODO())
+	if err != nil {
+		t.Fatal("Expect to get no error; got ", err)
+	}
+	if modified.SHA != "abc123" || modified.Author != "juan" || modified.Date.Year() != 2017 {
+		t.Fatalf("Expected the last commit got %v", modified)
+	}
+	co, err = NewService(cl).Get(context.TODO(), "example", "repo", WithRef("release"))
+	if err != nil {
+		t.Fatal("Expect to get no error; got ", err)
+	}
+	if modified, err := co.LastModified(context.TODO()); err != nil || modified.SHA != "def456" {
+		t.Fatalf("Expected the last commit on the release branch got %v %v", modified, err)
+	}
+}
+
+func TestAuditSink(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var lock sync.Mutex
+	var records []AuditRecord
+	sink := AuditSinkFunc(func(record AuditRecord) {
+		lock.Lock()
+		defer lock.Unlock()
+		records = append(records, record)
+	})
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan"))
+	co, _ := NewService(testclient).WithAuditSink(sink).Get(context.TODO(), "example", "repo")
+	co.Match(context.TODO(), "file.txt")
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 api calls to be recorded got %v", len(records))
+	}
+	if records[0].Operation != "Repositories.GetContents" || records[0].Repo != "example/repo" || records[0].Status != 200 || records[0].Method != "GET" {
+		t.Errorf("Expected the CODEOWNERS fetch got %v", records[0])
+	}
+	if records[1].Operation != "Users.Get" || records[1].Repo != "example/repo" || !strings.HasSuffix(records[1].URL, "/users/juan") {
+		t.Errorf("Expected the user lookup for the repository got %v", records[1])
+	}
+	records = nil
+	Get(context.TODO(), testclient, "example", "repo")
+	if len(records) != 0 {
+		t.Errorf("Expected only the service with the sink to be audited got %v", records)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	cases := map[string]Code{
+		"invalid-team":  CodeUnknownOwner,
+		"invalid-entry": CodeInvalidOwner,
+		"invalid-email": CodeInvalidOwner,
+		"invalid-login": CodeUnknownOwner,
+		"invalid-empty": CodeNoMatch,
+	}
+	for test, expected := range cases {
+		setup(t)
+		dat, _ := ioutil.ReadFile("../test/fixtures/CODEOWNERS/" + test)
+		mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder(string(dat)))
+		mux.HandleFunc("/users/invalid", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		})
+		owners, _ := Get(context.TODO(), testclient, "example", "repo")
+		_, errs := owners.Match(context.TODO(), "file.txt")
+		if len(errs) != 1 || CodeOf(errs[0]) != expected {
+			t.Errorf("Expected %v for %v got %v", expected, test, errs)
+		}
+		teardown()
+	}
+	setup(t)
+	defer teardown()
+	_, err := Get(context.TODO(), testclient, "example", "nocodeowner")
+	if CodeOf(err) != CodeNoCodeowners {
+		t.Errorf("Expected %v for a missing CODEOWNERS got %v", CodeNoCodeowners, CodeOf(err))
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	errs := ValidateBlob("* @juan\n!docs/ @joe", Snapshot{})
+	errs = append(errs, nomatch())
+	js, err := SARIF("CODEOWNERS", errs)
+	if err != nil {
+		t.Fatal("Expect to get no error; got ", err)
+	}
+	var log struct {
+		Runs []struct {
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Locations []struct {
+					PhysicalLocation struct {
+						Region *struct {
+							StartLine int `json:"startLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(js, &log); err != nil {
+		t.Fatal("Expect valid json; got ", err)
+	}
+	results := log.Runs[0].Results
+	if len(results) != 2 || results[0].RuleID != "CO004" || results[0].Locations[0].PhysicalLocation.Region.StartLine != 2 {
+		t.Fatalf("Expected the negation on line 2 got %s", js)
+	}
+	if results[1].RuleID != "CO010" || results[1].Locations[0].PhysicalLocation.Region != nil {
+		t.Fatalf("Expected no match without a line got %s", js)
+	}
+	wrapped := fmt.Errorf("reading the file: %w", &Error{Code: CodeMissingOwners, Message: "No owners", Line: 3, Severity: SeverityWarning})
+	if js, _ = SARIF("CODEOWNERS", []error{wrapped}); !strings.Contains(string(js), `"level":"warning"`) || !strings.Contains(string(js), `"startLine":3`) {
+		t.Errorf("Expected the line and severity of a wrapped error got %s", js)
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	patterns := parse("* @juan\ndocs/** @joe\n*.md @juan\nsrc/*.go @joe\nsrc/** @example/team\ndocs/api/** @juan\n**/test/** @joe\nsrc/main.go @joe\n/build/logs/ @juan\napps/ @joe")
+	paths := []string{"readme.md", "docs/readme.md", "docs/api/x.md", "src/main.go", "src/lib/x.go", "src/x.go", "src/test/x.go", "other/test/y", "docs", "build/logs/x", "src/apps/x.go"}
+	linear := CodeOwners{patterns: patterns, memo: &memo{rules: make(map[string]int)}}.WithMatcher(MatcherLinear)
+	indexed := CodeOwners{patterns: patterns, memo: &memo{rules: make(map[string]int)}}.WithMatcher(MatcherIndexed)
+	for _, path := range paths {
+		if linear.rule(path) != indexed.rule(path) {
+			t.Errorf("Matchers disagree on %v: %v and %v", path, linear.rule(path), indexed.rule(path))
+		}
+	}
+	if linear.memo.index != nil || indexed.memo.index == nil {
+		t.Errorf("Expected only the indexed matcher to build an index")
+	}
+	small := CodeOwners{patterns: patterns, memo: &memo{rules: make(map[string]int)}}
+	small.rule("src/main.go")
+	if small.memo.index != nil {
+		t.Errorf("Expected a small file to match linearly")
+	}
+	for idx := 0; idx < indexqueries; idx++ {
+		small.rule(fmt.Sprintf("src/%v.go", idx))
+	}
+	if small.memo.index == nil {
+		t.Errorf("Expected a busy file to switch to the index")
+	}
+}
+
+func TestAccessors(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan\ntest/** @joe @example/team"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	if co.Owner() != "example" || co.Repo() != "repo" {
+		t.Errorf("Expected example/repo got %v/%v", co.Owner(), co.Repo())
+	}
+	rules := co.Rules()
+	if len(rules) != 2 || rules[1].Pattern() != "test/**" || strings.Join(rules[1].Owners(), " ") != "@joe @example/team" {
+		t.Fatalf("Expected the rules of the file got %v", rules)
+	}
+	rules[1].Owners()[0] = "@changed"
+	rules[0] = CodeOwner{}
+	if co.String() != "** @juan\ntest/** @joe @example/team" {
+		t.Errorf("Expected the rules to be copies got %v", co.String())
+	}
+}
+
+func TestParse(t *testing.T) {
+	co, err := Parse(strings.NewReader("# comment\n* @juan\ndocs/** @joe juan@example.com\n"))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(co.Rules()) != 2 {
+		t.Fatalf("Expected 2 rules got %v", co.Rules())
+	}
+	if owners := co.OwnersOf("docs/readme.md"); strings.Join(owners, " ") != "@joe juan@example.com" {
+		t.Errorf("Expected the docs owners got %v", owners)
+	}
+	if owners := co.OwnersOf("main.go"); strings.Join(owners, " ") != "@juan" {
+		t.Errorf("Expected the default owner got %v", owners)
+	}
+	if owners := ParseString("docs/** @joe").OwnersOf("main.go"); owners != nil {
+		t.Errorf("Expected no owners got %v", owners)
+	}
+}
+
+func TestServicesAreIndependent(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan"))
+	other := http.NewServeMux()
+	other.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @joe"))
+	otherserver := httptest.NewServer(other)
+	defer otherserver.Close()
+	otherclient := github.NewClient(nil)
+	otherclient.BaseURL, _ = url.Parse(otherserver.URL + "/")
+	var wg sync.WaitGroup
+	for _, cl := range []*github.Client{testclient, otherclient, testclient, otherclient} {
+		wg.Add(1)
+		go func(cl *github.Client, expected string) {
+			defer wg.Done()
+			co, err := NewService(cl).Get(context.TODO(), "example", "repo")
+			if err != nil {
+				t.Errorf("Expected no error got %v", err)
+				return
+			}
+			if owners := co.OwnersOf("main.go"); len(owners) != 1 || owners[0] != expected {
+				t.Errorf("Expected %v got %v", expected, owners)
+			}
+		}(cl, map[*github.Client]string{testclient: "@juan", otherclient: "@joe"}[cl])
+	}
+	wg.Wait()
+}
+
+func TestParseWithClient(t *testing.T) {
+	setup(t)
+	defer teardown()
+	co := ParseString("* @juan")
+	if _, errs := co.Match(context.TODO(), "main.go"); len(errs) != 1 || CodeOf(errs[0]) != CodeAPI {
+		t.Errorf("Expected an error without a client got %v", errs)
+	}
+	users, errs := co.WithClient(testclient).Match(context.TODO(), "main.go")
+	if len(errs) != 0 || len(users) != 1 || users[0].GetLogin() != "juan" {
+		t.Errorf("Expected juan got %v %v", users, errs)
+	}
+	users, errs = ParseString("* me@example.com").Match(context.TODO(), "main.go")
+	if len(errs) != 0 || len(users) != 1 || users[0].GetEmail() != "me@example.com" {
+		t.Errorf("Expected an email owner without a client got %v %v", users, errs)
+	}
+}
+
+func TestParseWithoutClient(t *testing.T) {
+	co := ParseString("* @juan @org/team\n")
+	ctx := context.TODO()
+	calls := map[string]func() []error{
+		"AuditTwoFactor": func() []error {
+			_, errs := co.AuditTwoFactor(ctx)
+			return errs
+		},
+		"LastModified": func() []error {
+			_, err := co.LastModified(ctx)
+			return []error{err}
+		},
+		"FindUnowned": func() []error {
+			_, err := co.FindUnowned(ctx, "", CoverageOptions{})
+			return []error{err}
+		},
+		"Impact": func() []error {
+			_, err := co.Impact(ctx, "")
+			return []error{err}
+		},
+		"OwnershipMap": func() []error {
+			_, errs := co.OwnershipMap(ctx, "")
+			return errs
+		},
+		"IsApprovedByOwners": func() []error {
+			_, _, errs := co.IsApprovedByOwners(ctx, 1)
+			return errs
+		},
+		"ApprovalStatus": func() []error {
+			_, errs := co.ApprovalStatus(ctx, 1)
+			return errs
+		},
+		"UnmatchedRules": func() []error {
+			_, err := co.UnmatchedRules(ctx, "")
+			return []error{err}
+		},
+		"LintTree": func() []error {
+			_, err := co.LintTree(ctx, "", SeverityWarning)
+			return []error{err}
+		},
+		"OwnerStats": func() []error {
+			_, err := co.OwnerStats(ctx, "")
+			return []error{err}
+		},
+		"BusFactorDirs": func() []error {
+			_, errs := co.BusFactorDirs(ctx, "")
+			return errs
+		},
+		"ApprovalProgress": func() []error {
+			_, errs := co.ApprovalProgress(ctx, 1)
+			return errs
+		},
+	}
+	for name, call := range calls {
+		errs := call()
+		if len(errs) == 0 || CodeOf(errs[0]) != CodeAPI || !strings.HasPrefix(errs[0].Error(), "No github client") {
+			t.Errorf("Expected %v to fail without a client got %v", name, errs)
+		}
+	}
+}
+
+func TestGetOptions(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var requested []string
+	responder := fakeresponder("* @juan")
+	mux.HandleFunc("/repos/example/repo/contents/", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path+"@"+r.URL.Query().Get("ref"))
+		if r.URL.Path != "/repos/example/repo/contents/OWNERS" {
+			http.NotFound(w, r)
+			return
+		}
+		responder(w, r)
+	})
+	co, err := Get(context.TODO(), testclient, "example", "repo", WithRef("release-1.2"), WithLocations(".github", ""), WithFilename("OWNERS"))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	expected := "/repos/example/repo/contents/.github/OWNERS@release-1.2 /repos/example/repo/contents/OWNERS@release-1.2"
+	if strings.Join(requested, " ") != expected {
+		t.Errorf("Expected %v got %v", expected, requested)
+	}
+	if co.String() != "** @juan" {
+		t.Errorf("Expected the rules of OWNERS got %v", co.String())
+	}
+	requested = nil
+	if _, err := Get(context.TODO(), testclient, "example", "repo", WithLocations("docs/")); CodeOf(err) != CodeNoCodeowners {
+		t.Errorf("Expected no codeowners got %v", err)
+	}
+	if strings.Join(requested, " ") != "/repos/example/repo/contents/docs/CODEOWNERS@" {
+		t.Errorf("Expected only docs/ to be searched got %v", requested)
+	}
+}
+
+func TestSource(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/docs/CODEOWNERS", fakeresponder("* @juan"))
+	co, err := Get(context.TODO(), testclient, "example", "repo", WithRef("main"))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	expected := Source{
+		Path:    "docs/CODEOWNERS",
+		SHA:     "1234567890123456789012345678901234567890",
+		HTMLURL: "https://github.com/",
+		Ref:     "main",
+	}
+	if co.Source() != expected {
+		t.Errorf("Expected %v got %v", expected, co.Source())
+	}
+	if (ParseString("* @juan").Source() != Source{}) {
+		t.Errorf("Expected no source for parsed content")
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	cases := map[string]error{
+		"invalid-team":  ErrTeamNotFound,
+		"invalid-entry": ErrInvalidOwnerSpec,
+		"invalid-email": ErrInvalidOwnerSpec,
+		"invalid-login": ErrUserNotFound,
+		"invalid-empty": ErrNoMatch,
+	}
+	for test, expected := range cases {
+		setup(t)
+		dat, _ := ioutil.ReadFile("../test/fixtures/CODEOWNERS/" + test)
+		mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder(string(dat)))
+		mux.HandleFunc("/users/invalid", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		})
+		owners, _ := Get(context.TODO(), testclient, "example", "repo")
+		_, errs := owners.Match(context.TODO(), "file.txt")
+		if len(errs) != 1 || !errors.Is(errs[0], expected) {
+			t.Errorf("Expected %v for %v got %v", expected, test, errs)
+		}
+		var response *github.ErrorResponse
+		if test == "invalid-login" && !errors.As(errs[0], &response) {
+			t.Errorf("Expected the github error to be wrapped got %v", errs[0])
+		}
+		teardown()
+	}
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/limited/contents/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		http.Error(w, `{"message": "API rate limit exceeded"}`, http.StatusForbidden)
+	})
+	if _, err := Get(context.TODO(), testclient, "example", "nocodeowner"); !errors.Is(err, ErrNoCodeowners) || errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected %v got %v", ErrNoCodeowners, err)
+	}
+	if _, err := Get(context.TODO(), testclient, "example", "limited"); !errors.Is(err, ErrRateLimited) || errors.Is(err, ErrNoCodeowners) {
+		t.Errorf("Expected %v got %v", ErrRateLimited, err)
+	}
+}
+
+func TestMatchRule(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("# owners\n* @juan\n\ntest/** @joe\n"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	result, errs := co.MatchRule(context.TODO(), "test/file.txt")
+	if len(errs) != 0 {
+		t.Fatalf("Expected no errors got %v", errs)
+	}
+	if result.Rule.Pattern() != "test/**" || result.Rule.Line() != 4 {
+		t.Errorf("Expected test/** on line 4 got %v on line %v", result.Rule, result.Rule.Line())
+	}
+	if len(result.Users) != 1 || result.Users[0].GetLogin() != "joe" {
+		t.Errorf("Expected joe got %v", result.Users)
+	}
+	if rule, ok := co.RuleFor("main.go"); !ok || rule.Line() != 2 {
+		t.Errorf("Expected the rule on line 2 got %v", rule)
+	}
+	if _, errs := ParseString("docs/** @joe").MatchRule(context.TODO(), "main.go"); len(errs) != 1 || CodeOf(errs[0]) != CodeNoMatch {
+		t.Errorf("Expected no match got %v", errs)
+	}
+}
+
+func TestMatchOwners(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan @example/team juan@example.com no-at"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	owners, errs := co.MatchOwners(context.TODO(), "file.txt")
+	if len(errs) != 1 || !errors.Is(errs[0], ErrInvalidOwnerSpec) {
+		t.Errorf("Expected an invalid owner got %v", errs)
+	}
+	if len(owners) != 3 {
+		t.Fatalf("Expected 3 owners got %v", owners)
+	}
+	if user, ok := owners[0].(UserOwner); !ok || user.Login != "juan" {
+		t.Errorf("Expected the user juan got %#v", owners[0])
+	}
+	if team, ok := owners[1].(TeamOwner); !ok || team.Team.GetSlug() != "team" || team.Text() != "@example/team" {
+		t.Errorf("Expected the team got %#v", owners[1])
+	}
+	if email, ok := owners[2].(EmailOwner); !ok || email.Address != "juan@example.com" {
+		t.Errorf("Expected the email got %#v", owners[2])
+	}
+	users, errs := co.Expand(context.TODO(), owners[1])
+	if len(errs) != 0 || len(users) != 2 {
+		t.Errorf("Expected the team members got %v %v", users, errs)
+	}
+}
+
+func TestMatchLogins(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan @example/team juan@example.com"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	var operations []string
+	co = co.WithAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		operations = append(operations, record.Operation)
+		if record.Repo != "example/repo" {
+			t.Errorf("Expected %v to be made for example/repo got %q", record.Operation, record.Repo)
+		}
+	}))
+	logins, errs := co.MatchLogins(context.TODO(), "file.txt")
+	if len(errs) != 0 || len(operations) != 0 {
+		t.Fatalf("Expected no errors or api calls got %v %v", errs, operations)
+	}
+	if strings.Join(logins, " ") != "juan example/team juan@example.com" {
+		t.Errorf("Expected juan example/team juan@example.com got %v", logins)
+	}
+	logins, errs = co.WithMemberLogins().MatchLogins(context.TODO(), "file.txt")
+	if len(errs) != 0 {
+		t.Fatalf("Expected no errors got %v", errs)
+	}
+	if strings.Join(logins, " ") != "juan joe juan@example.com" {
+		t.Errorf("Expected juan joe juan@example.com got %v", logins)
+	}
+	for _, operation := range operations {
+		if operation == "Users.Get" {
+			t.Errorf("Expected no user lookups got %v", operations)
+		}
+	}
+	if _, errs := co.WithMemberLogins().WithMaxAPIRequests(1).MatchLogins(context.TODO(), "file.txt"); len(errs) != 1 || CodeOf(errs[0]) != CodeBudgetExceeded {
+		t.Errorf("Expected the team lookups to count towards the budget got %v", errs)
+	}
+}
+
+func TestMatchMany(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @juan\ntest/** @joe @example/team"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	var lock sync.Mutex
+	calls := make(map[string]int)
+	SetAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls[record.Operation]++
+	}))
+	defer SetAuditSink(nil)
+	results, errs := co.MatchMany(context.TODO(), []string{"main.go", "lib.go", "test/a.txt", "test/b.txt", "readme.md"})
+	if len(errs) != 0 {
+		t.Fatalf("Expected no errors got %v", errs)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 matched paths got %v", results)
+	}
+	if _, ok := results["readme.md"]; ok {
+		t.Errorf("Expected readme.md to be left out")
+	}
+	if result := results["test/b.txt"]; result.Rule.Line() != 2 || len(result.Users) != 2 {
+		t.Errorf("Expected joe and juan, once each, from line 2 got %v", result)
+	}
+	if calls["Organizations.ListTeams"] != 1 || calls["Organizations.ListTeamMembers"] != 1 {
+		t.Errorf("Expected the team to be resolved once got %v", calls)
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	// the examples from github's documentation of CODEOWNERS syntax
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.js", "app.js", true},
+		{"*.js", "src/lib/app.js", true},
+		{"*.js", "src/lib/app.jsx", false},
+		{"*.go", "cmd/main.go", true},
+		{"docs/*", "docs/getting-started.md", true},
+		{"docs/*", "docs/build-app/troubleshooting.md", false},
+		{"docs/*", "src/docs/getting-started.md", false},
+		{"**/logs", "logs/today.txt", true},
+		{"**/logs", "build/logs/today.txt", true},
+		{"**/logs", "deeply/nested/logs/a/b.txt", true},
+		{"**/logs", "build/logs.txt", false},
+		{"logs", "scripts/logs/today.txt", true},
+		{"logs", "logs", true},
+		{"logs", "catalogs/today.txt", false},
+		{"build/logs", "build/logs/today.txt", true},
+		{"build/logs", "src/build/logs/today.txt", false},
+		{"src/**", "src/a/b/c.go", true},
+		{"**", "anything/at/all", true},
+		{"apps/", "apps/web/index.js", true},
+		{"apps/", "services/apps/web/index.js", true},
+		{"apps/", "apps", false},
+		{"apps/", "myapps/index.js", false},
+		{"/build/logs/", "build/logs/today.txt", true},
+		{"/build/logs/", "build/logs/archive/2017.txt", true},
+		{"/build/logs/", "src/build/logs/today.txt", false},
+		{"/build/logs/", "build/logs", false},
+		{"/scripts/", "scripts/deploy.sh", true},
+		{"docs/*/", "docs/api/readme.md", true},
+		{"docs/*/", "docs/readme.md", false},
+	}
+	for _, c := range cases {
+		if matchpattern(c.pattern, c.path, AnchorGitignore) != c.match {
+			t.Errorf("Expected %v matching %v to be %v", c.pattern, c.path, c.match)
+		}
+	}
+}
+
+func TestAnchoring(t *testing.T) {
+	cases := []struct {
+		pattern   string
+		path      string
+		gitignore bool
+		leading   bool
+	}{
+		{"/docs/*.md", "docs/readme.md", true, true},
+		{"/docs/*.md", "src/docs/readme.md", false, false},
+		{"/docs/*.md", "docs/api/readme.md", false, false},
+		{"docs/*.md", "docs/readme.md", true, true},
+		{"docs/*.md", "src/docs/readme.md", false, true},
+		{"docs/*.md", "src/docs/api/readme.md", false, false},
+		{"build/logs/", "src/build/logs/today.txt", false, true},
+		{"/build/logs/", "src/build/logs/today.txt", false, false},
+		{"*.md", "src/readme.md", true, true},
+	}
+	for _, c := range cases {
+		if matchpattern(c.pattern, c.path, AnchorGitignore) != c.gitignore {
+			t.Errorf("Expected %v matching %v to be %v with gitignore anchoring", c.pattern, c.path, c.gitignore)
+		}
+		if matchpattern(c.pattern, c.path, AnchorLeadingSlash) != c.leading {
+			t.Errorf("Expected %v matching %v to be %v with leading slash anchoring", c.pattern, c.path, c.leading)
+		}
+	}
+	co := ParseString("* @juan\ndocs/*.md @joe")
+	if owners := co.OwnersOf("src/docs/readme.md"); owners[0] != "@juan" {
+		t.Errorf("Expected @juan got %v", owners)
+	}
+	if owners := co.WithAnchoring(AnchorLeadingSlash).WithMatcher(MatcherIndexed).OwnersOf("src/docs/readme.md"); owners[0] != "@joe" {
+		t.Errorf("Expected @joe got %v", owners)
+	}
+}
+
+func TestNegation(t *testing.T) {
+	co := ParseString("* @juan\n!*.md @joe")
+	if owners := co.OwnersOf("main.go"); owners[0] != "@juan" {
+		t.Errorf("Expected negation to be ignored got %v", owners)
+	}
+	extended := co.WithNegation(NegationExtension)
+	if owners := extended.OwnersOf("main.go"); owners[0] != "@joe" {
+		t.Errorf("Expected the negated rule to own main.go got %v", owners)
+	}
+	if owners := extended.WithMatcher(MatcherIndexed).OwnersOf("readme.md"); owners[0] != "@juan" {
+		t.Errorf("Expected the negated rule to skip readme.md got %v", owners)
+	}
+	errs := ValidateBlob("* @juan\n!*.md @joe", Snapshot{})
+	if len(errs) != 1 || CodeOf(errs[0]) != CodeNegation || errs[0].(*Error).Line != 2 {
+		t.Errorf("Expected negation to be reported on line 2 got %v", errs)
+	}
+}
+
+func TestOwnerlessRules(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("/apps/ @juan\n/apps/github\n"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	if len(co.Rules()) != 2 || co.String() != "/apps/ @juan\n/apps/github" {
+		t.Fatalf("Expected the ownerless rule to be kept got %v", co.Rules())
+	}
+	if users, errs := co.Match(context.TODO(), "apps/web/index.js"); len(errs) != 0 || len(users) != 1 {
+		t.Errorf("Expected juan to own apps/web got %v %v", users, errs)
+	}
+	users, errs := co.Match(context.TODO(), "apps/github/index.js")
+	if len(users) != 0 || len(errs) != 1 || !errors.Is(errs[0], ErrUnowned) || errs[0].(*Error).Line != 2 {
+		t.Errorf("Expected apps/github to be unowned by line 2 got %v %v", users, errs)
+	}
+	if owners := co.OwnersOf("apps/github/index.js"); owners == nil || len(owners) != 0 {
+		t.Errorf("Expected an empty set of owners got %#v", owners)
+	}
+	if unowned := co.unowned([]string{"apps/web/index.js", "apps/github/index.js", "readme.md"}, nil); strings.Join(unowned, " ") != "apps/github/index.js readme.md" {
+		t.Errorf("Expected apps/github and readme.md to be unowned got %v", unowned)
+	}
+	notify := ParseString("* @juan\ndocs/** @joe\ndocs/generated/")
+	notify.notify = true
+	if owners := notify.OwnersOf("docs/generated/api.md"); owners == nil || len(owners) != 0 {
+		t.Errorf("Expected the ownerless rule to clear notifications got %v", owners)
+	}
+}
+
+func TestInlineComments(t *testing.T) {
+	co := ParseString("# owners\n/src @org/backend  # primary service owners\n/docs/\\#1 @juan #\n/lib @joe#notacomment")
+	rules := co.Rules()
+	if len(rules) != 3 {
+		t.Fatalf("Expected 3 rules got %v", rules)
+	}
+	if strings.Join(rules[0].Owners(), " ") != "@org/backend" || rules[0].Comment() != "primary service owners" {
+		t.Errorf("Expected the comment to be split from the owners got %v and %q", rules[0].Owners(), rules[0].Comment())
+	}
+	if rules[1].Pattern() != "/docs/\\#1" || strings.Join(rules[1].Owners(), " ") != "@juan" || rules[1].Comment() != "" {
+		t.Errorf("Expected an escaped # to stay in the pattern got %v", rules[1])
+	}
+	if strings.Join(rules[2].Owners(), " ") != "@joe#notacomment" {
+		t.Errorf("Expected a # inside a word to be kept got %v", rules[2])
+	}
+	if errs := ValidateBlob("/src @org/backend  # primary service owners", Snapshot{}); len(errs) != 0 {
+		t.Errorf("Expected the comment to be ignored got %v", errs)
+	}
+}
+
+func TestWindowsLineEndings(t *testing.T) {
+	for _, content := range []string{"* @juan\r\ndocs/** @joe\r\n", "\ufeff* @juan\ndocs/** @joe\n", "\ufeff* @juan\r\ndocs/** @joe"} {
+		co := ParseString(content)
+		if co.String() != "** @juan\ndocs/** @joe" {
+			t.Errorf("Expected clean rules from %q got %q", content, co.String())
+		}
+		if owners := co.OwnersOf("docs/readme.md"); len(owners) != 1 || owners[0] != "@joe" {
+			t.Errorf("Expected @joe from %q got %q", content, owners)
+		}
+		if errs := ValidateBlob(content, Snapshot{Users: map[string]bool{"juan": true, "joe": true}}); len(errs) != 0 {
+			t.Errorf("Expected %q to validate got %v", content, errs)
+		}
+	}
+}
+
+func TestShadowedRules(t *testing.T) {
+	co := ParseString("src/api/ @juan\n*.js @joe\ndocs/*.md @juan\nlib/ @joe\n*.md @joe\nsrc/ @example/team\nlib/sub/ @juan\ndocs/*.txt @joe\n[ab].go @joe\n** @juan\n")
+	var result []string
+	for _, shadow := range co.ShadowedRules() {
+		result = append(result, fmt.Sprintf("%v:%v>%v:%v", shadow.Rule.Line(), shadow.Rule.Pattern(), shadow.By.Line(), shadow.By.Pattern()))
+	}
+	expected := "1:src/api/>6:src/,2:*.js>10:**,3:docs/*.md>5:*.md,4:lib/>10:**,5:*.md>10:**,6:src/>10:**,7:lib/sub/>10:**,8:docs/*.txt>10:**"
+	if strings.Join(result, ",") != expected {
+		t.Errorf("Expected %v got %v", expected, result)
+	}
+	if shadows := ParseString("src/ @juan\nsrc/api/ @joe\n*.js @joe\nsrc/** @juan\ndocs/*.md @joe\ndocs/*.txt @juan").ShadowedRules(); len(shadows) != 1 || shadows[0].Rule.Line() != 2 {
+		t.Errorf("Expected only src/api/ to be shadowed by src/** got %v", shadows)
+	}
+	if shadows := ParseString("*.js @juan\n[sz]*.js @joe\n").ShadowedRules(); len(shadows) != 0 {
+		t.Errorf("Expected *.js not to be shadowed by [sz]*.js got %v", shadows)
+	}
+	co = ParseString("*.js @juan\ns*.js @joe\nlib/*_test.go @juan\nlib/*.go @joe\nsrc/foo*.c @juan\nsrc/f* @joe\n/docs/ @juan\ndocs/ @joe\n")
+	result = nil
+	for _, shadow := range co.ShadowedRules() {
+		result = append(result, fmt.Sprintf("%v>%v", shadow.Rule.Line(), shadow.By.Line()))
+	}
+	if expected := "3>4,5>6,7>8"; strings.Join(result, ",") != expected {
+		t.Errorf("Expected %v got %v", expected, result)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	content := "\ufeff\r\n# Owners of the repo\r\n*     @juan   # everyone\r\n\r\n\r\n  #docs\r\ndocs/** @joe @example/team\r\n/build/logs/\t@juan\r\n\r\n"
+	co := ParseString(content)
+	var buf bytes.Buffer
+	if _, err := co.WriteTo(&buf); err != nil || buf.String() != content {
+		t.Errorf("Expected the file back unchanged got %q", buf.String())
+	}
+	expected := "# Owners of the repo\n* @juan # everyone\n\n#docs\ndocs/**      @joe @example/team\n/build/logs/ @juan\n"
+	if formatted := co.Format(); formatted != expected {
+		t.Errorf("Expected %q got %q", expected, formatted)
+	}
+	if formatted := ParseString(expected).Format(); formatted != expected {
+		t.Errorf("Expected formatting to be stable got %q", formatted)
+	}
+	buf.Reset()
+	if (CodeOwners{patterns: parse("* @juan")}).WriteTo(&buf); buf.String() != "** @juan" {
+		t.Errorf("Expected the String form got %q", buf.String())
+	}
+}
+
+func TestEditing(t *testing.T) {
+	content := "# owners\n*       @alice  # everyone\n/docs/  @Alice @joe\n/infra/** @joe\n/old/ @alice\n"
+	co := ParseString(content)
+	edited := co.RenameOwner("@alice", "@example/platform")
+	var buf bytes.Buffer
+	edited.WriteTo(&buf)
+	expected := "# owners\n*       @example/platform  # everyone\n/docs/  @example/platform @joe\n/infra/** @joe\n/old/ @example/platform\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q got %q", expected, buf.String())
+	}
+	if co.OwnersOf("docs/readme.md")[0] != "@Alice" {
+		t.Errorf("Expected the original to be unchanged")
+	}
+	if owners := edited.OwnersOf("docs/readme.md"); strings.Join(owners, " ") != "@example/platform @joe" {
+		t.Errorf("Expected the renamed owners got %v", owners)
+	}
+	buf.Reset()
+	co.RemoveOwner("@alice").AddOwner("/infra/**", "@example/security").AddRule("/new/", "@joe").WriteTo(&buf)
+	expected = "# owners\n/docs/  @joe\n/infra/** @joe @example/security\n/new/ @joe\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q got %q", expected, buf.String())
+	}
+	removed := co.RemoveOwner("@alice")
+	if rules := removed.Rules(); len(rules) != 2 || rules[1].Pattern() != "/infra/**" || rules[1].Line() != 3 {
+		t.Errorf("Expected the emptied rules to be removed got %v", rules)
+	}
+	if owners := removed.OwnersOf("old/file"); owners != nil {
+		t.Errorf("Expected old/ to be unmatched got %v", owners)
+	}
+	if owners := co.RenameOwner("@joe", "@alice").OwnersOf("docs/x"); strings.Join(owners, " ") != "@Alice" {
+		t.Errorf("Expected a rename onto an existing owner to merge got %v", owners)
+	}
+}
+
+func TestSave(t *testing.T) {
+	setup(t)
+	defer teardown()
+	responder := fakeresponder("* @alice\n")
+	var saved map[string]interface{}
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			json.NewDecoder(r.Body).Decode(&saved)
+			fmt.Fprint(w, `{"content": {"sha": "abcdef"}, "commit": {"sha": "c0ffee"}}`)
+			return
+		}
+		responder(w, r)
+	})
+	mux.HandleFunc("/repos/example/repo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch": "main"}`)
+	})
+	mux.HandleFunc("/repos/example/repo/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "main", "commit": {"sha": "base123"}}`)
+	})
+	mux.HandleFunc("/repos/example/repo/branches/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Branch not found"}`, http.StatusNotFound)
+	})
+	var created map[string]interface{}
+	mux.HandleFunc("/repos/example/repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&created)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/example/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 5}`)
+	})
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	result, err := co.RenameOwner("@alice", "@joe").Save(context.TODO(), SaveOptions{
+		Branch:      "codeowners-update",
+		PullRequest: &PullRequestOptions{Title: "Hand over to joe"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if created["ref"] != "refs/heads/codeowners-update" || created["sha"] != "base123" {
+		t.Errorf("Expected the branch to be created from main got %v", created)
+	}
+	if saved["branch"] != "codeowners-update" || saved["sha"] != "1234567890123456789012345678901234567890" || saved["message"] != "Update CODEOWNERS" {
+		t.Errorf("Expected an update of the read file got %v", saved)
+	}
+	if content, _ := base64.StdEncoding.DecodeString(saved["content"].(string)); string(content) != "* @joe\n" {
+		t.Errorf("Expected the edited file got %q", content)
+	}
+	if result.Commit != "c0ffee" || result.Source.SHA != "abcdef" || result.Source.Ref != "codeowners-update" || result.PullRequest.GetNumber() != 5 {
+		t.Errorf("Expected the commit and pull request got %v", result)
+	}
+	co.source.SHA = "stale"
+	if _, err := co.Save(context.TODO(), SaveOptions{}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected a conflict got %v", err)
+	}
+	if _, err := ParseString("* @joe").Save(context.TODO(), SaveOptions{}); err == nil {
+		t.Errorf("Expected parsed content to be refused")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	co := ParseString("# owners\n* @juan\ndocs/\nsrc/[a  no-at @ok\n!test/** @joe")
+	var result []string
+	for _, diagnostic := range co.Validate() {
+		result = append(result, fmt.Sprintf("%v:%v:%v:%v", diagnostic.Line, diagnostic.Column, diagnostic.Code, diagnostic.Severity))
+	}
+	expected := "3:1:CO003:warning,4:1:CO005:,4:9:CO002:,5:1:CO004:"
+	if strings.Join(result, ",") != expected {
+		t.Fatal("Validate reported the wrong diagnostics, got ", result)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	aliases, err := ParseAliases(strings.NewReader("# groups\naliases:\n  sig-docs:\n    - alice\n    - bob # lead\n  Sig-API: [carol, \"dan\"]\n"))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if fmt.Sprint(aliases) != "map[sig-api:[carol dan] sig-docs:[alice bob]]" {
+		t.Errorf("Expected the aliases to be read got %v", aliases)
+	}
+	co := ParseString("* @sig-docs @alice\napi/ @sig-api @example/team\nvendor/").WithAliases(aliases)
+	cases := map[string]string{
+		"readme.md": "[@alice @bob]",
+		"api/x.go":  "[@carol @dan @example/team]",
+		"vendor/x":  "[]",
+	}
+	for path, expected := range cases {
+		if owners := fmt.Sprint(co.OwnersOf(path)); owners != expected {
+			t.Errorf("Expected %v to be owned by %v got %v", path, expected, owners)
+		}
+	}
+	if _, err := ParseAliases(strings.NewReader("aliases:\n  bad")); CodeOf(err) != CodeInvalidAliases {
+		t.Errorf("Expected an invalid aliases error got %v", err)
+	}
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @sig-docs"))
+	mux.HandleFunc("/repos/example/repo/contents/OWNERS_ALIASES", fakeresponder("aliases:\n  sig-docs:\n  - erin\n"))
+	fetched, err := Get(context.TODO(), testclient, "example", "repo", WithAliasesFile("OWNERS_ALIASES"))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if owners := fmt.Sprint(fetched.OwnersOf("x")); owners != "[@erin]" {
+		t.Errorf("Expected the fetched aliases to be used got %v", owners)
+	}
+	if _, err := Get(context.TODO(), testclient, "example", "repo", WithAliasesFile("missing")); CodeOf(err) != CodeNotFound {
+		t.Errorf("Expected a missing aliases file to fail got %v", err)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	files := map[string]string{
+		"teams/backend.CODEOWNERS":  "api/ @example/backend\n#!include teams/database.CODEOWNERS\n",
+		"teams/database.CODEOWNERS": "db/ @example/dba",
+		"teams/loop.CODEOWNERS":     "#!include teams/loop.CODEOWNERS",
+	}
+	load := func(path string) (string, error) {
+		content, ok := files[path]
+		if !ok {
+			return "", errors.New("no such file")
+		}
+		return content, nil
+	}
+	co, err := ParseString("* @alice\n#!include teams/backend.CODEOWNERS\ndb/legacy/ @bob").Include(load)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	var rules []string
+	for _, rule := range co.Rules() {
+		rules = append(rules, fmt.Sprintf("%v:%v %v", rule.File(), rule.Line(), rule.Pattern()))
+	}
+	if expected := ":1 **,teams/backend.CODEOWNERS:1 api/,teams/database.CODEOWNERS:1 db/,:3 db/legacy/"; strings.Join(rules, ",") != expected {
+		t.Errorf("Expected %v got %v", expected, rules)
+	}
+	if owners := fmt.Sprint(co.OwnersOf("db/legacy/x.sql"), co.OwnersOf("db/x.sql")); owners != "[@bob] [@example/dba]" {
+		t.Errorf("Expected the included rules to take their place got %v", owners)
+	}
+	if edited := co.RenameOwner("@example/dba", "@carol").RemoveOwner("@bob"); edited.String() != "** @alice\napi/ @example/backend\ndb/ @example/dba" {
+		t.Errorf("Expected edits to leave included rules alone got %q", edited.String())
+	}
+	if _, err := ParseString("#!include teams/loop.CODEOWNERS").Include(load); CodeOf(err) != CodeInvalidInclude {
+		t.Errorf("Expected a loop to be reported got %v", err)
+	}
+	if _, err := ParseString("* @alice\n#!include missing").Include(load); CodeOf(err) != CodeInvalidInclude || err.(*Error).Line != 2 {
+		t.Errorf("Expected a missing file to be reported got %v", err)
+	}
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("#!include /teams/docs.CODEOWNERS\n"))
+	mux.HandleFunc("/repos/example/repo/contents/teams/docs.CODEOWNERS", fakeresponder("docs/ @example/writers"))
+	fetched, err := Get(context.TODO(), testclient, "example", "repo", WithIncludes())
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if owners := fmt.Sprint(fetched.OwnersOf("docs/index.md")); owners != "[@example/writers]" {
+		t.Errorf("Expected the included rules to be fetched got %v", owners)
+	}
+}
+
+func TestSections(t *testing.T) {
+	content := "* @alice\n\n[Documentation] @example/writers\ndocs/\n*.md @bob\n\n^[Optional Review][2] @carol # extra eyes\n*.go\n\n[documentation]\nREADME.md @dan\n"
+	plain := ParseString(content)
+	if owners := fmt.Sprint(plain.OwnersOf("docs/guide.md")); owners != "[@bob]" {
+		t.Errorf("Expected github to only use the last rule got %v", owners)
+	}
+	co := plain.WithSections(SectionsGitLab)
+	cases := map[string]string{
+		"main.go":        "[@alice @carol]",
+		"docs/guide.txt": "[@alice @example/writers]",
+		"docs/guide.md":  "[@alice @bob]",
+		"README.md":      "[@alice @dan]",
+	}
+	for path, expected := range cases {
+		if owners := fmt.Sprint(co.OwnersOf(path)); owners != expected {
+			t.Errorf("Expected %v to be owned by %v got %v", path, expected, owners)
+		}
+	}
+	if len(co.Rules()) != 5 {
+		t.Errorf("Expected the headers to be taken out of the rules got %v", co.Rules())
+	}
+	section := co.Rules()[3].Section()
+	if section.Name != "Optional Review" || !section.Optional || section.Approvals != 2 || fmt.Sprint(section.Owners) != "[@carol]" || section.Line != 7 {
+		t.Errorf("Expected the optional section got %+v", section)
+	}
+	if diagnostics := co.Validate(); len(diagnostics) != 2 {
+		t.Errorf("Expected only the rules without owners to be warned about got %v", diagnostics)
+	}
+	if rule := co.AddRule("api/", "@erin").Rules()[5]; rule.Section().Name != "documentation" {
+		t.Errorf("Expected a new rule to join the last section got %+v", rule.Section())
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	co := ParseString("# escalation: team-a\n\n# Backend services\n# Escalation: pagerduty-backend\n# sla: 24h\napi/ @example/backend # tier: 1\n# sla: 48h\ndocs/ @example/writers\n*.md @bob\n")
+	var result []string
+	for _, rule := range co.Rules() {
+		result = append(result, fmt.Sprint(rule.Annotations()))
+	}
+	if expected := "map[escalation:pagerduty-backend sla:24h tier:1],map[sla:48h],map[]"; strings.Join(result, ",") != expected {
+		t.Errorf("Expected %v got %v", expected, result)
+	}
+	rule, _ := co.RuleFor("api/main.go")
+	rule.Annotations()["sla"] = "changed"
+	if rule.Annotations()["sla"] != "24h" {
+		t.Errorf("Expected the annotations to be copied")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	org := ParseString("* @example/engineering\ndocs/ @example/writers\n/.github/ @example/security")
+	repo := ParseString("# ours\napi/ @alice\ndocs/** @bob\n.github/ @example/security")
+	merged, conflicts := Merge(MergeOptions{}, org, repo)
+	if expected := "** @example/engineering\ndocs/ @example/writers\n/.github/ @example/security\napi/ @alice\ndocs/** @bob\n.github/ @example/security"; merged.String() != expected {
+		t.Errorf("Expected the repository rules last got %q", merged.String())
+	}
+	if owners := fmt.Sprint(merged.OwnersOf("docs/index.md")); owners != "[@bob]" {
+		t.Errorf("Expected the repository to win got %v", owners)
+	}
+	// docs/ also owns docs directories deeper in the tree, which docs/** does not, so the two don't conflict
+	if owners := fmt.Sprint(merged.OwnersOf("guides/docs/index.md")); owners != "[@example/writers]" || len(conflicts) != 0 {
+		t.Errorf("Expected docs/ and docs/** to be different rules got %v %+v", owners, conflicts)
+	}
+	org = ParseString("* @example/engineering\n/docs/ @example/writers\n/.github/ @example/security")
+	merged, conflicts = Merge(MergeOptions{}, org, repo)
+	if owners := fmt.Sprint(merged.OwnersOf("docs/index.md")); owners != "[@bob]" {
+		t.Errorf("Expected the repository to win got %v", owners)
+	}
+	if len(conflicts) != 1 || conflicts[0].Pattern != "/docs/" || fmt.Sprint(conflicts[0].Documents) != "[0 1]" || conflicts[0].Winner().Line() != 3 {
+		t.Errorf("Expected a single conflict over docs got %+v", conflicts)
+	}
+	first, conflicts := Merge(MergeOptions{Precedence: MergeFirstWins, Deduplicate: true}, org, repo)
+	if expected := "api/ @alice\n.github/ @example/security\n** @example/engineering\n/docs/ @example/writers\n/.github/ @example/security"; first.String() != expected {
+		t.Errorf("Expected the org rules last without duplicates got %q", first.String())
+	}
+	if len(conflicts) != 1 || fmt.Sprint(conflicts[0].Documents) != "[1 0]" || fmt.Sprint(conflicts[0].Winner().Owners()) != "[@example/writers]" {
+		t.Errorf("Expected the org to win the conflict got %+v", conflicts)
+	}
+	var written bytes.Buffer
+	if first.WriteTo(&written); written.String() != first.String() {
+		t.Errorf("Expected the merged rules to be written got %q", written.String())
+	}
+}
+
+func TestLint(t *testing.T) {
+	co := ParseString("# owners\n*.md @bob\ndocs/ @alice\n/api/ @example/backend\napi/** @example/backend\nsrc/api/ @carol\n**/docs/** @dan\nsrc/ @erin\n*.md @Bob\n")
+	if duplicates := co.Duplicates(); len(duplicates) != 2 || duplicates[0].Pattern != "*.md" || duplicates[1].Rules[1].Line() != 5 {
+		t.Errorf("Expected *.md and /api/ to be duplicates got %+v", duplicates)
+	}
+	if conflicts := co.Conflicts(); len(conflicts) != 1 || fmt.Sprint(conflicts[0].Lines) != "[3 7]" {
+		t.Errorf("Expected docs/ to conflict got %+v", conflicts)
+	}
+	var result []string
+	for _, warning := range co.Lint() {
+		result = append(result, fmt.Sprintf("%v:%v", warning.Line, warning.Code))
+	}
+	if expected := "2:CO040,3:CO041,4:CO040,6:CO042"; strings.Join(result, ",") != expected {
+		t.Errorf("Expected %v got %v", expected, result)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	setup(t)
+	defer teardown()
+	paged := func(pages ...string) func(http.ResponseWriter, *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if page == 0 {
+				page = 1
+			}
+			if r.URL.Query().Get("per_page") != "100" {
+				t.Errorf("Expected full pages to be asked for got %v", r.URL.RawQuery)
+			}
+			if page < len(pages) {
+				w.Header().Set("Link", fmt.Sprintf(`<%v%v?page=%v>; rel="next"`, server.URL, r.URL.Path, page+1))
+			}
+			fmt.Fprint(w, pages[page-1])
+		}
+	}
+	mux.HandleFunc("/orgs/paged/teams", paged(`[{"id": 1, "slug": "other"}]`, `[{"id": 9, "slug": "team"}]`))
+	mux.HandleFunc("/teams/9/members", paged(`[{"login": "ana"}, {"login": "ben"}]`, `[{"login": "cy"}]`, `[{"login": "di"}]`))
+	logins, errs := ParseString("* @paged/team").WithClient(testclient).WithMemberLogins().MatchLogins(context.TODO(), "file.txt")
+	if len(errs) != 0 {
+		t.Fatalf("Expected no errors got %v", errs)
+	}
+	if strings.Join(logins, " ") != "ana ben cy di" {
+		t.Errorf("Expected every page of members got %v", logins)
+	}
+}
+
+func TestChildTeams(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/orgs/nested/teams", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 1, "slug": "eng"}, {"id": 2, "slug": "platform", "parent": {"id": 1}},
+			{"id": 3, "slug": "infra", "parent": {"id": 2}}, {"id": 4, "slug": "loop", "parent": {"id": 5}},
+			{"id": 5, "slug": "back", "parent": {"id": 4}}, {"id": 6, "slug": "sales"}]`)
+	})
+	members := map[string]string{"1": `[{"login": "ana"}]`, "2": `[{"login": "ben"}, {"login": "ana"}]`, "3": `[{"login": "cy"}]`, "4": `[{"login": "di"}]`, "5": `[{"login": "ed"}]`}
+	mux.HandleFunc("/teams/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, members[strings.Split(r.URL.Path, "/")[2]])
+	})
+	co := ParseString("* @nested/eng\nloop/ @nested/loop").WithClient(testclient).WithMemberLogins()
+	cases := map[string]string{"file.txt": "ana", "loop/x": "di"}
+	for path, direct := range cases {
+		if logins, _ := co.MatchLogins(context.TODO(), path); strings.Join(logins, " ") != direct {
+			t.Errorf("Expected only direct members of %v got %v", path, logins)
+		}
+	}
+	co = co.WithChildTeams()
+	cases = map[string]string{"file.txt": "ana ben cy", "loop/x": "di ed"}
+	for path, expected := range cases {
+		logins, errs := co.MatchLogins(context.TODO(), path)
+		if len(errs) != 0 || strings.Join(logins, " ") != expected {
+			t.Errorf("Expected %v for %v got %v %v", expected, path, logins, errs)
+		}
+	}
+}
+
+func TestTeamRole(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var roles []string
+	mux.HandleFunc("/orgs/roles/teams", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 7, "slug": "team"}]`)
+	})
+	mux.HandleFunc("/teams/7/members", func(w http.ResponseWriter, r *http.Request) {
+		roles = append(roles, r.URL.Query().Get("role"))
+		if r.URL.Query().Get("role") == "maintainer" {
+			fmt.Fprint(w, `[{"login": "juan"}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"login": "juan"}, {"login": "joe"}]`)
+	})
+	co := ParseString("* @roles/team").WithClient(testclient).WithMemberLogins()
+	all, _ := co.MatchLogins(context.TODO(), "file.txt")
+	maintainers, errs := co.WithTeamRole(TeamRoleMaintainer).MatchLogins(context.TODO(), "file.txt")
+	if len(errs) != 0 || strings.Join(all, " ") != "juan joe" || strings.Join(maintainers, " ") != "juan" {
+		t.Errorf("Expected only the maintainers got %v from %v %v", maintainers, all, errs)
+	}
+	if strings.Join(roles, ",") != ",maintainer" {
+		t.Errorf("Expected the role to be asked for got %v", roles)
+	}
+}
+
+func TestCache(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan @example/team"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	co = co.WithCache(NewMemoryCache(), time.Minute)
+	var lock sync.Mutex
+	var calls []string
+	SetAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls = append(calls, record.Operation)
+	}))
+	defer SetAuditSink(nil)
+	first, errs := co.Match(context.TODO(), "file.txt")
+	if len(errs) != 0 || len(first) != 2 || len(calls) == 0 {
+		t.Fatalf("Expected the owners to be looked up got %v %v %v", first, errs, calls)
+	}
+	calls = nil
+	second, errs := co.Match(context.TODO(), "other.txt")
+	if len(errs) != 0 || len(second) != 2 || len(calls) != 0 {
+		t.Errorf("Expected the owners to come from the cache got %v %v %v", second, errs, calls)
+	}
+	logins := func(users []*github.User) string {
+		var names []string
+		for _, user := range users {
+			names = append(names, user.GetLogin()+"/"+user.GetName())
+		}
+		sort.Strings(names)
+		return strings.Join(names, " ")
+	}
+	if logins(first) != logins(second) {
+		t.Errorf("Expected the cached users to be whole got %v", logins(second))
+	}
+	cache := NewMemoryCache()
+	cache.Set("gone", []byte("1"), -time.Second)
+	if _, ok := cache.Get("gone"); ok {
+		t.Errorf("Expected an expired entry to be dropped")
+	}
+}
+
+func TestConcurrentLookupsAreShared(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var lock sync.Mutex
+	requests := make(map[string]int)
+	count := func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.URL.Path]++
+		lock.Unlock()
+		time.Sleep(50 * time.Millisecond)
+	}
+	mux.HandleFunc("/users/slow", func(w http.ResponseWriter, r *http.Request) {
+		count(w, r)
+		fmt.Fprint(w, `{"login": "slow"}`)
+	})
+	mux.HandleFunc("/orgs/shared/teams", func(w http.ResponseWriter, r *http.Request) {
+		count(w, r)
+		fmt.Fprint(w, `[{"id": 8, "slug": "team"}]`)
+	})
+	mux.HandleFunc("/teams/8/members", func(w http.ResponseWriter, r *http.Request) {
+		count(w, r)
+		fmt.Fprint(w, `[{"login": "member"}]`)
+	})
+	mux.HandleFunc("/users/member", func(w http.ResponseWriter, r *http.Request) {
+		count(w, r)
+		fmt.Fprint(w, `{"login": "member"}`)
+	})
+	co := ParseString("").WithClient(testclient)
+	users, errs := co.Expand(context.TODO(), UserOwner{Owner: "@slow", Login: "slow"}, UserOwner{Owner: "@slow", Login: "slow"}, TeamOwner{Owner: "@shared/team"}, TeamOwner{Owner: "@shared/team"})
+	if len(errs) != 0 || len(users) != 4 {
+		t.Fatalf("Expected every owner to be expanded got %v %v", users, errs)
+	}
+	for path, times := range requests {
+		if times != 1 {
+			t.Errorf("Expected %v to be fetched once got %v", path, times)
+		}
+	}
+}
+
+func TestExpansionsAreRemembered(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @juan @example/team\n*.md @joe"))
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	var lock sync.Mutex
+	calls := 0
+	SetAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+	}))
+	defer SetAuditSink(nil)
+	if users, errs := co.Match(context.TODO(), "main.go"); len(users) != 2 || len(errs) != 0 || calls == 0 {
+		t.Fatalf("Expected the owners to be looked up got %v %v", users, errs)
+	}
+	calls = 0
+	if users, errs := co.Match(context.TODO(), "other.go"); len(users) != 2 || len(errs) != 0 || calls != 0 {
+		t.Errorf("Expected the remembered owners got %v %v after %v calls", users, errs, calls)
+	}
+	if users, _ := co.Match(context.TODO(), "readme.md"); len(users) != 1 || calls != 1 {
+		t.Errorf("Expected only the new owner to be looked up got %v after %v calls", users, calls)
+	}
+	co.Refresh()
+	calls = 0
+	if users, _ := co.Match(context.TODO(), "main.go"); len(users) != 2 || calls == 0 {
+		t.Errorf("Expected Refresh to look the owners up again got %v after %v calls", users, calls)
+	}
+}
+
+func TestMatchLazy(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan @example/team joe@example.com no-at\nshared/** @example/team @other/crew"))
+	mux.HandleFunc("/orgs/other/teams", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 73, "slug": "crew"}]`)
+	})
+	mux.HandleFunc("/teams/73/members", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"login": "joe"}]`)
+	})
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	var lock sync.Mutex
+	calls := 0
+	SetAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+	}))
+	defer SetAuditSink(nil)
+	lazy, err := co.MatchLazy("main.go")
+	if err != nil || calls != 0 || lazy.Rule.Line() != 1 {
+		t.Fatalf("Expected the match without any calls got %v %v after %v calls", lazy, err, calls)
+	}
+	var owners []string
+	for _, owner := range lazy.Owners {
+		owners = append(owners, fmt.Sprintf("%T:%v", owner, owner.Text()))
+	}
+	if expected := "codeowners.UserOwner:@juan codeowners.TeamOwner:@example/team codeowners.EmailOwner:joe@example.com"; strings.Join(owners, " ") != expected {
+		t.Errorf("Expected %v got %v", expected, owners)
+	}
+	users, errs := lazy.Resolve(context.TODO())
+	if len(users) != 3 || len(errs) != 1 || calls == 0 {
+		t.Errorf("Expected the owners to be resolved on request got %v %v", users, errs)
+	}
+	lazy, _ = co.MatchLazy("shared/main.go")
+	users, errs = lazy.Resolve(context.TODO())
+	var logins []string
+	for _, user := range users {
+		logins = append(logins, user.GetLogin())
+	}
+	sort.Strings(logins)
+	if len(errs) != 0 || strings.Join(logins, ",") != "joe,juan" {
+		t.Errorf("Expected a member of both teams to be resolved once got %v %v", logins, errs)
+	}
+	if _, err := ParseString("docs/ @joe").MatchLazy("main.go"); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("Expected no match got %v", err)
+	}
+}
+
+func TestEmailLookup(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/search/users", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") == "juan@example.com in:email" {
+			fmt.Fprint(w, `{"total_count": 1, "items": [{"login": "juan"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"total_count": 0, "items": []}`)
+	})
+	mux.HandleFunc("/search/commits", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") == "author-email:committer@example.com" {
+			fmt.Fprint(w, `{"total_count": 3, "items": [{"sha": "abc", "author": {"login": "joe"}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"total_count": 0, "items": []}`)
+	})
+	co := ParseString("* juan@example.com committer@example.com nobody@example.com").WithClient(testclient)
+	describe := func(users []*github.User) string {
+		var found []string
+		for _, user := range users {
+			found = append(found, user.GetLogin()+"/"+user.GetEmail())
+		}
+		sort.Strings(found)
+		return strings.Join(found, " ")
+	}
+	if users, _ := co.Match(context.TODO(), "x"); describe(users) != "/committer@example.com /juan@example.com /nobody@example.com" {
+		t.Errorf("Expected emails to be left alone by default got %v", describe(users))
+	}
+	users, errs := co.WithEmailLookup().Match(context.TODO(), "x")
+	if len(errs) != 0 || describe(users) != "/nobody@example.com joe/ juan/" {
+		t.Errorf("Expected the accounts behind the emails got %v %v", describe(users), errs)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/orgs/filter/teams", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 11, "slug": "team"}]`)
+	})
+	mux.HandleFunc("/teams/11/members", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"login": "ana"}, {"login": "dependabot[bot]", "type": "Bot"}, {"login": "sus"}]`)
+	})
+	mux.HandleFunc("/users/ana", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login": "ana", "type": "User"}`)
+	})
+	mux.HandleFunc("/users/dependabot[bot]", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login": "dependabot[bot]", "type": "Bot"}`)
+	})
+	mux.HandleFunc("/users/sus", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login": "sus", "type": "User", "suspended_at": "2020-01-01T00:00:00Z"}`)
+	})
+	co := ParseString("* @filter/team").WithClient(testclient)
+	logins := func(users []*github.User) string {
+		var found []string
+		for _, user := range users {
+			found = append(found, user.GetLogin())
+		}
+		sort.Strings(found)
+		return strings.Join(found, " ")
+	}
+	if users, _ := co.Match(context.TODO(), "x"); logins(users) != "ana dependabot[bot] sus" {
+		t.Errorf("Expected every member without filters got %v", logins(users))
+	}
+	users, errs := co.WithFilters(ExcludeBots, ExcludeSuspended).Match(context.TODO(), "x")
+	if len(errs) != 0 || logins(users) != "ana" {
+		t.Errorf("Expected bots and suspended users to be left out got %v %v", logins(users), errs)
+	}
+	if members, _ := co.WithFilters(ExcludeBots).WithMemberLogins().MatchLogins(context.TODO(), "x"); strings.Join(members, " ") != "ana sus" {
+		t.Errorf("Expected bots to be left out of the logins got %v", members)
+	}
+}
+
+func TestBoundedExpansion(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var members []string
+	for idx := 0; idx < 30; idx++ {
+		members = append(members, fmt.Sprintf(`{"login": "user%v"}`, idx))
+	}
+	mux.HandleFunc("/orgs/big/teams", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 12, "slug": "team"}]`)
+	})
+	mux.HandleFunc("/teams/12/members", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "[%v]", strings.Join(members, ","))
+	})
+	var lock sync.Mutex
+	current, most := 0, 0
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		current++
+		if current > most {
+			most = current
+		}
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		lock.Lock()
+		current--
+		lock.Unlock()
+		fmt.Fprintf(w, `{"login": %q}`, strings.TrimPrefix(r.URL.Path, "/users/"))
+	})
+	users, errs := ParseString("* @big/team @user1").WithClient(testclient).Match(context.TODO(), "x")
+	if len(users) != 30 || len(errs) != 0 {
+		t.Fatalf("Expected every member got %v users and %v", len(users), errs)
+	}
+	if most > expandconcurrency {
+		t.Errorf("Expected at most %v lookups at once got %v", expandconcurrency, most)
+	}
+}
+
+func TestMatchCanceled(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	var owners []string
+	for idx := 0; idx < 25; idx++ {
+		owners = append(owners, fmt.Sprintf("@stuck%v", idx))
+	}
+	// a repeated owner waits on the lookup already in flight for it
+	owners = append(owners, "@stuck0")
+	co := ParseString("* " + strings.Join(owners, " ")).WithClient(testclient)
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	users, errs := co.Match(ctx, "x")
+	if len(users) != 25 {
+		t.Errorf("Expected a bare login for every owner got %v", len(users))
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], context.Canceled) || CodeOf(errs[0]) != CodeCanceled {
+		t.Fatalf("Expected the context error got %v", errs)
+	}
+	for wait := 0; runtime.NumGoroutine() > before && wait < 100; wait++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Expected the lookups to stop with %v goroutines got %v", before, after)
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var lock sync.Mutex
+	current, most := 0, 0
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		current++
+		if current > most {
+			most = current
+		}
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		lock.Lock()
+		current--
+		lock.Unlock()
+		fmt.Fprintf(w, `{"login": %q}`, strings.TrimPrefix(r.URL.Path, "/users/"))
+	})
+	var owners []string
+	for idx := 0; idx < 12; idx++ {
+		owners = append(owners, fmt.Sprintf("@user%v", idx))
+	}
+	co := ParseString("a " + strings.Join(owners[:6], " ") + "\nb " + strings.Join(owners[6:], " ")).WithClient(testclient).WithMaxConcurrency(3)
+	var done sync.WaitGroup
+	for _, path := range []string{"a", "b"} {
+		done.Add(1)
+		go func(path string) {
+			defer done.Done()
+			if users, errs := co.Match(context.TODO(), path); len(users) != 6 || len(errs) != 0 {
+				t.Errorf("Expected 6 users for %v got %v and %v", path, len(users), errs)
+			}
+		}(path)
+	}
+	done.Wait()
+	if most > 3 {
+		t.Errorf("Expected at most 3 lookups at once across both matches got %v", most)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var lock sync.Mutex
+	attempts := 0
+	mux.HandleFunc("/users/limited", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		attempts++
+		limited := attempts%3 != 0
+		lock.Unlock()
+		if limited {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`)
+			return
+		}
+		fmt.Fprint(w, `{"login": "limited"}`)
+	})
+	var audited []int
+	SetAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		lock.Lock()
+		audited = append(audited, record.Status)
+		lock.Unlock()
+	}))
+	defer SetAuditSink(nil)
+	co := ParseString("* @limited").WithClient(testclient)
+	users, errs := co.Match(context.TODO(), "x")
+	if len(users) != 1 || len(errs) != 0 {
+		t.Fatalf("Expected the user after retrying got %v and %v", len(users), errs)
+	}
+	if fmt.Sprint(audited) != "[403 403 200]" {
+		t.Errorf("Expected every attempt to be audited got %v", audited)
+	}
+	_, errs = co.WithRetry(RetryPolicy{}).Match(context.TODO(), "x")
+	if len(errs) != 1 || CodeOf(errs[0]) != CodeRateLimited {
+		t.Fatalf("Expected the rate limit without retrying got %v", errs)
+	}
+	_, errs = co.WithRetry(RetryPolicy{MaxRetries: 3, MaxWait: time.Millisecond}).Match(context.TODO(), "x")
+	if len(errs) != 0 {
+		t.Fatalf("Expected the retries to be within the longest wait got %v", errs)
+	}
+	mux.HandleFunc("/users/backoff", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"message": "You have exceeded a secondary rate limit."}`)
+	})
+	start := time.Now()
+	_, errs = ParseString("* @backoff").WithClient(testclient).WithRetry(RetryPolicy{MaxRetries: 2, Backoff: 10 * time.Millisecond}).Match(context.TODO(), "x")
+	if len(errs) != 1 || CodeOf(errs[0]) != CodeRateLimited {
+		t.Fatalf("Expected the rate limit once the retries ran out got %v", errs)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected to back off 10ms then 20ms got %v", elapsed)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	setup(t)
+	defer teardown()
+	co := ParseString("* @juan @nobody\n*.md @juan").WithClient(testclient)
+	result, err := co.Lookup(context.TODO(), "main.go")
+	if !errors.Is(err, ErrUserNotFound) || CodeOf(err) != CodeUnknownOwner {
+		t.Fatalf("Expected the unknown owner got %v", err)
+	}
+	if !result.Partial || len(result.Users) != 1 || result.Users[0].GetLogin() != "juan" || result.Rule.Line() != 1 {
+		t.Errorf("Expected juan from line 1 as a partial result got %v", result)
+	}
+	result, err = co.Lookup(context.TODO(), "readme.md")
+	if err != nil || result.Partial || len(result.Users) != 1 {
+		t.Errorf("Expected juan alone got %v and %v", result, err)
+	}
+	if _, err := ParseString("docs/** @joe").Lookup(context.TODO(), "main.go"); CodeOf(err) != CodeNoMatch {
+		t.Errorf("Expected no match got %v", err)
+	}
+	results, errs := co.MatchMany(context.TODO(), []string{"main.go", "readme.md"})
+	if len(errs) != 1 || !results["main.go"].Partial || results["readme.md"].Partial {
+		t.Errorf("Expected only main.go to be partial got %v and %v", results, errs)
+	}
+}
+
+func TestMatchOrder(t *testing.T) {
+	setup(t)
+	defer teardown()
+	co := ParseString("* @example/team @juan Someone@example.com someone@example.com").WithClient(testclient)
+	for run := 0; run < 5; run++ {
+		co.Refresh()
+		users, errs := co.Match(context.TODO(), "x")
+		if len(errs) != 0 {
+			t.Fatalf("Expected no errors got %v", errs)
+		}
+		var names []string
+		for _, user := range users {
+			names = append(names, user.GetLogin()+user.GetEmail())
+		}
+		if strings.Join(names, " ") != "joe juan Someone@example.com" {
+			t.Fatalf("Expected the team by login then the email once got %v", names)
+		}
+	}
+	resolutions, _ := co.MatchGraded(context.TODO(), "x")
+	if len(resolutions) != 5 || resolutions[2].Owner != "@juan" {
+		t.Errorf("Expected every resolution in the order of the owners got %v", github.Stringify(resolutions))
+	}
+}
+
+func TestRetryTransient(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var lock sync.Mutex
+	attempts := 0
+	mux.HandleFunc("/users/flaky", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		attempts++
+		failing := attempts%3 != 0
+		lock.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{"login": "flaky"}`)
+	})
+	policy := RetryPolicy{MaxRetries: 3, Backoff: time.Millisecond, Jitter: 0.5}
+	co := ParseString("* @flaky").WithClient(testclient).WithRetry(policy)
+	if users, errs := co.Match(context.TODO(), "x"); len(users) != 1 || len(errs) != 0 {
+		t.Fatalf("Expected the user after the server recovered got %v and %v", users, errs)
+	}
+	policy.Retryable = func(resp *github.Response, err error) bool {
+		return false
+	}
+	co.Refresh()
+	if _, errs := co.WithRetry(policy).Match(context.TODO(), "x"); len(errs) != 1 || CodeOf(errs[0]) != CodeAPI {
+		t.Fatalf("Expected the server error when it isn't retryable got %v", errs)
+	}
+	// nothing listens at the address of a closed server, so every attempt fails to connect
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	unreachable := github.NewClient(nil)
+	unreachable.BaseURL, _ = url.Parse(closed.URL + "/")
+	audited := 0
+	SetAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		lock.Lock()
+		audited++
+		lock.Unlock()
+	}))
+	defer SetAuditSink(nil)
+	if _, errs := ParseString("* @flaky").WithClient(unreachable).WithRetry(RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond}).Match(context.TODO(), "x"); len(errs) != 1 {
+		t.Fatalf("Expected the connection to fail got %v", errs)
+	}
+	if audited != 3 {
+		t.Errorf("Expected the first attempt and 2 retries got %v", audited)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var lock sync.Mutex
+	requests := 0
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests++
+		lock.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	co := ParseString("* @a @b @c @d @e").WithClient(testclient).WithRetry(RetryPolicy{}).WithMaxConcurrency(1).WithCircuitBreaker(3, time.Hour)
+	_, errs := co.Match(context.TODO(), "x")
+	open := 0
+	for _, err := range errs {
+		if errors.Is(err, ErrCircuitOpen) && CodeOf(err) == CodeCircuitOpen {
+			open++
+		}
+	}
+	if len(errs) != 5 || open != 2 || requests != 3 {
+		t.Fatalf("Expected 3 requests before the breaker opened got %v requests and %v", requests, errs)
+	}
+	// a missing user is an answer from github, so it doesn't count towards tripping the breaker
+	co = ParseString("* @juan @nobody @nobody2 @nobody3").WithClient(testclient).WithRetry(RetryPolicy{}).WithMaxConcurrency(1).WithCircuitBreaker(2, time.Hour)
+	mux.HandleFunc("/users/nobody", http.NotFound)
+	mux.HandleFunc("/users/nobody2", http.NotFound)
+	mux.HandleFunc("/users/nobody3", http.NotFound)
+	if _, errs := co.Match(context.TODO(), "x"); len(errs) != 3 || CodeOf(errs[0]) != CodeUnknownOwner {
+		t.Errorf("Expected the unknown owners got %v", errs)
+	}
+	down := ParseString("* @down").WithClient(testclient).WithRetry(RetryPolicy{}).WithCircuitBreaker(1, 20*time.Millisecond)
+	requests = 0
+	for _, expected := range []Code{CodeAPI, CodeCircuitOpen} {
+		if _, errs := down.Match(context.TODO(), "x"); len(errs) != 1 || CodeOf(errs[0]) != expected {
+			t.Fatalf("Expected %v got %v", expected, errs)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, errs := down.Match(context.TODO(), "x"); len(errs) != 1 || CodeOf(errs[0]) != CodeAPI || requests != 2 {
+		t.Errorf("Expected a call to go ahead after the cooldown got %v requests and %v", requests, errs)
+	}
+}
+
+func TestMaxAPIRequests(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var lock sync.Mutex
+	requests := 0
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests++
+		lock.Unlock()
+		fmt.Fprintf(w, `{"login": %q}`, strings.TrimPrefix(r.URL.Path, "/users/"))
+	})
+	co := ParseString("* @a @b @c @d").WithClient(testclient).WithMaxAPIRequests(2)
+	result, err := co.Lookup(context.TODO(), "x")
+	if !errors.Is(err, ErrBudgetExceeded) || CodeOf(err) != CodeBudgetExceeded {
+		t.Fatalf("Expected the budget to run out got %v", err)
+	}
+	if !result.Partial || len(result.Users) != 2 || requests != 2 {
+		t.Errorf("Expected 2 users from 2 requests got %v from %v", result.Users, requests)
+	}
+	if _, err := co.Lookup(context.TODO(), "x"); !errors.Is(err, ErrBudgetExceeded) || requests != 4 {
+		t.Errorf("Expected another 2 requests for the next operation got %v and %v", requests, err)
+	}
+	if result, err := co.WithMaxAPIRequests(0).Lookup(context.TODO(), "x"); err != nil || len(result.Users) != 4 {
+		t.Errorf("Expected no limit got %v and %v", result.Users, err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	setup(t)
+	defer teardown()
+	reset := time.Now().Add(time.Hour).Unix()
+	var lock sync.Mutex
+	remaining := 100
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		remaining--
+		w.Header().Set("X-RateLimit-Limit", "100")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		lock.Unlock()
+		fmt.Fprintf(w, `{"login": %q}`, strings.TrimPrefix(r.URL.Path, "/users/"))
+	})
+	co := ParseString("* @a @b\n*.md @a").WithClient(testclient)
+	result, err := co.Lookup(context.TODO(), "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := result.Stats; stats.Requests != 2 || stats.CacheHits != 0 || stats.RateLimit.Remaining != 98 || stats.RateLimit.Reset.Unix() != reset {
+		t.Errorf("Expected 2 requests leaving 98 got %+v", stats)
+	}
+	result, _ = co.Lookup(context.TODO(), "readme.md")
+	if stats := result.Stats; stats.Requests != 0 || stats.CacheHits != 1 || stats.RateLimit.Limit != 0 {
+		t.Errorf("Expected the remembered owner got %+v", stats)
+	}
+	cache := NewMemoryCache()
+	results, _ := ParseString("* @a @c").WithClient(testclient).WithCache(cache, time.Minute).MatchMany(context.TODO(), []string{"x", "y"})
+	if stats := results["y"].Stats; stats.Requests != 2 || stats.RateLimit.Remaining != 96 {
+		t.Errorf("Expected the stats of the batch got %+v", stats)
+	}
+	result, _ = ParseString("* @a @c").WithClient(testclient).WithCache(cache, time.Minute).Lookup(context.TODO(), "x")
+	if stats := result.Stats; stats.Requests != 0 || stats.CacheHits != 2 {
+		t.Errorf("Expected the users from the cache got %+v", stats)
+	}
+}
+
+func TestGetCached(t *testing.T) {
+	setup(t)
+	defer teardown()
+	content := "*.go @juan"
+	mux.HandleFunc("/repos/example/polled/contents/CODEOWNERS", func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"%x"`, content)
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fakeresponder(content)(w, r)
+	})
+	var statuses []int
+	SetAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		statuses = append(statuses, record.Status)
+	}))
+	defer SetAuditSink(nil)
+	svc := NewService(testclient)
+	first, err := svc.GetCached(context.TODO(), "example", "polled")
+	if err != nil || first.Source().ETag == "" {
+		t.Fatalf("Expected the file and its etag got %v and %v", first.Source(), err)
+	}
+	second, err := svc.GetCached(context.TODO(), "example", "polled")
+	if err != nil || second.String() != "*.go @juan" {
+		t.Fatalf("Expected the file read before got %q and %v", second.String(), err)
+	}
+	content = "*.go @joe"
+	third, err := svc.GetCached(context.TODO(), "example", "polled")
+	if err != nil || third.String() != "*.go @joe" {
+		t.Fatalf("Expected the changed file got %v and %v", third, err)
+	}
+	if fmt.Sprint(statuses) != "[200 304 200]" {
+		t.Errorf("Expected the file to be asked for with its etag got %v", statuses)
+	}
+	if other, err := svc.GetCached(context.TODO(), "example", "polled", WithRef("main")); err != nil || other.Source().Ref != "main" || len(statuses) != 4 {
+		t.Errorf("Expected other options to read the file afresh got %v and %v", other.Source(), err)
+	}
+}
+
+func TestCachedService(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/served/contents/CODEOWNERS", fakeresponder("*.go @example/team @juan"))
+	var lock sync.Mutex
+	calls := make(map[string]int)
+	SetAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		lock.Lock()
+		calls[record.Operation]++
+		lock.Unlock()
+	}))
+	defer SetAuditSink(nil)
+	svc := NewCachedService(testclient, CacheTTLs{Files: time.Minute, Teams: time.Minute, Users: time.Minute})
+	for i := 0; i < 2; i++ {
+		co, err := svc.Get(context.TODO(), "example", "served")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, err := co.Lookup(context.TODO(), "main.go"); err != nil || len(result.Users) != 2 {
+			t.Fatalf("Expected juan and joe got %v and %v", result.Users, err)
+		}
+	}
+	if calls["Repositories.GetContents"] != 1 || calls["Organizations.ListTeams"] != 1 {
+		t.Errorf("Expected the file and teams to be read once got %v", calls)
+	}
+	svc.Invalidate("example", "served")
+	co, _ := svc.Get(context.TODO(), "example", "served")
+	co.Lookup(context.TODO(), "main.go")
+	if calls["Repositories.GetContents"] != 2 || calls["Organizations.ListTeams"] != 1 {
+		t.Errorf("Expected only the file to be read again got %v", calls)
+	}
+	svc.Invalidate("example", "")
+	co, _ = svc.Get(context.TODO(), "example", "served")
+	co.Lookup(context.TODO(), "main.go")
+	if calls["Repositories.GetContents"] != 3 || calls["Organizations.ListTeams"] != 2 {
+		t.Errorf("Expected the file and teams to be read again got %v", calls)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/ci/contents/CODEOWNERS", fakeresponder("*.go @example/team"))
+	var lock sync.Mutex
+	calls := make(map[string]int)
+	SetAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		lock.Lock()
+		calls[record.Operation]++
+		lock.Unlock()
+	}))
+	defer SetAuditSink(nil)
+	dir, err := ioutil.TempDir("", "codeowners")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for run := 0; run < 2; run++ {
+		cache, err := NewDiskCache(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		svc := NewService(testclient).WithCache(cache, time.Minute).WithCacheTTLs(CacheTTLs{Files: time.Minute})
+		co, err := svc.Get(context.TODO(), "example", "ci")
+		if err != nil || co.Source().Path != "CODEOWNERS" {
+			t.Fatalf("Expected the file got %v and %v", co.Source(), err)
+		}
+		if result, err := co.Lookup(context.TODO(), "main.go"); err != nil || len(result.Users) != 2 {
+			t.Fatalf("Expected juan and joe got %v and %v", result.Users, err)
+		}
+	}
+	if calls["Repositories.GetContents"] != 1 || calls["Organizations.ListTeams"] != 1 || calls["Users.Get"] != 2 {
+		t.Errorf("Expected the second run to read everything from disk got %v", calls)
+	}
+	cache, _ := NewDiskCache(dir)
+	cache.Set("expired", []byte("1"), -time.Second)
+	if _, ok := cache.Get("expired"); ok {
+		t.Error("Expected an expired value to be dropped")
+	}
+	ioutil.WriteFile(cache.path("old"), []byte(`{"Version":0,"Key":"old","Expires":"2999-01-01T00:00:00Z","Value":"MQ=="}`), 0644)
+	if _, ok := cache.Get("old"); ok {
+		t.Error("Expected a value written in another format to be ignored")
+	}
+}
+
+func TestCompiledPatterns(t *testing.T) {
+	patterns := []string{"**", "*.go", "docs/", "/docs/*", "docs/**/*.md", "apps/", "**/build", "a/**", "a/**/b", "{src,lib}/*.js", "lib/[a-c]*.go", `foo\/bar`, "/", "!*.md", "src/app"}
+	paths := []string{"main.go", "docs/readme.md", "docs/api/readme.md", "src/docs/x", "apps/web/apps/x", "build", "x/build/out", "a/b", "a/x/y/b", "src/x.js", "lib/b.go", "foo/bar", "src/app/main.go", "x/src/app/y"}
+	for _, pattern := range patterns {
+		rule, _ := parseline(pattern + " @juan")
+		for _, mode := range []AnchorMode{AnchorGitignore, AnchorLeadingSlash} {
+			sem := semantics{anchoring: mode, negation: NegationExtension}
+			for _, path := range paths {
+				if compiled, uncompiled := sem.matchrule(rule, path), sem.match(rule.path, path); compiled != uncompiled {
+					t.Errorf("Expected %v to match %v the same compiled got %v and %v", rule.path, path, compiled, uncompiled)
+				}
+			}
+		}
+	}
+}
+
+// a file with a rule for each of many services along with some rules that apply across them
+func benchmarkrules() (CodeOwners, []string) {
+	var content strings.Builder
+	content.WriteString("* @juan\n*.md @joe\n")
+	var paths []string
+	for idx := 0; idx < 1200; idx++ {
+		fmt.Fprintf(&content, "services/svc%v/**/*.go @example/team%v\n", idx, idx)
+		paths = append(paths, fmt.Sprintf("services/svc%v/cmd/main.go", idx))
+	}
+	content.WriteString("/docs/ @joe\n")
+	return ParseString(content.String()), paths
+}
+
+func BenchmarkLinearMatch(b *testing.B) {
+	co, paths := benchmarkrules()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		linearmatch(co.patterns, paths[i%len(paths)], co.semantics)
+	}
+}
+
+// matches the same rules compiling their patterns each time, as every match did before they were compiled on parsing
+func BenchmarkLinearMatchUncompiled(b *testing.B) {
+	co, paths := benchmarkrules()
+	for idx := range co.patterns {
+		co.patterns[idx].globs = nil
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		linearmatch(co.patterns, paths[i%len(paths)], co.semantics)
+	}
+}
+
+func BenchmarkIndexedMatch(b *testing.B) {
+	co, paths := benchmarkrules()
+	co = co.WithMatcher(MatcherIndexed)
+	co.lookup(paths[0])
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		co.lookup(paths[i%len(paths)])
+	}
+}
+
+func TestIndexTrie(t *testing.T) {
+	patterns := parse("* @juan\nsrc/** @joe\nsrc/lib/ @example/team\nsrc/lib/*.go @juan\n/src/lib/vendor/x @joe\nsrc/*/test @joe\n*.md @joe\nsrc/lib/readme.md @juan")
+	ix := buildindex(patterns, semantics{})
+	lib := ix.root.children["src"].children["lib"]
+	if fmt.Sprint(ix.root.rules) != "[0 6]" || fmt.Sprint(ix.root.children["src"].rules) != "[1 5]" || fmt.Sprint(lib.rules) != "[2 3]" {
+		t.Fatalf("Expected rules at the end of their literal prefix got %v %v %v", ix.root.rules, ix.root.children["src"].rules, lib.rules)
+	}
+	if len(lib.children["vendor"].children["x"].rules) != 1 || len(lib.children["readme.md"].rules) != 1 {
+		t.Fatalf("Expected literal patterns to be kept at their own node")
+	}
+	linear := CodeOwners{patterns: patterns, memo: &memo{rules: make(map[string]int)}}.WithMatcher(MatcherLinear)
+	indexed := CodeOwners{patterns: patterns, memo: &memo{rules: make(map[string]int)}}.WithMatcher(MatcherIndexed)
+	for _, path := range []string{"src/lib/a.go", "src/lib/vendor/x", "src/lib/vendor/x/y.go", "src/lib/readme.md", "src/app/test/a", "src/lib/test", "src", "readme.md", "other/src/lib/a.go", "src/lib/deep/a.txt"} {
+		if linear.rule(path) != indexed.rule(path) {
+			t.Errorf("Matchers disagree on %v: %v and %v", path, linear.rule(path), indexed.rule(path))
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	var content strings.Builder
+	for idx := 0; idx < 1200; idx++ {
+		fmt.Fprintf(&content, "# service %v\nservices/svc%v/**/*.go @example/team%v @juan # owners\n", idx, idx, idx)
+	}
+	text := content.String()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ParseString(text)
+	}
+}
+
+func BenchmarkRuleFor(b *testing.B) {
+	co, paths := benchmarkrules()
+	for _, path := range paths {
+		co.RuleFor(path)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		co.RuleFor(paths[i%len(paths)])
+	}
+}
+
+// RuleFor on paths it has not seen before, which are matched with the index and then remembered
+func BenchmarkRuleForUnseen(b *testing.B) {
+	co, services := benchmarkrules()
+	co = co.WithMatcher(MatcherIndexed)
+	co.RuleFor(services[0])
+	var paths []string
+	for idx := 0; idx < 1<<16; idx++ {
+		paths = append(paths, fmt.Sprintf("%v/file%v.go", strings.TrimSuffix(services[idx%len(services)], "/main.go"), idx))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i > 0 && i%len(paths) == 0 {
+			b.StopTimer()
+			co.memo.rules = make(map[string]int)
+			b.StartTimer()
+		}
+		co.RuleFor(paths[i%len(paths)])
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	setup(b)
+	defer teardown()
+	co := ParseString("*.go @juan @joe\ndocs/ @example/team\n").WithClient(testclient)
+	paths := []string{"main.go", "docs/readme.md", "cmd/main.go"}
+	for _, path := range paths {
+		if _, err := co.Lookup(context.TODO(), path); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		co.Lookup(context.TODO(), paths[i%len(paths)])
+	}
+}
+
+func TestMatchSimple(t *testing.T) {
+	patterns := []string{"*", "*.go", "a*b*", "?.md", "*?", `\*x`, `a\`, "**.go", "x*y*z", "é?", "*é"}
+	names := []string{"", "a", "main.go", "ab", "axbyb", "b.md", "*x", "ax", "x.go", "xyz", "xaybz", "éa", "aé", "a\\"}
+	for _, pattern := range patterns {
+		for _, name := range names {
+			expected, _ := doublestar.Match(pattern, name)
+			if matchsimple(pattern, name) != expected {
+				t.Errorf("Expected %q against %q to be %v", pattern, name, expected)
+			}
+		}
+	}
+}
+
+func TestMatchAllocations(t *testing.T) {
+	co, paths := benchmarkrules()
+	for _, kind := range []MatcherKind{MatcherLinear, MatcherIndexed} {
+		co := co.WithMatcher(kind)
+		co.lookup(paths[0])
+		if allocs := testing.AllocsPerRun(100, func() { co.lookup(paths[7]) }); allocs != 0 {
+			t.Errorf("Expected matcher %v to match without allocating got %v", kind, allocs)
+		}
+	}
+}
+
+func TestGraphQLUsers(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var queries []string
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		queries = append(queries, string(body))
+		fmt.Fprint(w, `{"data": {"u0": {"login": "juan", "name": "Juan G", "databaseId": 6}, "u1": null}}`)
+	})
+	var lock sync.Mutex
+	calls := make(map[string]int)
+	SetAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		lock.Lock()
+		calls[record.Operation]++
+		lock.Unlock()
+	}))
+	defer SetAuditSink(nil)
+	co := ParseString("*.go @juan @joe").WithClient(testclient).WithGraphQLUsers()
+	result, err := co.Lookup(context.TODO(), "main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []string
+	for _, user := range result.Users {
+		users = append(users, fmtuser(*user))
+	}
+	if strings.Join(users, ",") != "juan:Juan G,joe:Joe" {
+		t.Errorf("Expected juan from graphql and joe from the rest api got %v", users)
+	}
+	if len(queries) != 1 || !strings.Contains(queries[0], `u1: user(login: \"joe\")`) || calls["Users.Get"] != 1 {
+		t.Errorf("Expected one query for both and joe to be fetched alone got %v and %v", queries, calls)
+	}
+	if _, err := ParseString("*.go @juan").WithClient(testclient).WithGraphQLUsers().Lookup(context.TODO(), "main.go"); err != nil || len(queries) != 1 {
+		t.Errorf("Expected a single login to be fetched without graphql got %v and %v", queries, err)
+	}
+}
+
+func TestGraphQLTeams(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var lock sync.Mutex
+	var queries []string
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string
+			Variables map[string]string
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		lock.Lock()
+		queries = append(queries, body.Variables["slug"]+":"+body.Variables["membership"])
+		lock.Unlock()
+		switch {
+		case body.Variables["slug"] == "missing":
+			fmt.Fprint(w, `{"data": {"organization": {"team": null}}}`)
+		case body.Variables["cursor"] == "":
+			fmt.Fprint(w, `{"data": {"organization": {"team": {"members": {"pageInfo": {"hasNextPage": true, "endCursor": "next"}, "nodes": [{"login": "juan", "name": "Juan G", "databaseId": 6}]}}}}}`)
+		default:
+			fmt.Fprint(w, `{"data": {"organization": {"team": {"members": {"pageInfo": {"hasNextPage": false}, "nodes": [{"login": "joe", "name": "Joe G", "databaseId": 69}]}}}}}`)
+		}
+	})
+	calls := make(map[string]int)
+	SetAuditSink(AuditSinkFunc(func(record AuditRecord) {
+		lock.Lock()
+		calls[record.Operation]++
+		lock.Unlock()
+	}))
+	defer SetAuditSink(nil)
+	co := ParseString("*.go @example/team\n*.md @example/missing").WithClient(testclient).WithCache(NewMemoryCache(), time.Minute).WithGraphQLTeams().WithChildTeams()
+	result, err := co.Lookup(context.TODO(), "main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []string
+	for _, user := range result.Users {
+		users = append(users, fmtuser(*user))
+	}
+	if strings.Join(users, ",") != "joe:Joe G,juan:Juan G" {
+		t.Errorf("Expected both pages of members got %v", users)
+	}
+	if fmt.Sprint(queries) != "[team:ALL team:ALL]" || calls["Organizations.ListTeams"] != 0 || calls["Users.Get"] != 0 {
+		t.Errorf("Expected the members and their details from graphql alone got %v and %v", queries, calls)
+	}
+	if _, err := co.Lookup(context.TODO(), "readme.md"); !errors.Is(err, ErrTeamNotFound) {
+		t.Errorf("Expected a team graphql can't find to be unknown got %v", err)
+	}
+}
+
+func TestGetAll(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var lock sync.Mutex
+	running, most := 0, 0
+	var repos []RepoRef
+	for idx := 0; idx < 12; idx++ {
+		repos = append(repos, RepoRef{Owner: "example", Repo: fmt.Sprintf("repo%v", idx)})
+		content := fmt.Sprintf("*.go @team%v", idx)
+		mux.HandleFunc(fmt.Sprintf("/repos/example/repo%v/contents/CODEOWNERS", idx), func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			lock.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			fakeresponder(content)(w, r)
+			lock.Lock()
+			running--
+			lock.Unlock()
+		})
+	}
+	repos = append(repos, RepoRef{Owner: "example", Repo: "nocodeowner"})
+	results := NewService(testclient).WithMaxConcurrency(3).GetAll(context.TODO(), repos, WithLocations(""))
+	if len(results) != len(repos) || most > 3 || most < 2 {
+		t.Fatalf("Expected every repository read at most 3 at a time got %v results and %v at once", len(results), most)
+	}
+	for idx, result := range results[:12] {
+		if result.Err != nil || result.Repo != repos[idx].Repo || result.Owners.String() != fmt.Sprintf("*.go @team%v", idx) {
+			t.Errorf("Expected the file of %v got %q and %v", repos[idx].Repo, result.Owners.String(), result.Err)
+		}
+	}
+	if CodeOf(results[12].Err) != CodeNoCodeowners {
+		t.Errorf("Expected the repository without a file to fail got %v", results[12].Err)
+	}
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	results = GetAll(ctx, testclient, repos[:1])
+	if CodeOf(results[0].Err) != CodeCanceled && !errors.Is(results[0].Err, context.Canceled) {
+		t.Errorf("Expected nothing to be read after the context ended got %v", results[0].Err)
+	}
+}
+
+func TestFindUnownedTruncated(t *testing.T) {
+	setup(t)
+	defer teardown()
+	trees := map[string]string{
+		"main": `[{"path": "readme.md", "type": "blob"}, {"path": "src", "type": "tree", "sha": "s1"}, {"path": "docs", "type": "tree", "sha": "d1"}]`,
+		"s1":   `[{"path": "main.go", "type": "blob"}, {"path": "gen", "type": "tree", "sha": "g1"}]`,
+		"d1":   `[{"path": "guide.md", "type": "blob"}, {"path": "old", "type": "tree", "sha": "o1"}, {"path": "old/notes.txt", "type": "blob"}]`,
+		"g1":   `[{"path": "api.pb", "type": "blob"}]`,
+		"o1":   `[]`,
+	}
+	mux.HandleFunc("/repos/example/big", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "big", "default_branch": "main"}`)
+	})
+	mux.HandleFunc("/repos/example/big/git/trees/", func(w http.ResponseWriter, r *http.Request) {
+		sha := strings.TrimPrefix(r.URL.Path, "/repos/example/big/git/trees/")
+		// the root and src are too big to list recursively
+		truncated := r.URL.Query().Get("recursive") == "1" && (sha == "main" || sha == "s1")
+		fmt.Fprintf(w, `{"sha": %q, "tree": %v, "truncated": %v}`, sha, trees[sha], truncated)
+	})
+	co := ParseString("*.go @juan\ndocs/ @joe\ndocs/old/").WithClient(testclient)
+	co.owner, co.repo = "example", "big"
+	unowned, err := co.FindUnowned(context.TODO(), "", CoverageOptions{})
+	if err != nil || strings.Join(unowned, ",") != "readme.md,src/gen/api.pb,docs/old/notes.txt" {
+		t.Fatalf("Expected the files of every subtree to be checked got %v and %v", unowned, err)
+	}
+}
+
+func TestOwnersLocal(t *testing.T) {
+	root, err := ioutil.TempDir("", "codeowners")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if _, err := ParseDir(root); !errors.Is(err, ErrNoCodeowners) {
+		t.Errorf("Expected a checkout without a file to fail got %v", err)
+	}
+	files := map[string]string{
+		".gitignore":         "*.log\n",
+		".github/CODEOWNERS": "*.go @juan\ndocs/ @joe\ndocs/drafts/\n",
+		"main.go":            "",
+		"debug.log":          "",
+		"docs/readme.md":     "",
+		"docs/drafts/x.md":   "",
+		"other.txt":          "",
+	}
+	for name, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := ioutil.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	co, err := ParseDir(root)
+	if err != nil || co.Source().Path != ".github/CODEOWNERS" {
+		t.Fatalf("Expected the file from .github got %v and %v", co.Source(), err)
+	}
+	owners, err := co.OwnersLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for _, file := range owners {
+		result = append(result, fmt.Sprintf("%v:%v:%v", file.Path, file.Owners, file.Rule.line))
+	}
+	if strings.Join(result, ",") != ".github/CODEOWNERS:[]:0,.gitignore:[]:0,docs/drafts/x.md:[]:3,docs/readme.md:[@joe]:2,main.go:[@juan]:1,other.txt:[]:0" {
+		t.Errorf("Expected the owners of every file that isn't ignored got %v", result)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var archive bytes.Buffer
+	zipped := gzip.NewWriter(&archive)
+	tarball := tar.NewWriter(zipped)
+	tarball.WriteHeader(&tar.Header{Name: "pax_global_header", Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "abc123"}})
+	files := []struct{ name, content string }{
+		{"example-repo-abc123/", ""},
+		{"example-repo-abc123/CODEOWNERS", "* @joe"},
+		{"example-repo-abc123/.github/", ""},
+		{"example-repo-abc123/.github/CODEOWNERS", "*.go @juan\ndocs/ @joe\ndocs/old/"},
+		{"example-repo-abc123/main.go", "package main"},
+		{"example-repo-abc123/docs/old/notes.txt", "notes"},
+		{"example-repo-abc123/readme.md", "# repo"},
+	}
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(file.content))}
+		if strings.HasSuffix(file.name, "/") {
+			header.Typeflag, header.Mode = tar.TypeDir, 0755
+		}
+		tarball.WriteHeader(header)
+		tarball.Write([]byte(file.content))
+	}
+	tarball.WriteHeader(&tar.Header{Name: "example-repo-abc123/main_link.go", Typeflag: tar.TypeSymlink, Linkname: "main.go"})
+	tarball.Close()
+	zipped.Close()
+	mux.HandleFunc("/repos/example/repo/tarball/v1", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+"/codeload/example/repo/v1", http.StatusFound)
+	})
+	mux.HandleFunc("/codeload/example/repo/v1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive.Bytes())
+	})
+	mux.HandleFunc("/repos/example/repo/git/trees/", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected the tree not to be listed")
+	})
+	co, err := Get(context.TODO(), testclient, "example", "repo", WithLocations(".github", ""), WithRef("v1"), WithArchive())
+	if err != nil {
+		t.Fatal("Expect to get no error; got ", err)
+	}
+	if co.Source().Path != ".github/CODEOWNERS" || len(co.Rules()) != 3 {
+		t.Errorf("Expected the first location in the archive to be read got %v with %v rules", co.Source().Path, len(co.Rules()))
+	}
+	if strings.Join(co.Files(), ",") != "CODEOWNERS,.github/CODEOWNERS,main.go,docs/old/notes.txt,readme.md,main_link.go" {
+		t.Errorf("Expected the files of the archive got %v", co.Files())
+	}
+	unowned, err := co.FindUnowned(context.TODO(), "v1", CoverageOptions{})
+	if err != nil || strings.Join(unowned, ",") != "CODEOWNERS,.github/CODEOWNERS,docs/old/notes.txt,readme.md" {
+		t.Errorf("Expected the unowned files of the archive got %v and %v", unowned, err)
+	}
+	_, err = Get(context.TODO(), testclient, "example", "repo", WithLocations("docs"), WithRef("v1"), WithArchive())
+	if !errors.Is(err, ErrNoCodeowners) {
+		t.Errorf("Expected an archive without the file to fail got %v", err)
+	}
+}
+
+func TestOwnershipMap(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @juan\n*.md @joe docs@example.com\ntest/** @example/team @example/missing\nvendor/"))
+	treeresponder("main.go", "readme.md", "test/a.txt", "test/b.txt", "vendor/lib.go", "LICENSE")
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	ownership, errs := co.OwnershipMap(context.TODO(), "")
+	if len(errs) != 1 || !errors.Is(errs[0], ErrTeamNotFound) {
+		t.Errorf("Expected the missing team to be reported once got %v", errs)
+	}
+	var result []string
+	for path, owners := range ownership {
+		var texts []string
+		for _, owner := range owners {
+			texts = append(texts, fmt.Sprintf("%T:%v", owner, owner.Text()))
+		}
+		result = append(result, fmt.Sprintf("%v=%v/%v", path, owners == nil, strings.Join(texts, " ")))
+	}
+	sort.Strings(result)
+	expected := "LICENSE=true/,main.go=false/codeowners.UserOwner:@juan,readme.md=false/codeowners.UserOwner:@joe codeowners.EmailOwner:docs@example.com," +
+		"test/a.txt=false/codeowners.TeamOwner:@example/team,test/b.txt=false/codeowners.TeamOwner:@example/team,vendor/lib.go=false/"
+	if strings.Join(result, ",") != expected {
+		t.Errorf("Expected the owners of every file got %v", result)
+	}
+}
+
+func TestOwnerStats(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan\n*.md @joe @Juan @juan\ntest/** @example/team\nvendor/ @joe\nold/ @example/old"))
+	treeresponder("main.go", "readme.md", "test/a.txt", "test/b.txt", "test/c.md")
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	loads, err := co.OwnerStats(context.TODO(), "")
+	if err != nil {
+		t.Fatal("Expect to get no error; got ", err)
+	}
+	var result []string
+	for _, load := range loads {
+		result = append(result, fmt.Sprintf("%v:%v/%v/%.1f", load.Owner, load.Rules, load.Files, load.Share))
+	}
+	if strings.Join(result, ",") != "@example/team:1/3/0.6,@juan:2/2/0.4,@joe:2/1/0.2,@example/old:1/0/0.0" {
+		t.Errorf("Expected the load of every owner got %v", result)
+	}
+}
+
+func TestBusFactor(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @example/team\nsolo/ @juan\nsolo/shared/ @juan @juan\nmixed/a/ @joe\nmixed/b/ @juan\nempty/\n"))
+	treeresponder("main.go", "solo/x.go", "solo/shared/y.go", "mixed/a/1.go", "mixed/b/2.go", "mixed/c.go", "empty/z.go")
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	points, errs := co.BusFactor(context.TODO())
+	if len(errs) > 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	var result []string
+	for _, point := range points {
+		result = append(result, point.Rule.Pattern()+":"+point.User.GetLogin())
+	}
+	if strings.Join(result, ",") != "solo/:juan,solo/shared/:juan,mixed/a/:joe,mixed/b/:juan" {
+		t.Errorf("Expected the rules owned by one person got %v", result)
+	}
+	dirs, errs := co.BusFactorDirs(context.TODO(), "")
+	if len(errs) > 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	result = nil
+	for _, dir := range dirs {
+		result = append(result, fmt.Sprintf("%v:%v/%v", dir.Path, dir.User.GetLogin(), dir.Files))
+	}
+	if strings.Join(result, ",") != "mixed/a:joe/1,mixed/b:juan/1,solo:juan/2" {
+		t.Errorf("Expected the outermost directories owned by one person got %v", result)
+	}
+}
+
+func TestUnmatchedRules(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan\n/serivces/* @joe\n*.md @joe\n!vendor/\nold/ @joe\n*.md @juan\n"))
+	treeresponder("main.go", "readme.md", "services/api.go")
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	rules, err := co.UnmatchedRules(context.TODO(), "")
+	if err != nil || len(rules) != 2 || rules[0].Line() != 2 || rules[1].Line() != 5 {
+		t.Errorf("Expected /serivces/* and old/ to match nothing got %v and %v", rules, err)
+	}
+	diagnostics, err := co.LintTree(context.TODO(), "", SeverityError)
+	var result []string
+	for _, diagnostic := range diagnostics {
+		result = append(result, fmt.Sprintf("%v:%v:%v", diagnostic.Line, diagnostic.Code, diagnostic.Severity))
+	}
+	if expected := "2:CO043:error,3:CO041:warning,5:CO043:error"; err != nil || strings.Join(result, ",") != expected {
+		t.Errorf("Expected %v got %v and %v", expected, result, err)
+	}
+}
+
+func TestForPullRequest(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "base": {"ref": "release", "sha": "aaa"}, "head": {"sha": "bbb"}}`)
+	})
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != "release" {
+			http.NotFound(w, r)
+			return
+		}
+		fakeresponder("*.go @juan\ntest/** @example/team @juan\ndocs/")(w, r)
+	})
+	mux.HandleFunc("/repos/example/repo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"filename": "test/file.txt"}, {"filename": "readme.md"}]`)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%v/repos/example/repo/pulls/1/files?page=2>; rel="next"`, server.URL))
+		fmt.Fprint(w, `[{"filename": "main.go"}, {"filename": "docs/guide.md"}]`)
+	})
+	result, errs := ForPullRequest(context.TODO(), testclient, "example", "repo", 1)
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	if result.File.Source().Ref != "release" || len(result.Files) != 3 {
+		t.Errorf("Expected the changed files to be matched against the base branch got %+v", result)
+	}
+	if _, ok := result.Files["readme.md"]; ok || result.Files["test/file.txt"].Rule.Line() != 2 {
+		t.Errorf("Expected only the files a rule matches got %+v", result.Files)
+	}
+	var users []string
+	for _, user := range result.Users {
+		users = append(users, user.GetLogin())
+	}
+	if strings.Join(result.Owners, ",") != "@juan,@example/team" || strings.Join(users, ",") != "juan,joe" {
+		t.Errorf("Expected the union of the owners got %v and %v", result.Owners, users)
+	}
+}
+
+func TestSuggestReviewers(t *testing.T) {
+	setup(t)
+	defer teardown()
+	reviews := `[]`
+	mux.HandleFunc("/repos/example/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "user": {"login": "Joe"}, "base": {"ref": "main"}}`)
+	})
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @juan @joe @ann @bob\ntest/** @example/team\ndocs/ @ann\n"))
+	mux.HandleFunc("/repos/example/repo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "main.go"}, {"filename": "test/a.txt"}, {"filename": "docs/guide.md"}]`)
+	})
+	mux.HandleFunc("/repos/example/repo/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, reviews)
+	})
+	mux.HandleFunc("/repos/example/repo/pulls/1/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"users": [{"login": "ann"}], "teams": []}`)
+	})
+	for _, login := range []string{"ann", "bob"} {
+		login := login
+		mux.HandleFunc("/users/"+login, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"login": %q}`, login)
+		})
+	}
+	cases := []struct {
+		reviews  string
+		max      int
+		expected string
+	}{
+		{`[]`, 0, "juan,bob"},
+		{`[{"user": {"login": "bob"}, "state": "APPROVED"}]`, 0, "juan"},
+		{`[]`, 1, "juan"},
+		{`[]`, 2, "juan"},
+		{`[]`, 3, "juan,bob"},
+	}
+	for _, c := range cases {
+		reviews = c.reviews
+		users, errs := SuggestReviewers(context.TODO(), testclient, "example", "repo", 1, ReviewerOptions{MaxPerRule: c.max})
+		if len(errs) != 0 {
+			t.Fatal("Expect to get no error; got ", errs)
+		}
+		var logins []string
+		for _, user := range users {
+			logins = append(logins, user.GetLogin())
+		}
+		if strings.Join(logins, ",") != c.expected {
+			t.Errorf("Expected %v to be suggested with %v per rule and reviews %v got %v", c.expected, c.max, c.reviews, logins)
+		}
+	}
+}
+
+func TestApprovalStatus(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @juan\ntest/** @example/team\ndocs/\n"))
+	pullresponder([]string{"main.go", "test/a.txt", "test/b.go", "docs/guide.md", "readme.md"}, `[{"user": {"login": "joe"}, "state": "APPROVED"}]`)
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	summary, errs := co.ApprovalStatus(context.TODO(), 1)
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	if summary.Approved || len(summary.Satisfied) != 1 || summary.Satisfied[0].Pattern != "test/**" || len(summary.Unsatisfied) != 1 || summary.Unsatisfied[0].Pattern != "*.go" {
+		t.Errorf("Expected test/** to be satisfied and *.go not got %+v", summary)
+	}
+	if fmt.Sprint(summary.Files) != "map[main.go:false test/a.txt:true test/b.go:true]" || strings.Join(summary.Missing, ",") != "@juan" {
+		t.Errorf("Expected main.go to be missing @juan got %v and %v", summary.Files, summary.Missing)
+	}
+}
+
+func TestAssignReviewers(t *testing.T) {
+	setup(t)
+	defer teardown()
+	reviews := `[]`
+	var requests []string
+	failing := false
+	mux.HandleFunc("/repos/example/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "user": {"login": "bob"}, "base": {"ref": "main"}}`)
+	})
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @example/team\ndocs/ @ann @bob\n"))
+	mux.HandleFunc("/repos/example/repo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "main.go"}, {"filename": "docs/guide.md"}]`)
+	})
+	mux.HandleFunc("/repos/example/repo/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, reviews)
+	})
+	mux.HandleFunc("/repos/example/repo/pulls/1/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && failing {
+			http.Error(w, `{"message": "Validation Failed"}`, http.StatusUnprocessableEntity)
+			return
+		}
+		if r.Method == "POST" {
+			var body github.ReviewersRequest
+			json.NewDecoder(r.Body).Decode(&body)
+			requests = append(requests, strings.Join(body.Reviewers, " "))
+			fmt.Fprint(w, `{"number": 1}`)
+			return
+		}
+		fmt.Fprint(w, `{"users": [], "teams": []}`)
+	})
+	for _, login := range []string{"ann", "bob"} {
+		login := login
+		mux.HandleFunc("/users/"+login, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"login": %q}`, login)
+		})
+	}
+	clock := time.Unix(0, 0)
+	leastrecent := NewLeastRecentlyAssigned()
+	leastrecent.now = func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	}
+	strategies := map[string]AssignStrategy{
+		"first":       nil,
+		"roundrobin":  NewRoundRobin(),
+		"leastrecent": leastrecent,
+	}
+	expected := map[string]string{
+		"first":       "joe ann,joe ann,joe ann",
+		"roundrobin":  "joe ann,juan ann,joe ann",
+		"leastrecent": "joe ann,juan ann,joe ann",
+	}
+	for name, strategy := range strategies {
+		requests = nil
+		for idx := 0; idx < 3; idx++ {
+			if _, errs := AssignReviewers(context.TODO(), testclient, "example", "repo", 1, AssignOptions{Strategy: strategy}); len(errs) != 0 {
+				t.Fatal("Expect to get no error; got ", errs)
+			}
+		}
+		if strings.Join(requests, ",") != expected[name] {
+			t.Errorf("Expected %v to ask %v got %v", name, expected[name], requests)
+		}
+	}
+	requests = nil
+	roundrobin := NewRoundRobin()
+	failing = true
+	if _, errs := AssignReviewers(context.TODO(), testclient, "example", "repo", 1, AssignOptions{Strategy: roundrobin}); len(errs) != 1 {
+		t.Fatalf("Expected the failed request to be returned got %v", errs)
+	}
+	failing = false
+	if _, errs := AssignReviewers(context.TODO(), testclient, "example", "repo", 1, AssignOptions{Strategy: roundrobin}); len(errs) != 0 || strings.Join(requests, ",") != "joe ann" {
+		t.Errorf("Expected a failed request not to move the round robin on got %v and %v", requests, errs)
+	}
+	requests = nil
+	reviews = `[{"user": {"login": "juan"}, "state": "APPROVED"}]`
+	assigned, errs := AssignReviewers(context.TODO(), testclient, "example", "repo", 1, AssignOptions{PerTeam: 2})
+	if len(errs) != 0 || strings.Join(assigned, " ") != "joe ann" || strings.Join(requests, ",") != "joe ann" {
+		t.Errorf("Expected an approval to count towards the team got %v %v and %v", assigned, requests, errs)
+	}
+}
+
+func TestTeamRouting(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var requests []string
+	mux.HandleFunc("/repos/example/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "user": {"login": "bob"}, "base": {"ref": "main"}}`)
+	})
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @example/team\ndocs/ @ann\n"))
+	mux.HandleFunc("/repos/example/repo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "main.go"}, {"filename": "docs/guide.md"}]`)
+	})
+	mux.HandleFunc("/repos/example/repo/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/example/repo/pulls/1/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			var body github.ReviewersRequest
+			json.NewDecoder(r.Body).Decode(&body)
+			requests = append(requests, strings.Join(body.Reviewers, " ")+"/"+strings.Join(body.TeamReviewers, " "))
+			fmt.Fprint(w, `{"number": 1}`)
+			return
+		}
+		fmt.Fprint(w, `{"users": [], "teams": []}`)
+	})
+	mux.HandleFunc("/users/ann", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login": "ann"}`)
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables map[string]string `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Variables["org"] != "example" || body.Variables["slug"] != "team" {
+			fmt.Fprint(w, `{"data": {"organization": {"team": null}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data": {"organization": {"team": {"reviewRequestDelegationEnabled": true, "reviewRequestDelegationAlgorithm": "ROUND_ROBIN", "reviewRequestDelegationMemberCount": 2, "reviewRequestDelegationNotifyTeam": true}}}}`)
+	})
+	routing, err := NewService(testclient).TeamRouting(context.TODO(), "@example/team")
+	if err != nil || routing != (TeamRouting{Enabled: true, Algorithm: RoutingRoundRobin, MemberCount: 2, NotifyTeam: true}) {
+		t.Errorf("Expected the settings of the team got %+v and %v", routing, err)
+	}
+	if _, err := NewService(testclient).TeamRouting(context.TODO(), "@example/other"); !errors.Is(err, ErrTeamNotFound) {
+		t.Errorf("Expected a missing team to be unknown got %v", err)
+	}
+	expected := map[RoutingMode]string{
+		RoutingIgnore:   "joe ann/",
+		RoutingDelegate: "ann/team",
+		RoutingEmulate:  "joe juan ann/team",
+	}
+	for mode, request := range expected {
+		requests = nil
+		if _, errs := AssignReviewers(context.TODO(), testclient, "example", "repo", 1, AssignOptions{Routing: mode}); len(errs) != 0 {
+			t.Fatal("Expect to get no error; got ", errs)
+		}
+		if strings.Join(requests, ",") != request {
+			t.Errorf("Expected mode %v to ask %v got %v", mode, request, requests)
+		}
+	}
+}
+
+func TestMinApprovals(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @juan\n/payments/ @example/team # min-approvals: 2\n"))
+	pullresponder([]string{"main.go", "payments/charge.rb"}, `[{"user": {"login": "joe"}, "state": "APPROVED"}, {"user": {"login": "juan"}, "state": "APPROVED"}]`)
+	co, _ := Get(context.TODO(), testclient, "example", "repo")
+	if co.Rules()[0].MinApprovals() != 0 || co.Rules()[1].MinApprovals() != 2 {
+		t.Errorf("Expected only /payments/ to need more approvals got %v and %v", co.Rules()[0].MinApprovals(), co.Rules()[1].MinApprovals())
+	}
+	summary, errs := co.ApprovalStatus(context.TODO(), 1)
+	if len(errs) != 0 || !summary.Approved || summary.Satisfied[1].Required != 2 {
+		t.Errorf("Expected two members of the team to satisfy /payments/ got %+v and %v", summary, errs)
+	}
+	var result []string
+	for _, diagnostic := range ParseString("/payments/ @example/team # min-approvals: two\n# min-approvals: 0\nsrc/ @juan\n").Validate() {
+		result = append(result, fmt.Sprintf("%v:%v", diagnostic.Line, diagnostic.Code))
+	}
+	if strings.Join(result, ",") != "1:CO008,3:CO008" {
+		t.Errorf("Expected the bad annotations to be reported got %v", result)
+	}
+}
+
+func TestForCompare(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/compare/v1.0...release", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "ahead", "files": [{"filename": "docs/guide.md"}, {"filename": "test/a.txt"}, {"filename": "main.go"}, {"filename": "readme.md"}]}`)
+	})
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != "v1.0" {
+			http.NotFound(w, r)
+			return
+		}
+		fakeresponder("*.go @juan\ntest/** @example/team\ndocs/")(w, r)
+	})
+	result, errs := ForCompare(context.TODO(), testclient, "example", "repo", "v1.0", "release")
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	var users []string
+	for _, user := range result.Users {
+		users = append(users, user.GetLogin())
+	}
+	if len(result.Files) != 3 || strings.Join(result.Owners, ",") != "@example/team,@juan" || strings.Join(users, ",") != "joe,juan" {
+		t.Errorf("Expected the owners of the release diff got %v, %v and %v", result.Files, result.Owners, users)
+	}
+	if _, errs := ForCompare(context.TODO(), testclient, "example", "repo", "v0.9", "release"); len(errs) != 1 {
+		t.Errorf("Expected an unknown comparison to fail got %v", errs)
+	}
+}
+
+func TestForCompareTruncated(t *testing.T) {
+	setup(t)
+	defer teardown()
+	var files []string
+	for idx := 0; idx < 300; idx++ {
+		files = append(files, fmt.Sprintf(`{"filename": "docs/%v.md"}`, idx))
+	}
+	compare := `{"status": "ahead", "merge_base_commit": {"sha": "mb"}, "files": [` + strings.Join(files, ",") + `]}`
+	mux.HandleFunc("/repos/example/repo/compare/v1.0...release", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, compare)
+	})
+	mux.HandleFunc("/repos/example/repo/compare/v1.0...broken", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, compare)
+	})
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("*.go @juan\ntest/** @example/team\ndocs/ @joe"))
+	mux.HandleFunc("/repos/example/repo/git/trees/mb", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tree": [{"path": "docs/0.md", "type": "blob", "sha": "a"}, {"path": "main.go", "type": "blob", "sha": "b"}, {"path": "test/old.txt", "type": "blob", "sha": "c"}]}`)
+	})
+	mux.HandleFunc("/repos/example/repo/git/trees/release", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tree": [{"path": "docs/0.md", "type": "blob", "sha": "a2"}, {"path": "main.go", "type": "blob", "sha": "b"}, {"path": "readme.md", "type": "blob", "sha": "d"}]}`)
+	})
+	result, errs := ForCompare(context.TODO(), testclient, "example", "repo", "v1.0", "release")
+	if len(errs) != 0 {
+		t.Fatal("Expect to get no error; got ", errs)
+	}
+	var paths []string
+	for path := range result.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	if strings.Join(paths, ",") != "docs/0.md,test/old.txt" || strings.Join(result.Owners, ",") != "@joe,@example/team" {
+		t.Errorf("Expected the owners of the tree diff got %v and %v", paths, result.Owners)
+	}
+	result, errs = ForCompare(context.TODO(), testclient, "example", "repo", "v1.0", "broken")
+	var warning *Error
+	if len(errs) != 1 || !errors.As(errs[0], &warning) || warning.Code != CodeTruncated || warning.Severity != SeverityWarning {
+		t.Fatalf("Expected a truncation warning got %v", errs)
+	}
+	if len(result.Files) != 300 || strings.Join(result.Owners, ",") != "@joe" {
+		t.Errorf("Expected the owners of the listed files got %v files and %v", len(result.Files), result.Owners)
+	}
+}
+
+func TestOwnersOfPaths(t *testing.T) {
+	co := ParseString("*.go @juan\ndocs/ @joe docs@example.com\ndocs/old/\ntest/** @example/team @Juan\n")
+	diff := "main.go\ndocs/guide.md\n\ndocs/old/notes.txt\ntest/a.go\nreadme.md\n"
+	files, union := co.OwnersOfPaths(strings.Split(diff, "\n"))
+	var result []string
+	for _, file := range files {
+		result = append(result, fmt.Sprintf("%v=%v:%v", file.Path, file.Rule.Line(), strings.Join(file.Owners, " ")))
+	}
+	if strings.Join(result, ",") != "main.go=1:@juan,docs/guide.md=2:@joe docs@example.com,docs/old/notes.txt=3:,test/a.go=4:@example/team @Juan,readme.md=0:" {
+		t.Errorf("Expected the owners of each path got %v", result)
+	}
+	if strings.Join(union, ",") != "@juan,@joe,docs@example.com,@example/team" {
+		t.Errorf("Expected the union of the owners got %v", union)
+	}
+}
+
+func TestMemoBounded(t *testing.T) {
+	co := ParseString("*.go @juan\ndocs/ @joe\n")
+	for idx := 0; idx < maxremembered+100; idx++ {
+		co.RuleFor(fmt.Sprintf("src/file%v.go", idx))
+	}
+	if remembered := len(co.memo.rules); remembered > maxremembered {
+		t.Errorf("Expected at most %v paths to be remembered got %v", maxremembered, remembered)
+	}
+	if rule, ok := co.RuleFor("src/file1.go"); !ok || rule.Line() != 1 {
+		t.Errorf("Expected paths to still match once forgotten got %v", rule)
+	}
+}
+
+func TestProvider(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mux.HandleFunc("/repos/example/repo/contents/CODEOWNERS", fakeresponder("* @juan"))
+	for _, provider := range []Provider{NewService(testclient), NewCachedService(testclient, CacheTTLs{Files: time.Minute})} {
+		co, err := provider.Get(context.TODO(), "example", "repo")
+		if err != nil || strings.Join(co.OwnersOf("main.go"), " ") != "@juan" {
+			t.Errorf("Expected %T to read the file got %v %v", provider, co.Rules(), err)
+		}
+	}
+}
+
+func TestCacheScopes(t *testing.T) {
+	setup(t)
+	defer teardown()
+	other := http.NewServeMux()
+	other.HandleFunc("/users/juan", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login": "juan", "name": "Other Juan"}`)
+	})
+	otherserver := httptest.NewServer(other)
+	defer otherserver.Close()
+	otherclient := github.NewClient(nil)
+	otherclient.BaseURL, _ = url.Parse(otherserver.URL + "/")
+	cache := NewMemoryCache()
+	name := func(cl *github.Client, scope string) string {
+		result, err := ParseString("* @juan").WithClient(cl).WithCache(cache, time.Minute).WithCacheScope(scope).Lookup(context.TODO(), "x")
+		if err != nil || len(result.Users) != 1 {
+			t.Fatalf("Expected juan got %v %v", result.Users, err)
+		}
+		return result.Users[0].GetName()
+	}
+	if first, second := name(testclient, ""), name(otherclient, ""); first == second || second != "Other Juan" {
+		t.Errorf("Expected each host to have its own users got %v and %v", first, second)
+	}
+	name(testclient, "installation-2")
+	if len(cache.entries) != 3 {
+		t.Errorf("Expected an entry for each host and scope got %v", cache.entries)
+	}
+	for key := range cache.entries {
+		if !strings.HasSuffix(key, " user:juan") || !strings.HasPrefix(key, "http") {
+			t.Errorf("Expected keys scoped by host got %q", key)
+		}
+	}
+	cache.Set("gone", []byte("1"), -time.Second)
+	cache.swept = time.Now().Add(-sweepevery)
+	cache.Set("kept", []byte("1"), time.Minute)
+	if _, ok := cache.entries["gone"]; ok || len(cache.entries) != 4 {
+		t.Errorf("Expected the expired entry to be swept got %v", cache.entries)
+	}
+}
+
+func TestFlightLeaderCanceled(t *testing.T) {
+	flights := newflightgroup()
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	go flights.do(ctx, "user:slow", func() (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	<-started
+	time.AfterFunc(10*time.Millisecond, cancel)
+	value, err := flights.do(context.TODO(), "user:slow", func() (interface{}, error) {
+		return "slow", nil
+	})
+	if err != nil || value != "slow" {
+		t.Errorf("Expected the lookup to be made again when the first caller gave up got %v %v", value, err)
+	}
 }
@@ -0,0 +1,67 @@
+package codeowners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-github/github"
+	"net/url"
+	"sync"
+)
+
+// reported by fetch when the file has the same entity tag as when it was last read
+var errnotmodified = errors.New("not modified")
+
+// fetchstore keeps the last file GetCached read for each repository and set of options
+type fetchstore struct {
+	lock    sync.Mutex
+	fetched map[string]CodeOwners
+}
+
+// GetCached is Get for polling a repository, the file is only read again when github says it has changed
+// since the last GetCached with the same options, which is asked with the file's ETag and costs nothing from
+// the rate limit when it hasn't, in which case the CodeOwners read before is returned, along with the owners
+// it has already resolved, only the file itself is checked so included and aliases files are not read again
+// the files are remembered by the Service made by NewService, and shared by the copies made from it
+func (s *Service) GetCached(ctx context.Context, owner string, repo string, opts ...GetOption) (CodeOwners, error) {
+	options := newgetoptions("CODEOWNERS", opts)
+	if s == nil || s.fetched == nil {
+		return s.get(ctx, owner, repo, options)
+	}
+	key := fmt.Sprintf("%v/%v %+v", owner, repo, options)
+	s.fetched.lock.Lock()
+	previous, ok := s.fetched.fetched[key]
+	s.fetched.lock.Unlock()
+	if ok {
+		options.previous = previous.source
+	}
+	obj, err := s.get(ctx, owner, repo, options)
+	if errors.Is(err, errnotmodified) {
+		return previous, nil
+	}
+	if err == nil {
+		s.fetched.lock.Lock()
+		s.fetched.fetched[key] = obj
+		s.fetched.lock.Unlock()
+	}
+	return obj, err
+}
+
+// reads the file again from where it was found unless it still has the entity tag it had then,
+// github answers 304 Not Modified when it does, which go-github returns as an error with the response
+func (s *Service) fetchchanged(ctx context.Context, owner string, repo string, previous Source) (*github.RepositoryContent, *github.Response, error) {
+	path := fmt.Sprintf("repos/%v/%v/contents/%v", owner, repo, (&url.URL{Path: previous.Path}).String())
+	if previous.Ref != "" {
+		path += "?ref=" + url.QueryEscape(previous.Ref)
+	}
+	content := new(github.RepositoryContent)
+	resp, err := s.call(ctx, "Repositories.GetContents", owner+"/"+repo, func() (*github.Response, error) {
+		req, err := s.client.NewRequest("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("If-None-Match", previous.ETag)
+		return s.client.Do(ctx, req, content)
+	})
+	return content, resp, err
+}
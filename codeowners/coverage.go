@@ -0,0 +1,154 @@
+package codeowners
+
+import (
+	"context"
+	"github.com/bmatcuk/doublestar"
+	"github.com/google/go-github/github"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CoverageOptions control which files FindUnowned counts against ownership coverage
+type CoverageOptions struct {
+	// SkipLinguist leaves out files that .gitattributes marks as linguist-generated or linguist-vendored
+	SkipLinguist bool
+}
+
+// the linguist attributes set or unset by a single line of .gitattributes
+type attributeline struct {
+	pattern string
+	set     map[string]bool
+}
+
+// attributes holds the lines of a .gitattributes file
+type attributes []attributeline
+
+// parses the linguist attributes out of a .gitattributes file, anything else is ignored
+func parseattributes(content string) attributes {
+	var attrs attributes
+	for _, line := range lines(content) {
+		words := strings.Fields(line)
+		if len(words) < 2 || strings.HasPrefix(words[0], "#") {
+			continue
+		}
+		set := make(map[string]bool)
+		for _, word := range words[1:] {
+			name, value := word, true
+			switch {
+			case strings.HasPrefix(word, "-"), strings.HasPrefix(word, "!"):
+				name, value = word[1:], false
+			case strings.Contains(word, "="):
+				split := strings.Index(word, "=")
+				name, value = word[:split], word[split+1:] != "false"
+			}
+			if name == "linguist-generated" || name == "linguist-vendored" {
+				set[name] = value
+			}
+		}
+		if len(set) > 0 {
+			attrs = append(attrs, attributeline{pattern: words[0], set: set})
+		}
+	}
+	return attrs
+}
+
+// matches a gitattributes pattern, which without a slash applies to the file name at any depth
+func attributematch(pattern string, file string) bool {
+	if !strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		match, _ := doublestar.Match(pattern, path.Base(file))
+		return match
+	}
+	match, _ := doublestar.Match(strings.TrimPrefix(pattern, "/"), file)
+	return match
+}
+
+// reports whether linguist treats the file as generated or vendored, the last line to mention an attribute wins
+func (attrs attributes) linguist(file string) bool {
+	generated, vendored := false, false
+	for _, line := range attrs {
+		if !attributematch(line.pattern, file) {
+			continue
+		}
+		if value, ok := line.set["linguist-generated"]; ok {
+			generated = value
+		}
+		if value, ok := line.set["linguist-vendored"]; ok {
+			vendored = value
+		}
+	}
+	return generated || vendored
+}
+
+// fetches the root .gitattributes at ref, a repository without one has no attributes
+func (s *Service) fetchattributes(ctx context.Context, owner string, repo string, ref string) (attributes, error) {
+	var content *github.RepositoryContent
+	_, err := s.call(ctx, "Repositories.GetContents", owner+"/"+repo, func() (resp *github.Response, err error) {
+		content, _, resp, err = s.client.Repositories.GetContents(ctx, owner, repo, ".gitattributes", &github.RepositoryContentGetOptions{Ref: ref})
+		return resp, err
+	})
+	if isnotfound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	text, err := content.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	return parseattributes(text), nil
+}
+
+// FindUnowned lists the files in the tree at ref (or the default branch when ref is empty) that no rule owns,
+// either because no rule matches them or because the rule that does has no owners, trees too large for
+// github to list in one go are walked a directory at a time
+func (co CodeOwners) FindUnowned(ctx context.Context, ref string, opts CoverageOptions) ([]string, error) {
+	ctx = co.operation(ctx)
+	files, err := co.files(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	var attrs attributes
+	if opts.SkipLinguist {
+		attrs, err = co.service.fetchattributes(ctx, co.owner, co.repo, ref)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return co.unowned(files, attrs), nil
+}
+
+// FindUnownedLocal lists the files in a local checkout that no rule owns without calling github
+// files ignored by git through .gitignore are not counted
+func (co CodeOwners) FindUnownedLocal(root string, opts CoverageOptions) ([]string, error) {
+	files, err := localfiles(root)
+	if err != nil {
+		return nil, err
+	}
+	var attrs attributes
+	if opts.SkipLinguist {
+		content, err := ioutil.ReadFile(filepath.Join(root, ".gitattributes"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		attrs = parseattributes(string(content))
+	}
+	return co.unowned(files, attrs), nil
+}
+
+// the files that no rule owns, leaving out those linguist treats as generated or vendored
+func (co CodeOwners) unowned(files []string, attrs attributes) []string {
+	var unowned []string
+	for _, file := range files {
+		if attrs.linguist(file) {
+			continue
+		}
+		if owners := co.ownersfor(file); len(owners) == 0 {
+			unowned = append(unowned, file)
+		}
+	}
+	return unowned
+}
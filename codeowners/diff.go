@@ -0,0 +1,203 @@
+package codeowners
+
+import (
+	"context"
+	"github.com/google/go-github/github"
+	"sort"
+	"strings"
+)
+
+// RuleChange is a pattern whose rule was added, removed or given different owners
+type RuleChange struct {
+	Pattern string `json:"pattern"`
+	// Change is one of added, removed or modified
+	Change string   `json:"change"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+	// Gained and Lost are the owners that now own, or no longer own, the pattern
+	Gained []string `json:"gained,omitempty"`
+	Lost   []string `json:"lost,omitempty"`
+}
+
+// PrefixChange is the owners gained and lost by the rules confined to a directory, so CI can ask for extra
+// approvals when the owners of a sensitive part of the repository change
+type PrefixChange struct {
+	// Prefix is the directory with a trailing slash, or / for rules that can match anywhere in the repository
+	Prefix string   `json:"prefix"`
+	Gained []string `json:"gained,omitempty"`
+	Lost   []string `json:"lost,omitempty"`
+}
+
+// Changes is the difference between two versions of a CODEOWNERS file, it is meant to be
+// marshalled to JSON so CI can ask for extra approvals on risky ownership changes
+type Changes struct {
+	Rules []RuleChange `json:"rules"`
+	// Prefixes are the owners gained and lost under each directory, in order of prefix, an owner moved
+	// between rules under the same directory is neither
+	Prefixes []PrefixChange `json:"prefixes"`
+}
+
+// the owners in one list but not the other, compared case insensitively
+func missing(owners []string, from []string) (gone []string) {
+	present := make(map[string]bool, len(from))
+	for _, ownertext := range from {
+		present[strings.ToLower(ownertext)] = true
+	}
+	for _, ownertext := range owners {
+		if !present[strings.ToLower(ownertext)] {
+			gone = append(gone, ownertext)
+		}
+	}
+	return gone
+}
+
+// the directory a pattern is confined to, the literal parts it starts with, which end at its last slash unless
+// the pattern names a directory, a pattern matched from any directory is confined to the root, /
+func pathprefix(pattern string, mode AnchorMode) string {
+	g := compile(pattern, mode)
+	if !g.anchored {
+		return "/"
+	}
+	var prefix string
+	for idx, part := range g.parts {
+		if !part.literal || (idx == len(g.parts)-1 && !g.dironly) {
+			break
+		}
+		prefix += part.text + "/"
+	}
+	if prefix == "" {
+		return "/"
+	}
+	return prefix
+}
+
+// groups the owners gained and lost by each rule change by the directory of its pattern
+func groupprefixes(rules []RuleChange, prefixes []string) []PrefixChange {
+	gained := make(map[string][]string)
+	lost := make(map[string][]string)
+	var order []string
+	for idx, rule := range rules {
+		prefix := prefixes[idx]
+		if _, ok := gained[prefix]; !ok {
+			order = append(order, prefix)
+			gained[prefix] = nil
+		}
+		gained[prefix] = append(gained[prefix], rule.Gained...)
+		lost[prefix] = append(lost[prefix], rule.Lost...)
+	}
+	sort.Strings(order)
+	grouped := []PrefixChange{}
+	for _, prefix := range order {
+		change := PrefixChange{
+			Prefix: prefix,
+			Gained: distinctowners(missing(gained[prefix], lost[prefix])),
+			Lost:   distinctowners(missing(lost[prefix], gained[prefix])),
+		}
+		if len(change.Gained) > 0 || len(change.Lost) > 0 {
+			grouped = append(grouped, change)
+		}
+	}
+	return grouped
+}
+
+// the effective rule for each pattern, later rules replace earlier ones with the same pattern
+func effective(co CodeOwners) (map[string]CodeOwner, []string) {
+	rules := make(map[string]CodeOwner)
+	var order []string
+	for _, pattern := range co.patterns {
+		canonical := canonicalpattern(pattern.path, co.semantics.anchoring)
+		if _, ok := rules[canonical]; !ok {
+			order = append(order, canonical)
+		}
+		rules[canonical] = pattern
+	}
+	return rules, order
+}
+
+// Diff compares two versions of a CODEOWNERS file pattern by pattern, and directory by directory
+// changes are listed in the order of the new file followed by the removed patterns
+func Diff(before CodeOwners, after CodeOwners) Changes {
+	changes := Changes{Rules: []RuleChange{}}
+	// the directory of each rule change's pattern, under the anchoring of the file it is from
+	var prefixes []string
+	old, oldorder := effective(before)
+	updated, neworder := effective(after)
+	for _, canonical := range neworder {
+		rule := updated[canonical]
+		previous, ok := old[canonical]
+		switch {
+		case !ok:
+			changes.Rules = append(changes.Rules, RuleChange{
+				Pattern: rule.path,
+				Change:  "added",
+				After:   rule.owners,
+				Gained:  rule.owners,
+			})
+			prefixes = append(prefixes, pathprefix(rule.path, after.semantics.anchoring))
+		case ownerset(previous.owners) != ownerset(rule.owners):
+			changes.Rules = append(changes.Rules, RuleChange{
+				Pattern: rule.path,
+				Change:  "modified",
+				Before:  previous.owners,
+				After:   rule.owners,
+				Gained:  missing(rule.owners, previous.owners),
+				Lost:    missing(previous.owners, rule.owners),
+			})
+			prefixes = append(prefixes, pathprefix(rule.path, after.semantics.anchoring))
+		}
+	}
+	for _, canonical := range oldorder {
+		if _, ok := updated[canonical]; ok {
+			continue
+		}
+		rule := old[canonical]
+		changes.Rules = append(changes.Rules, RuleChange{
+			Pattern: rule.path,
+			Change:  "removed",
+			Before:  rule.owners,
+			Lost:    rule.owners,
+		})
+		prefixes = append(prefixes, pathprefix(rule.path, before.semantics.anchoring))
+	}
+	changes.Prefixes = groupprefixes(changes.Rules, prefixes)
+	return changes
+}
+
+// fetches a version of the CODEOWNERS file, a missing file is treated as an empty one
+func (s *Service) fetchversion(ctx context.Context, owner string, repo string, ref string) (CodeOwners, error) {
+	obj := CodeOwners{owner: owner, repo: repo, service: s}
+	content, _, err := s.fetch(ctx, owner, repo, newgetoptions("CODEOWNERS", []GetOption{WithRef(ref)}))
+	if isnotfound(err) {
+		return obj, nil
+	}
+	if err != nil {
+		return obj, err
+	}
+	obj.patterns = parse(content)
+	obj.document = newdocument(content)
+	return obj, nil
+}
+
+// DiffPullRequest is shorthand for NewService(cl).DiffPullRequest
+func DiffPullRequest(ctx context.Context, cl *github.Client, owner string, repo string, number int) (Changes, error) {
+	return NewService(cl).DiffPullRequest(ctx, owner, repo, number)
+}
+
+// DiffPullRequest compares the CODEOWNERS file between the base and the head of a pull request
+func (s *Service) DiffPullRequest(ctx context.Context, owner string, repo string, number int) (Changes, error) {
+	ctx = withrepo(s.operation(ctx), owner, repo)
+	pull, err := s.pullrequest(ctx, owner, repo, number)
+	if err != nil {
+		return Changes{}, err
+	}
+	before, err := s.fetchversion(ctx, owner, repo, pull.GetBase().GetSHA())
+	if err != nil {
+		return Changes{}, err
+	}
+	head := pull.GetHead().GetRepo()
+	after, err := s.fetchversion(ctx, head.GetOwner().GetLogin(), head.GetName(), pull.GetHead().GetSHA())
+	if err != nil {
+		return Changes{}, err
+	}
+	return Diff(before, after), nil
+}
@@ -0,0 +1,89 @@
+package codeowners
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// the format of the files a DiskCache writes, files of any other version are treated as missing
+// so a cache directory shared by jobs running different releases never mixes formats
+const diskcacheversion = 1
+
+// DiskCache is a Cache kept as files in a directory, so lookups survive the process, eg a cache directory
+// shared by CI jobs, it is safe for concurrent use including by several processes sharing the directory
+type DiskCache struct {
+	dir string
+}
+
+// an entry as it is written to disk, the key is kept to tell apart keys whose hashes collide
+type diskentry struct {
+	Version int
+	Key     string
+	Expires time.Time
+	Value   []byte
+}
+
+// NewDiskCache returns a DiskCache keeping its files in dir, which is created when it does not exist
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// the file an entry is kept in, keys are hashed as they are not safe file names
+func (dc *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dc.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get returns the value for the key if it was set and has not expired, expired files are removed
+func (dc *DiskCache) Get(key string) ([]byte, bool) {
+	path := dc.path(key)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var entry diskentry
+	if json.Unmarshal(content, &entry) != nil || entry.Version != diskcacheversion || entry.Key != key {
+		return nil, false
+	}
+	if time.Now().After(entry.Expires) {
+		os.Remove(path)
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+// Set keeps the value for the key for ttl, the file is written whole and then renamed into place
+// so that a job reading it at the same time never sees half of it, failures to write are ignored
+// as the value is simply looked up again
+func (dc *DiskCache) Set(key string, value []byte, ttl time.Duration) {
+	content, err := json.Marshal(diskentry{Version: diskcacheversion, Key: key, Expires: time.Now().Add(ttl), Value: value})
+	if err != nil {
+		return
+	}
+	file, err := os.CreateTemp(dc.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = file.Write(content)
+	if closeerr := file.Close(); err == nil {
+		err = closeerr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), dc.path(key))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+}
+
+// Delete removes the value for the key
+func (dc *DiskCache) Delete(key string) {
+	os.Remove(dc.path(key))
+}
@@ -0,0 +1,31 @@
+// Copyright 2017 The go-github-codeowners AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package codeowners finds the github users that own paths in a repository according to its CODEOWNERS file.
+
+A Service holds the client, and its With methods the options, so that several clients, or several
+github hosts, can be used at once. Get fetches and parses the file from the root, docs/ or .github/
+directory of a repository and Lookup resolves the owners of a path, expanding teams into their members:
+
+	svc := codeowners.NewService(client)
+	owners, err := svc.Get(ctx, "example", "repo")
+	result, err := owners.Lookup(ctx, "src/main.go")
+
+when some owners can't be resolved result.Users still holds the rest, result.Partial is set and err
+joins the reasons, which errors.Is and CodeOf see through to the individual errors
+
+Code that only reads files should take a Provider, which both Service and CachedService are.
+The package level Get and GetNotify are kept as shorthand for NewService(client).Get.
+
+Parse and ParseString read a file without any api calls, WithClient adds a client for resolving owners later.
+
+Everything else in the package builds on those two calls: pull request approval, coverage of the
+repository tree, linting the rules and org wide scans.
+
+The module follows semantic versioning from v1, exported identifiers are not removed or changed
+incompatibly within a major version, replaced APIs are kept working and marked Deprecated.
+*/
+package codeowners
@@ -0,0 +1,173 @@
+package codeowners
+
+import (
+	"strings"
+)
+
+// a copy of the code owners that can be changed without affecting the original
+// the rules and text are copied and the memo is replaced as rules may move
+func (co CodeOwners) edited() CodeOwners {
+	if co.document.lines == nil {
+		co.document = newdocument(co.String())
+		patterns := make([]CodeOwner, len(co.patterns))
+		for idx, pattern := range co.patterns {
+			pattern.line = idx + 1
+			patterns[idx] = pattern
+		}
+		co.patterns = patterns
+	}
+	patterns := make([]CodeOwner, len(co.patterns))
+	for idx, pattern := range co.patterns {
+		pattern.owners = append([]string(nil), pattern.owners...)
+		patterns[idx] = pattern
+	}
+	co.patterns = patterns
+	co.document.lines = append([]string(nil), co.document.lines...)
+	co.memo = &memo{rules: make(map[string]int)}
+	return co
+}
+
+// rewrites the owners on a line of the file, leaving the pattern, spacing and any comment as they were
+func rewriteline(line string, owners []string) string {
+	rule, _ := splitcomment(line)
+	comment := line[len(rule):]
+	trimmed := strings.TrimRight(rule, " \t")
+	trailing := rule[len(trimmed):]
+	start := len(trimmed) - len(strings.TrimLeft(trimmed, " \t"))
+	end := start + strings.IndexAny(trimmed[start:]+" ", " \t")
+	separator := " "
+	if rest := trimmed[end:]; rest != "" {
+		separator = rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+	}
+	if len(owners) == 0 {
+		separator = ""
+	}
+	return trimmed[:end] + separator + strings.Join(owners, " ") + trailing + comment
+}
+
+// writes the owners of a rule back onto its line
+func (co CodeOwners) setowners(idx int, owners []string) {
+	co.patterns[idx].owners = owners
+	line := co.patterns[idx].line - 1
+	co.document.lines[line] = rewriteline(co.document.lines[line], owners)
+}
+
+// takes a rule out of the file along with its line, the rules below it move up a line
+func (co CodeOwners) removerule(idx int) CodeOwners {
+	line := co.patterns[idx].line - 1
+	co.document.lines = append(co.document.lines[:line], co.document.lines[line+1:]...)
+	co.patterns = append(co.patterns[:idx], co.patterns[idx+1:]...)
+	for later := idx; later < len(co.patterns); later++ {
+		if co.patterns[later].file == "" {
+			co.patterns[later].line--
+		}
+	}
+	return co
+}
+
+// AddRule returns a copy of the code owners with a new rule at the end of the file, where it takes precedence
+func (co CodeOwners) AddRule(pattern string, owners ...string) CodeOwners {
+	co = co.edited()
+	rule := CodeOwner{path: pattern, owners: append([]string(nil), owners...)}
+	// a file ending in a newline keeps it after the new rule
+	at := len(co.document.lines)
+	if at > 0 && co.document.lines[at-1] == "" {
+		at--
+	}
+	rule.line = at + 1
+	co.document.lines = append(co.document.lines[:at], append([]string{rule.String()}, co.document.lines[at:]...)...)
+	if rule.path == "*" {
+		rule.path = "**"
+	}
+	rule.globs = compileall(rule.path)
+	// the rule ends up in the last section of the file
+	for idx := len(co.patterns) - 1; idx >= 0; idx-- {
+		if co.patterns[idx].file == "" {
+			rule.section = co.patterns[idx].section
+			break
+		}
+	}
+	co.patterns = append(co.patterns, rule)
+	return co
+}
+
+// AddOwner returns a copy of the code owners with the owner added to the last rule written with the pattern
+// a rule is added at the end of the file when there is no such rule
+func (co CodeOwners) AddOwner(pattern string, owner string) CodeOwners {
+	written := pattern
+	if written == "*" {
+		written = "**"
+	}
+	for idx := len(co.patterns) - 1; idx >= 0; idx-- {
+		if co.patterns[idx].path != written || co.patterns[idx].file != "" {
+			continue
+		}
+		for _, ownertext := range co.patterns[idx].owners {
+			if strings.EqualFold(ownertext, owner) {
+				return co
+			}
+		}
+		co = co.edited()
+		co.setowners(idx, append(co.patterns[idx].owners, owner))
+		return co
+	}
+	return co.AddRule(pattern, owner)
+}
+
+// RemoveOwner returns a copy of the code owners without the owner on any rule, owners are compared ignoring case
+// a rule left without owners is removed too, as a rule with no owners would clear ownership instead
+func (co CodeOwners) RemoveOwner(owner string) CodeOwners {
+	co = co.edited()
+	for idx := len(co.patterns) - 1; idx >= 0; idx-- {
+		if co.patterns[idx].file != "" {
+			continue
+		}
+		var kept []string
+		for _, ownertext := range co.patterns[idx].owners {
+			if !strings.EqualFold(ownertext, owner) {
+				kept = append(kept, ownertext)
+			}
+		}
+		switch {
+		case len(kept) == len(co.patterns[idx].owners):
+		case len(kept) == 0:
+			co = co.removerule(idx)
+		default:
+			co.setowners(idx, kept)
+		}
+	}
+	return co
+}
+
+// RenameOwner returns a copy of the code owners with one owner replaced by another on every rule,
+// eg replacing @alice with @org/platform, owners are compared ignoring case
+func (co CodeOwners) RenameOwner(from string, to string) CodeOwners {
+	co = co.edited()
+	for idx, pattern := range co.patterns {
+		if pattern.file != "" {
+			continue
+		}
+		var renamed []string
+		changed, present := false, false
+		for _, ownertext := range pattern.owners {
+			if strings.EqualFold(ownertext, to) && !strings.EqualFold(ownertext, from) {
+				present = true
+			}
+		}
+		for _, ownertext := range pattern.owners {
+			switch {
+			case !strings.EqualFold(ownertext, from):
+				renamed = append(renamed, ownertext)
+			case !present:
+				renamed = append(renamed, to)
+				present, changed = true, true
+			default:
+				changed = true
+			}
+		}
+		if changed {
+			co.setowners(idx, renamed)
+		}
+	}
+	return co
+}
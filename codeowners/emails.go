@@ -0,0 +1,70 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/github"
+	"log"
+	"net/mail"
+)
+
+// WithEmailLookup returns a copy of the code owners that searches github for the account behind each email
+// owner, first among the users who show the address on their profile and then among the authors of commits
+// made with it, an address that can't be found is still returned as a user with only the email set
+func (co CodeOwners) WithEmailLookup() CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.expansion.emails = true
+	})
+}
+
+// takes an email owner and sends the github user it belongs to to the workers
+// falling back to a user with only the email set when search can't find one
+func (s *Service) findemail(email string, ctx context.Context, w *workers) {
+	address, err := mail.ParseAddress(email)
+	login := ""
+	if err == nil && !s.hurried(ctx) {
+		login = s.searchemail(ctx, address.Address)
+	}
+	if login == "" {
+		finduseremail(email, ctx, w)
+		return
+	}
+	s.fetchuser(login, email, ctx, w)
+}
+
+// the login of the account using an email address, or empty when search turns up nothing certain
+// failed searches are logged rather than returned as the owner can still be given by email
+func (s *Service) searchemail(ctx context.Context, address string) string {
+	key := cachekey("email", address)
+	var login string
+	if s.cached(ctx, key, &login) {
+		return login
+	}
+	var users *github.UsersSearchResult
+	_, err := s.call(ctx, "Search.Users", repoof(ctx), func() (resp *github.Response, err error) {
+		users, resp, err = s.client.Search.Users(ctx, fmt.Sprintf("%v in:email", address), nil)
+		return resp, err
+	})
+	if err != nil {
+		log.Print("Error searching for the user with email ", address, " ", err)
+		return ""
+	}
+	if len(users.Users) == 1 {
+		login = users.Users[0].GetLogin()
+	} else {
+		var commits *github.CommitsSearchResult
+		_, err := s.call(ctx, "Search.Commits", repoof(ctx), func() (resp *github.Response, err error) {
+			commits, resp, err = s.client.Search.Commits(ctx, "author-email:"+address, &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 1}})
+			return resp, err
+		})
+		if err != nil {
+			log.Print("Error searching for commits by email ", address, " ", err)
+			return ""
+		}
+		if len(commits.Commits) > 0 {
+			login = commits.Commits[0].GetAuthor().GetLogin()
+		}
+	}
+	s.store(key, login)
+	return login
+}
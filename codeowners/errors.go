@@ -0,0 +1,225 @@
+package codeowners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-github/github"
+	"net/http"
+)
+
+// Code is a stable identifier for a class of failure, codes never change meaning so tooling and
+// dashboards can classify failures without parsing messages
+type Code string
+
+// the failure classes
+const (
+	// CodeUnknownOwner is an owner that does not exist on github, eg a deleted user or renamed team
+	CodeUnknownOwner Code = "CO001"
+	// CodeInvalidOwner is an owner that is not a @login, @org/team or email address
+	CodeInvalidOwner Code = "CO002"
+	// CodeMissingOwners is a rule without any owners, which is valid and clears ownership so it is only a warning
+	CodeMissingOwners Code = "CO003"
+	// CodeNegation is a rule using ! negation, which github does not support
+	CodeNegation Code = "CO004"
+	// CodeInvalidPattern is a pattern that is not a valid glob, eg an unclosed [
+	CodeInvalidPattern Code = "CO005"
+	// CodeInvalidAliases is an OWNERS_ALIASES file that could not be read
+	CodeInvalidAliases Code = "CO006"
+	// CodeInvalidInclude is an #!include directive that names a file that could not be read or that includes itself
+	CodeInvalidInclude Code = "CO007"
+	// CodeInvalidAnnotation is a min-approvals annotation that is not a whole number of at least one
+	CodeInvalidAnnotation Code = "CO008"
+	// CodeNoMatch is a path that no rule matches
+	CodeNoMatch Code = "CO010"
+	// CodeNoCodeowners is a repository without a CODEOWNERS file
+	CodeNoCodeowners Code = "CO011"
+	// CodeUnowned is a path whose matching rule has no owners, which github treats as needing no owner
+	CodeUnowned Code = "CO012"
+	// CodeRateLimited is a request refused by the github rate limits, including the abuse limits
+	CodeRateLimited Code = "CO020"
+	// CodeAccessDenied is a request the credentials are not allowed to make
+	CodeAccessDenied Code = "CO021"
+	// CodeNotFound is some other github resource that does not exist
+	CodeNotFound Code = "CO022"
+	// CodeAPI is any other failure talking to github
+	CodeAPI Code = "CO023"
+	// CodeConflict is a change refused because the file changed on github since it was read
+	CodeConflict Code = "CO024"
+	// CodeCircuitOpen is a request that was never made because too many before it failed, see WithCircuitBreaker
+	CodeCircuitOpen Code = "CO025"
+	// CodeBudgetExceeded is a request that was never made because the operation had made as many as it may, see WithMaxAPIRequests
+	CodeBudgetExceeded Code = "CO026"
+	// CodeTruncated is a listing github cut short, so that what was worked out from it may be incomplete
+	CodeTruncated Code = "CO027"
+	// CodeCanceled is an operation stopped by its context being canceled or reaching its deadline
+	CodeCanceled Code = "CO030"
+	// CodeDuplicateRule is a rule written again later with the same pattern and owners, so it can be deleted
+	CodeDuplicateRule Code = "CO040"
+	// CodeConflictingRule is a rule written again later with the same pattern but other owners, see Conflicts
+	CodeConflictingRule Code = "CO041"
+	// CodeShadowedRule is a rule that a broader rule below it always overrides, see ShadowedRules
+	CodeShadowedRule Code = "CO042"
+	// CodeUnmatchedRule is a rule whose pattern matches no file in the tree, usually a typo, see UnmatchedRules
+	CodeUnmatchedRule Code = "CO043"
+)
+
+// sentinel errors for use with errors.Is, every Error with the matching Code is one of these
+var (
+	ErrNoCodeowners     = errors.New("no CODEOWNERS file")
+	ErrInvalidOwnerSpec = errors.New("invalid owner specification")
+	ErrNoMatch          = errors.New("no rule matches")
+	ErrUnowned          = errors.New("unowned by rule")
+	ErrRateLimited      = errors.New("rate limited")
+	ErrAccessDenied     = errors.New("access denied")
+	ErrCanceled         = errors.New("canceled")
+	ErrConflict         = errors.New("changed since it was read")
+	ErrCircuitOpen      = errors.New("circuit breaker open")
+	ErrBudgetExceeded   = errors.New("api request budget exceeded")
+)
+
+// unknown owners share CodeUnknownOwner so these are wrapped by the Error rather than found by Code
+var (
+	ErrTeamNotFound = errors.New("team not found")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// the sentinel each Code is reported as by errors.Is
+var sentinels = map[Code]error{
+	CodeNoCodeowners:   ErrNoCodeowners,
+	CodeInvalidOwner:   ErrInvalidOwnerSpec,
+	CodeNoMatch:        ErrNoMatch,
+	CodeUnowned:        ErrUnowned,
+	CodeRateLimited:    ErrRateLimited,
+	CodeAccessDenied:   ErrAccessDenied,
+	CodeCanceled:       ErrCanceled,
+	CodeConflict:       ErrConflict,
+	CodeCircuitOpen:    ErrCircuitOpen,
+	CodeBudgetExceeded: ErrBudgetExceeded,
+}
+
+// Severity is how serious a problem is
+type Severity string
+
+// the severities, an Error without one is SeverityError
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Error is a failure carrying a stable Code, the underlying error (if any) is available through Unwrap
+type Error struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+	// Line is the line of the CODEOWNERS file the error was found on, zero when it is not about a line
+	Line int `json:"line,omitempty"`
+	// Column is where on the line the problem starts, counting from 1, zero when it is not about a line
+	Column   int      `json:"column,omitempty"`
+	Severity Severity `json:"severity,omitempty"`
+	Err      error    `json:"-"`
+}
+
+// Error formats the message, prefixed with its line
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %v: %v", e.Line, e.Message)
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is the sentinel for the Code of the error
+func (e *Error) Is(target error) bool {
+	sentinel, ok := sentinels[e.Code]
+	return ok && sentinel == target
+}
+
+// reports whether an error, however it was wrapped, is github answering 404
+func isnotfound(err error) bool {
+	var response *github.ErrorResponse
+	return errors.As(err, &response) && response.Response != nil && response.Response.StatusCode == http.StatusNotFound
+}
+
+// classifies an error from the github api, notfound is the code to use for a 404
+// as what was not found decides what it means, eg a missing user is an unknown owner
+func apicode(err error, notfound Code) Code {
+	var ratelimit *github.RateLimitError
+	var abuse *github.AbuseRateLimitError
+	var response *github.ErrorResponse
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return CodeCanceled
+	case errors.As(err, &ratelimit), errors.As(err, &abuse):
+		return CodeRateLimited
+	case errors.As(err, &response) && secondarylimit(response):
+		return CodeRateLimited
+	case errors.As(err, &response) && response.Response != nil:
+		switch response.Response.StatusCode {
+		case http.StatusNotFound:
+			return notfound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return CodeAccessDenied
+		}
+	}
+	return CodeAPI
+}
+
+// wraps an error from the github api into an Error with its code
+func apierror(err error, notfound Code) error {
+	var coded *Error
+	if err == nil || errors.As(err, &coded) {
+		return err
+	}
+	return &Error{Code: apicode(err, notfound), Message: err.Error(), Err: err}
+}
+
+// the error for an owner that does not exist, sentinel is ErrUserNotFound or ErrTeamNotFound
+// the cause, if any, is wrapped too so the go-github error is still available to errors.As
+func unknownowner(message string, sentinel error, cause error) *Error {
+	err := &Error{Code: CodeUnknownOwner, Message: message, Err: sentinel}
+	if cause != nil {
+		err.Err = fmt.Errorf("%w: %w", sentinel, cause)
+	}
+	return err
+}
+
+// the error for an owner that needs github to resolve when there is no client, eg after Parse
+func noclient(ownertext string) error {
+	return &Error{Code: CodeAPI, Message: fmt.Sprintf("No github client to resolve %v with", ownertext)}
+}
+
+// the error for an api request when there is no client, eg a method that needs github called on a file from Parse
+func nocall(operation string) error {
+	return &Error{Code: CodeAPI, Message: fmt.Sprintf("No github client to call %v with", operation)}
+}
+
+// the error for an expansion the context stopped before it finished, it wraps ctx.Err()
+func canceled(err error) error {
+	return &Error{Code: CodeCanceled, Message: fmt.Sprintf("Stopped expanding owners: %v", err), Err: err}
+}
+
+// the error for a path that a rule without owners matches
+func unowned(path string, rule CodeOwner) error {
+	return &Error{Code: CodeUnowned, Message: fmt.Sprintf("%v is unowned by %v", path, rule.path), Line: rule.line}
+}
+
+// the error for a path that no rule matches
+func nomatch() error {
+	return &Error{Code: CodeNoMatch, Message: "Failed to find match"}
+}
+
+// CodeOf finds the Code of any error the package returns, errors straight from go-github are classified too
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	return apicode(err, CodeNotFound)
+}
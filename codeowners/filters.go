@@ -0,0 +1,55 @@
+package codeowners
+
+import (
+	"github.com/google/go-github/github"
+	"strings"
+)
+
+// ResolutionFilter reports whether a user that an owner was resolved into should be left out
+type ResolutionFilter func(user *github.User) bool
+
+// ExcludeBots leaves out app accounts such as dependabot[bot], which teams sometimes include
+var ExcludeBots ResolutionFilter = func(user *github.User) bool {
+	return user.GetType() == "Bot" || strings.HasSuffix(user.GetLogin(), "[bot]")
+}
+
+// ExcludeSuspended leaves out users suspended on github enterprise, which is only known once their
+// profile has been fetched, so a user returned with just a login is kept
+var ExcludeSuspended ResolutionFilter = func(user *github.User) bool {
+	return user.SuspendedAt != nil
+}
+
+// WithFilters returns a copy of the code owners that leaves out the users any of the filters exclude
+// when owners are resolved, eg WithFilters(ExcludeBots, ExcludeSuspended) for reviewer suggestions
+func (co CodeOwners) WithFilters(filters ...ResolutionFilter) CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.expansion.filters = append(append([]ResolutionFilter(nil), s.expansion.filters...), filters...)
+	})
+}
+
+// reports whether any of the filters leaves the user out
+func (s *Service) excluded(user *github.User) bool {
+	if s == nil || user == nil {
+		return false
+	}
+	for _, filter := range s.expansion.filters {
+		if filter(user) {
+			return true
+		}
+	}
+	return false
+}
+
+// the resolutions whose users the filters keep
+func (s *Service) filtered(resolutions []Resolution) []Resolution {
+	if s == nil || len(s.expansion.filters) == 0 {
+		return resolutions
+	}
+	kept := resolutions[:0]
+	for _, resolution := range resolutions {
+		if !s.excluded(resolution.User) {
+			kept = append(kept, resolution)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,65 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// a lookup that is in progress, the goroutines asking for the same key wait for it
+type flightcall struct {
+	// ctx is the context of the goroutine making the call
+	ctx   context.Context
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// flightgroup makes sure identical lookups only reach github once while one is in flight, so rules that
+// name the same team or user don't fetch it several times over when they are expanded concurrently
+type flightgroup struct {
+	lock  sync.Mutex
+	calls map[string]*flightcall
+}
+
+// a flightgroup with nothing in flight
+func newflightgroup() *flightgroup {
+	return &flightgroup{calls: make(map[string]*flightcall)}
+}
+
+// calls fetch unless a call for the key is already in flight, in which case its result is shared
+// a goroutine waiting on another's call stops waiting when its own context ends, and makes the call
+// itself when the other's context ended first, rather than sharing an error that isn't its own
+func (fg *flightgroup) do(ctx context.Context, key string, fetch func() (interface{}, error)) (interface{}, error) {
+	fg.lock.Lock()
+	for call, ok := fg.calls[key]; ok; call, ok = fg.calls[key] {
+		fg.lock.Unlock()
+		select {
+		case <-call.done:
+			if call.err == nil || call.ctx.Err() == nil || ctx.Err() != nil {
+				return call.value, call.err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		fg.lock.Lock()
+	}
+	call := &flightcall{ctx: ctx, done: make(chan struct{})}
+	fg.calls[key] = call
+	fg.lock.Unlock()
+	call.value, call.err = fetch()
+	fg.lock.Lock()
+	delete(fg.calls, key)
+	fg.lock.Unlock()
+	close(call.done)
+	return call.value, call.err
+}
+
+// calls fetch unless the same lookup is in flight for a copy of the service, the key includes the client
+// so copies with different credentials are kept apart
+func (s *Service) flight(ctx context.Context, key string, fetch func() (interface{}, error)) (interface{}, error) {
+	if s == nil || s.flights == nil {
+		return fetch()
+	}
+	return s.flights.do(ctx, fmt.Sprintf("%p:%v", s.client, key), fetch)
+}
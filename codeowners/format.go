@@ -0,0 +1,101 @@
+package codeowners
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// document is the text of a file as it was read, kept so it can be written back without losing
+// comments, blank lines or alignment, rules point into it by their line number
+type document struct {
+	lines []string
+	crlf  bool
+	bom   bool
+}
+
+// keeps the text of a file along with its line endings and byte order mark
+func newdocument(content string) document {
+	return document{
+		lines: lines(content),
+		crlf:  strings.Contains(content, "\r\n"),
+		bom:   strings.HasPrefix(content, "\ufeff"),
+	}
+}
+
+// WriteTo writes the file back out exactly as it was read, comments, spacing and line endings included
+// code owners that were not read from a file are written in their String form
+func (co CodeOwners) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	switch {
+	case co.document.lines == nil:
+		buf.WriteString(co.String())
+	default:
+		if co.document.bom {
+			buf.WriteString("\ufeff")
+		}
+		newline := "\n"
+		if co.document.crlf {
+			newline = "\r\n"
+		}
+		buf.WriteString(strings.Join(co.document.lines, newline))
+	}
+	return buf.WriteTo(w)
+}
+
+// Format renders the file in a canonical form, in the way gofmt does for go source
+// comments are kept, runs of blank lines become one, the owners of consecutive rules are lined up
+// in a column and the file ends in a single newline
+func (co CodeOwners) Format() string {
+	text := co.document.lines
+	if text == nil {
+		text = lines(co.String())
+	}
+	var out bytes.Buffer
+	// a blank line is owed before whatever is written next
+	pending := false
+	emit := func(line string) {
+		if pending && out.Len() > 0 {
+			out.WriteString("\n")
+		}
+		pending = false
+		out.WriteString(line + "\n")
+	}
+	var block [][3]string
+	// writes out a run of consecutive rules with their owners aligned
+	flush := func() {
+		width := 0
+		for _, rule := range block {
+			if len(rule[0]) > width {
+				width = len(rule[0])
+			}
+		}
+		for _, rule := range block {
+			line := rule[0]
+			if rule[1] != "" {
+				line += strings.Repeat(" ", width-len(rule[0])+1) + rule[1]
+			}
+			if rule[2] != "" {
+				line += " # " + rule[2]
+			}
+			emit(line)
+		}
+		block = nil
+	}
+	for _, line := range text {
+		rule, comment := splitcomment(line)
+		words := strings.Fields(rule)
+		switch {
+		case len(words) > 0:
+			block = append(block, [3]string{words[0], strings.Join(words[1:], " "), comment})
+		case strings.TrimSpace(line) == "":
+			flush()
+			pending = true
+		default:
+			flush()
+			emit(strings.TrimSpace(line))
+		}
+	}
+	flush()
+	return out.String()
+}
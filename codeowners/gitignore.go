@@ -0,0 +1,114 @@
+package codeowners
+
+import (
+	"github.com/bmatcuk/doublestar"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// a single pattern from a .gitignore file
+type ignorerule struct {
+	// base is the directory holding the .gitignore relative to the root, empty for the root itself
+	base     string
+	pattern  string
+	negate   bool
+	dironly  bool
+	anchored bool
+}
+
+// parses a .gitignore file found in the base directory
+func parseignore(content string, base string) (rules []ignorerule) {
+	for _, line := range lines(content) {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignorerule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		if strings.HasSuffix(line, "/") {
+			rule.dironly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// reports whether the rule applies to a path relative to the root
+// patterns without a slash apply to the name at any depth below the .gitignore
+func (rule ignorerule) match(rel string, isdir bool) bool {
+	if rule.dironly && !isdir {
+		return false
+	}
+	if rule.base != "" {
+		if !strings.HasPrefix(rel, rule.base+"/") {
+			return false
+		}
+		rel = rel[len(rule.base)+1:]
+	}
+	if !rule.anchored {
+		rel = path.Base(rel)
+	}
+	match, _ := doublestar.Match(rule.pattern, rel)
+	return match
+}
+
+// reports whether git would ignore the path, the last rule to match decides
+func ignored(rules []ignorerule, rel string, isdir bool) bool {
+	ignore := false
+	for _, rule := range rules {
+		if rule.match(rel, isdir) {
+			ignore = !rule.negate
+		}
+	}
+	return ignore
+}
+
+// lists the files in a local checkout relative to its root with slashes as separators
+// the .git directory and anything ignored by the .gitignore files in the tree are left out
+func localfiles(root string) ([]string, error) {
+	var files []string
+	var rules []ignorerule
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		} else if info.Name() == ".git" || ignored(rules, rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			files = append(files, rel)
+			return nil
+		}
+		content, err := ioutil.ReadFile(filepath.Join(name, ".gitignore"))
+		if err == nil {
+			rules = append(rules, parseignore(string(content), rel)...)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,53 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/github"
+	"time"
+)
+
+// Modification is the latest commit to touch the CODEOWNERS file
+type Modification struct {
+	SHA string
+	// Author is the login of the commit author, or their name when the commit is not linked to an account
+	Author string
+	// Date is when the commit was made, its committer date, as rebases and cherry picks keep the author date
+	// of the original so it can be much older than the change to the branch
+	Date time.Time
+}
+
+// LastModified fetches the most recent commit to change the CODEOWNERS file on the ref it was read at, the default
+// branch unless read WithRef, so reports can show how stale a repository's ownership is
+func (co CodeOwners) LastModified(ctx context.Context) (Modification, error) {
+	ctx = co.operation(ctx)
+	opt := github.CommitsListOptions{
+		SHA:         co.source.Ref,
+		Path:        co.source.Path,
+		ListOptions: github.ListOptions{PerPage: 1},
+	}
+	var commits []*github.RepositoryCommit
+	_, err := co.service.call(ctx, "Repositories.ListCommits", co.owner+"/"+co.repo, func() (resp *github.Response, err error) {
+		commits, resp, err = co.service.client.Repositories.ListCommits(ctx, co.owner, co.repo, &opt)
+		return resp, err
+	})
+	if err != nil {
+		return Modification{}, apierror(err, CodeNotFound)
+	}
+	if len(commits) == 0 {
+		return Modification{}, &Error{Code: CodeNotFound, Message: fmt.Sprintf("Failed to find a commit touching %v", co.source.Path)}
+	}
+	commit := commits[0]
+	modification := Modification{
+		SHA:    commit.GetSHA(),
+		Author: commit.GetAuthor().GetLogin(),
+		Date:   commit.GetCommit().GetCommitter().GetDate(),
+	}
+	if modification.Date.IsZero() {
+		modification.Date = commit.GetCommit().GetAuthor().GetDate()
+	}
+	if modification.Author == "" {
+		modification.Author = commit.GetCommit().GetAuthor().GetName()
+	}
+	return modification, nil
+}
@@ -0,0 +1,93 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/github"
+	"strings"
+)
+
+// the comment that pulls the rules of another file in at its place, eg #!include teams/backend.CODEOWNERS
+// github sees it as an ordinary comment, so only this package will apply the included rules
+const includedirective = "#!include"
+
+// Loader returns the content of a file that is included, by its path from the repository root
+type Loader func(path string) (string, error)
+
+// File is the path of the included file the rule was read from, empty for the file itself
+func (co CodeOwner) File() string {
+	return co.file
+}
+
+// the path named by an include directive, if the line is one
+func directive(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, includedirective+" ") {
+		return "", false
+	}
+	return strings.TrimSpace(line[len(includedirective):]), true
+}
+
+// Include returns a copy of the code owners with each #!include directive replaced by the rules of the
+// file it names, which can include others in turn, the included rules take their place in the order of
+// precedence, so a later rule in the including file still overrides them
+// edits only ever change the rules written in the file itself and WriteTo writes that file alone
+func (co CodeOwners) Include(load Loader) (CodeOwners, error) {
+	if co.document.lines == nil {
+		return co, nil
+	}
+	patterns, err := include("", co.document.lines, load, []string{co.source.Path})
+	if err != nil {
+		return co, err
+	}
+	co.patterns = co.sectioned(patterns)
+	co.memo = &memo{rules: make(map[string]int)}
+	return co, nil
+}
+
+// the rules of the lines of a file with the files it includes expanded, chain holds the files that
+// are already being included so that a loop is reported rather than followed forever
+func include(file string, text []string, load Loader, chain []string) ([]CodeOwner, error) {
+	patterns := make([]CodeOwner, 0)
+	for idx, line := range text {
+		path, ok := directive(line)
+		if !ok {
+			if rule, ok := parseline(line); ok {
+				rule.line, rule.file = idx+1, file
+				rule.annotations = annotations(text, idx)
+				patterns = append(patterns, rule)
+			}
+			continue
+		}
+		for _, including := range chain {
+			if strings.TrimPrefix(path, "/") == strings.TrimPrefix(including, "/") {
+				return nil, &Error{Code: CodeInvalidInclude, Message: fmt.Sprintf("%v includes itself through %v", path, strings.Join(chain[1:], ", ")), Line: idx + 1}
+			}
+		}
+		content, err := load(path)
+		if err != nil {
+			return nil, &Error{Code: CodeInvalidInclude, Message: fmt.Sprintf("Could not include %v", path), Line: idx + 1, Err: err}
+		}
+		included, err := include(path, lines(content), load, append(chain, path))
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, included...)
+	}
+	return patterns, nil
+}
+
+// a Loader reading files from the repository at ref
+func (s *Service) loader(ctx context.Context, owner string, repo string, ref string) Loader {
+	return func(path string) (string, error) {
+		var content *github.RepositoryContent
+		_, err := s.call(ctx, "Repositories.GetContents", owner+"/"+repo, func() (resp *github.Response, err error) {
+			content, _, resp, err = s.client.Repositories.GetContents(ctx, owner, repo, strings.TrimPrefix(path, "/"), &github.RepositoryContentGetOptions{Ref: ref})
+			return resp, err
+		})
+		if err != nil {
+			return "", apierror(err, CodeNotFound)
+		}
+		return content.GetContent()
+	}
+}
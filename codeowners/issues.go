@@ -0,0 +1,94 @@
+package codeowners
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// links are removed before scanning so their paths are not mistaken for repository files
+	links = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.\-]*://\S+`)
+	// a path is some directories and a file name, optionally followed by the line (and column) in a stack trace
+	paths = regexp.MustCompile(`/?(?:[A-Za-z0-9_.\-]+/)*[A-Za-z0-9_\-]+\.[A-Za-z][A-Za-z0-9]*(?::\d+)*`)
+	// a position suffix such as :12 or :12:3
+	position = regexp.MustCompile(`(?::\d+)+$`)
+)
+
+// Suggestion is the outcome of scanning an issue for the files it talks about
+type Suggestion struct {
+	// Paths are the repository paths found in the issue
+	Paths []string
+	// Assignees are the logins of the users owning those paths
+	Assignees []string
+	// Labels are the slugs of the teams owning those paths
+	Labels []string
+}
+
+// turns a path found in free text into one relative to the repository root
+// stack traces tend to carry the checkout location so everything up to the repo name is dropped
+func repopath(found string, repo string) string {
+	found = position.ReplaceAllString(found, "")
+	segments := strings.Split(strings.TrimPrefix(found, "/"), "/")
+	for idx := len(segments) - 2; idx >= 0; idx-- {
+		if segments[idx] == repo {
+			return strings.Join(segments[idx+1:], "/")
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// finds the repository paths mentioned in some text
+// bare names need an extension of at least two letters so that "e.g." or "1.2" are not picked up
+func mentionedpaths(text string, repo string) []string {
+	var found []string
+	seen := make(map[string]bool)
+	for _, candidate := range paths.FindAllString(links.ReplaceAllString(text, " "), -1) {
+		path := repopath(candidate, repo)
+		if !strings.Contains(path, "/") && len(path)-strings.LastIndex(path, ".") < 3 {
+			continue
+		}
+		if !seen[path] {
+			seen[path] = true
+			found = append(found, path)
+		}
+	}
+	return found
+}
+
+// SuggestAssignees scans the title and body of an issue for file paths, including those in stack traces,
+// and suggests the owners of those paths as assignees and their teams as labels
+func (co CodeOwners) SuggestAssignees(ctx context.Context, title string, body string) (suggestion Suggestion, error_slice []error) {
+	ctx = co.operation(ctx)
+	assignees := make(map[string]bool)
+	labels := make(map[string]bool)
+	for _, path := range mentionedpaths(title+"\n"+body, co.repo) {
+		owners := co.ownersfor(path)
+		if owners == nil {
+			continue
+		}
+		suggestion.Paths = append(suggestion.Paths, path)
+		for _, ownertext := range owners {
+			if split := strings.Index(ownertext, "/"); strings.HasPrefix(ownertext, "@") && split > 0 {
+				labels[ownertext[split+1:]] = true
+			}
+		}
+		result, errs := co.MatchRule(ctx, path)
+		error_slice = append(error_slice, errs...)
+		for _, user := range result.Users {
+			if user.GetLogin() != "" {
+				assignees[user.GetLogin()] = true
+			}
+		}
+	}
+	for login := range assignees {
+		suggestion.Assignees = append(suggestion.Assignees, login)
+	}
+	for label := range labels {
+		suggestion.Labels = append(suggestion.Labels, label)
+	}
+	sort.Strings(suggestion.Assignees)
+	sort.Strings(suggestion.Labels)
+	return suggestion, error_slice
+}
@@ -0,0 +1,300 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Conflict is a pattern that is written on more than one rule with different owners
+// only the last of those rules ever takes effect, the rest are silently ignored
+type Conflict struct {
+	Pattern string
+	// Rules are the positions of the conflicting rules in file order, counting from zero
+	Rules []int
+	// Lines are the lines of the file each of those rules is on
+	Lines []int
+	// Owners are the owners of each of those rules
+	Owners [][]string
+}
+
+// Duplicate is a pattern that is written on more than one rule with the same owners, all but the last can be deleted
+type Duplicate struct {
+	Pattern string
+	// Rules are the duplicated rules in file order
+	Rules []CodeOwner
+}
+
+// Winner is the position of the rule that actually owns the pattern
+func (c Conflict) Winner() int {
+	return c.Rules[len(c.Rules)-1]
+}
+
+// rewrites patterns that select the same files into one spelling, a trailing slash means everything
+// in the directory and a pattern that is not anchored to the root is spelled as matching at any depth,
+// so docs/ and **/docs/** are the same, as are /docs/ and docs/** when the mode anchors both
+func canonicalpattern(pattern string, mode AnchorMode) string {
+	negated := strings.HasPrefix(pattern, "!")
+	pattern = strings.TrimPrefix(pattern, "!")
+	dironly := strings.HasSuffix(pattern, "/")
+	pattern, anchored := anchor(pattern, mode)
+	if dironly {
+		pattern += "/**"
+	}
+	if !anchored {
+		pattern = "**/" + pattern
+	}
+	for strings.Contains(pattern, "**/**") {
+		pattern = strings.Replace(pattern, "**/**", "**", -1)
+	}
+	if negated {
+		pattern = "!" + pattern
+	}
+	return pattern
+}
+
+// a comparable form of a set of owners, github treats owners case insensitively
+func ownerset(owners []string) string {
+	set := make([]string, len(owners))
+	for idx, ownertext := range owners {
+		set[idx] = strings.ToLower(ownertext)
+	}
+	sort.Strings(set)
+	return strings.Join(set, " ")
+}
+
+// Conflicts finds patterns written more than once with different owners, which is a common reason
+// for a team not being requested for review, the Winner of each conflict is the rule that applies
+func (co CodeOwners) Conflicts() (conflicts []Conflict) {
+	for _, idxs := range co.repeated() {
+		differ := false
+		for _, idx := range idxs[1:] {
+			if ownerset(co.patterns[idx].owners) != ownerset(co.patterns[idxs[0]].owners) {
+				differ = true
+			}
+		}
+		if !differ {
+			continue
+		}
+		conflict := Conflict{Pattern: co.patterns[idxs[0]].path, Rules: idxs}
+		for _, idx := range idxs {
+			conflict.Lines = append(conflict.Lines, co.patterns[idx].line)
+			conflict.Owners = append(conflict.Owners, co.patterns[idx].owners)
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
+
+// the positions of the rules for each pattern written more than once, patterns that select the same files
+// count as the same pattern, in the order the patterns first appear
+func (co CodeOwners) repeated() [][]int {
+	rules := make(map[string][]int)
+	var order []string
+	for idx, pattern := range co.patterns {
+		canonical := canonicalpattern(pattern.path, co.semantics.anchoring)
+		if rules[canonical] == nil {
+			order = append(order, canonical)
+		}
+		rules[canonical] = append(rules[canonical], idx)
+	}
+	var repeated [][]int
+	for _, canonical := range order {
+		if len(rules[canonical]) > 1 {
+			repeated = append(repeated, rules[canonical])
+		}
+	}
+	return repeated
+}
+
+// Duplicates finds patterns written more than once with the same owners, owners are compared ignoring
+// case and order, a pattern that is also written with other owners is a Conflict rather than a Duplicate
+func (co CodeOwners) Duplicates() (duplicates []Duplicate) {
+	for _, idxs := range co.repeated() {
+		duplicate := Duplicate{Pattern: co.patterns[idxs[0]].path}
+		for _, idx := range idxs {
+			if ownerset(co.patterns[idx].owners) != ownerset(co.patterns[idxs[0]].owners) {
+				duplicate.Rules = nil
+				break
+			}
+			duplicate.Rules = append(duplicate.Rules, co.patterns[idx])
+		}
+		if duplicate.Rules != nil {
+			duplicates = append(duplicates, duplicate)
+		}
+	}
+	return duplicates
+}
+
+// Lint runs Duplicates, Conflicts and ShadowedRules over the rules and reports what they find as warnings
+// on the lines of the rules that have no effect, sorted by line, so a long file can be kept tidy by a linter
+func (co CodeOwners) Lint() []*Error {
+	var warnings []*Error
+	warn := func(code Code, line int, message string) {
+		warnings = append(warnings, &Error{Code: code, Message: message, Line: line, Severity: SeverityWarning})
+	}
+	for _, duplicate := range co.Duplicates() {
+		last := duplicate.Rules[len(duplicate.Rules)-1]
+		for _, rule := range duplicate.Rules[:len(duplicate.Rules)-1] {
+			warn(CodeDuplicateRule, rule.line, fmt.Sprintf("%v is written again with the same owners on line %v", rule.path, last.line))
+		}
+	}
+	for _, conflict := range co.Conflicts() {
+		last := conflict.Lines[len(conflict.Lines)-1]
+		for idx, line := range conflict.Lines[:len(conflict.Lines)-1] {
+			warn(CodeConflictingRule, line, fmt.Sprintf("%v is overridden with other owners on line %v", co.patterns[conflict.Rules[idx]].path, last))
+		}
+	}
+	for _, shadow := range co.ShadowedRules() {
+		if canonicalpattern(shadow.Rule.path, co.semantics.anchoring) == canonicalpattern(shadow.By.path, co.semantics.anchoring) {
+			// already reported as a duplicate or conflict
+			continue
+		}
+		warn(CodeShadowedRule, shadow.Rule.line, fmt.Sprintf("%v is always overridden by %v on line %v", shadow.Rule.path, shadow.By.path, shadow.By.line))
+	}
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Line < warnings[j].Line
+	})
+	return warnings
+}
+
+// Shadow is a rule that can never decide the owners of a path, because a later rule matches every path it does
+type Shadow struct {
+	Rule CodeOwner
+	// By is the first later rule that matches everything Rule does
+	By CodeOwner
+}
+
+// ShadowedRules finds rules that are dead because a broader rule comes after them, eg src/api/ followed by src/
+// a rule is only reported when the later pattern provably matches every path it does, by ** or by a literal
+// prefix or suffix of a name, so rules using character classes, braces or escapes are not checked
+func (co CodeOwners) ShadowedRules() (shadows []Shadow) {
+	for idx, rule := range co.patterns {
+		parts := co.pathparts(rule.path)
+		if parts == nil {
+			continue
+		}
+		for _, later := range co.patterns[idx+1:] {
+			if laterparts := co.pathparts(later.path); laterparts != nil && coversparts(laterparts, parts) {
+				shadows = append(shadows, Shadow{Rule: rule, By: later})
+				break
+			}
+		}
+	}
+	return shadows
+}
+
+// the parts a path matched by a pattern is made of, as matchrule matches it, where ** stands for any number
+// of parts and a name with wildcards for one part, nil means the pattern can't be compared
+func (co CodeOwners) pathparts(pattern string) []string {
+	if strings.HasPrefix(pattern, "!") || strings.ContainsAny(pattern, "[{\\") {
+		return nil
+	}
+	g := compile(pattern, co.semantics.anchoring)
+	if g.parts == nil {
+		return nil
+	}
+	var parts []string
+	if !g.anchored {
+		// a pattern that isn't anchored is matched from any directory
+		parts = append(parts, "**")
+	}
+	for idx, part := range g.parts {
+		if part.any && idx == len(g.parts)-1 {
+			// a trailing ** needs something to match
+			parts = append(parts, "*", "**")
+			continue
+		}
+		parts = append(parts, part.text)
+	}
+	switch {
+	case g.dironly:
+		// a directory only owns what is inside it
+		parts = append(parts, "*", "**")
+	case g.cascade:
+		parts = append(parts, "**")
+	}
+	return parts
+}
+
+// reports whether the parts of a pattern match every path the earlier parts do
+func coversparts(parts []string, earlier []string) bool {
+	switch {
+	case len(parts) == 0:
+		return len(earlier) == 0
+	case parts[0] == "**":
+		// ** either matches nothing more or takes the next part of the earlier pattern
+		return coversparts(parts[1:], earlier) || (len(earlier) > 0 && coversparts(parts, earlier[1:]))
+	case len(earlier) == 0 || earlier[0] == "**":
+		return false
+	}
+	return coversname(parts[0], earlier[0]) && coversparts(parts[1:], earlier[1:])
+}
+
+// reports whether a part of a pattern matches every name the earlier part does, which is known when the
+// earlier part is a literal name it matches, or when it is * or a single * between a prefix and suffix that
+// the earlier part starts and ends with
+func coversname(part string, earlier string) bool {
+	if part == earlier || part == "*" {
+		return true
+	}
+	if !haswildcard(earlier) {
+		return matchsimple(part, earlier)
+	}
+	star := strings.Index(part, "*")
+	if star < 0 || strings.ContainsAny(part[star+1:], "*?") || strings.Contains(part[:star], "?") {
+		return false
+	}
+	first, last := strings.IndexAny(earlier, "*?"), strings.LastIndexAny(earlier, "*?")
+	return strings.HasPrefix(earlier[:first], part[:star]) && strings.HasSuffix(earlier[last+1:], part[star+1:])
+}
+
+// UnmatchedRules finds the rules, in file order, whose pattern matches no file in the tree at ref (or the
+// default branch when ref is empty), which is usually a typo such as /serivces/ or a directory since removed
+// negated rules are left out as they only take ownership away
+func (co CodeOwners) UnmatchedRules(ctx context.Context, ref string) ([]CodeOwner, error) {
+	ctx = co.operation(ctx)
+	files, err := co.files(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return co.unmatched(files), nil
+}
+
+// the rules that match none of the files
+func (co CodeOwners) unmatched(files []string) (rules []CodeOwner) {
+	for _, rule := range co.patterns {
+		if strings.HasPrefix(rule.path, "!") {
+			continue
+		}
+		matched := false
+		for _, file := range files {
+			if co.matchesrule(rule, file) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// LintTree is Lint along with the rules UnmatchedRules finds in the tree at ref, which are reported with the
+// given severity, so a CI check can choose whether a pattern that matches nothing fails the build
+func (co CodeOwners) LintTree(ctx context.Context, ref string, unmatched Severity) ([]*Error, error) {
+	rules, err := co.UnmatchedRules(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	diagnostics := co.Lint()
+	for _, rule := range rules {
+		diagnostics = append(diagnostics, &Error{Code: CodeUnmatchedRule, Message: fmt.Sprintf("%v matches no file", rule.path), Line: rule.line, Severity: unmatched})
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Line < diagnostics[j].Line
+	})
+	return diagnostics, nil
+}
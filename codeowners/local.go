@@ -0,0 +1,70 @@
+package codeowners
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileOwners is who owns a file in a local checkout, see OwnersLocal
+type FileOwners struct {
+	// Path is relative to the root of the checkout with forward slashes
+	Path string
+	// Owners are written exactly as in the file, nil when no rule matches and empty when the rule has no owners
+	Owners []string
+	// Rule is the rule that decides the owners, the zero CodeOwner when none matches
+	Rule CodeOwner
+}
+
+// ParseDir reads the CODEOWNERS file of a local checkout from the same places Get looks on github
+func ParseDir(root string) (CodeOwners, error) {
+	for _, location := range defaultlocations {
+		content, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(location), "CODEOWNERS"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return CodeOwners{}, err
+		}
+		co := ParseString(string(content))
+		co.source = Source{Path: location + "CODEOWNERS"}
+		return co, nil
+	}
+	return CodeOwners{}, &Error{Code: CodeNoCodeowners, Message: fmt.Sprintf("No CODEOWNERS file in %v", root)}
+}
+
+// OwnersLocal walks a local checkout and returns the owners of every file in it, in the order they are walked
+// files ignored by git through .gitignore are left out, and nothing is asked of github so owners are as written
+func (co CodeOwners) OwnersLocal(root string) ([]FileOwners, error) {
+	files, err := localfiles(root)
+	if err != nil {
+		return nil, err
+	}
+	owners, _ := co.OwnersOfPaths(files)
+	return owners, nil
+}
+
+// OwnersOfPaths returns the owners of each of some paths, in the order given, along with the union of their owners
+// in the order they are first met, eg for the output of git diff --name-only in a pre-push hook, blank paths are
+// skipped so the output can be split on newlines, nothing is asked of github so owners are as written
+func (co CodeOwners) OwnersOfPaths(paths []string) (files []FileOwners, union []string) {
+	seen := make(map[string]bool)
+	files = make([]FileOwners, 0, len(paths))
+	for _, path := range paths {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		owners := FileOwners{Path: path, Owners: co.OwnersOf(path)}
+		owners.Rule, _ = co.RuleFor(path)
+		files = append(files, owners)
+		for _, ownertext := range owners.Owners {
+			if !seen[strings.ToLower(ownertext)] {
+				seen[strings.ToLower(ownertext)] = true
+				union = append(union, ownertext)
+			}
+		}
+	}
+	return files, union
+}
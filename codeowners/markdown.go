@@ -0,0 +1,67 @@
+package codeowners
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MarkdownMarker starts every table from MarkdownTable so a bot can find and update its own comment
+const MarkdownMarker = "<!-- go-github-codeowners -->"
+
+// escape the characters that would break out of a markdown table cell
+func cell(text string) string {
+	return strings.Replace(text, "|", "\\|", -1)
+}
+
+// MarkdownTable renders the owners of a set of changed files as a markdown table for a pull request comment
+// files are grouped by the rule that owns them, in the order the rules appear in the file, with unowned files last
+// when approved is not nil an approval column shows whether any of the owners of each group has approved
+// the output only depends on the arguments so re-rendering an unchanged pull request gives an identical comment
+func (co CodeOwners) MarkdownTable(paths []string, approved map[string]bool) string {
+	groups := make(map[int][]string)
+	for _, path := range paths {
+		idx := co.rule(path)
+		groups[idx] = append(groups[idx], path)
+	}
+	order := make([]int, 0, len(groups))
+	for idx := range groups {
+		order = append(order, idx)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		// -1 is the group of unowned files which sorts last
+		return order[j] == -1 || (order[i] != -1 && order[i] < order[j])
+	})
+	var table bytes.Buffer
+	table.WriteString(MarkdownMarker + "\n")
+	if approved == nil {
+		table.WriteString("| Files | Owners |\n| --- | --- |\n")
+	} else {
+		table.WriteString("| Files | Owners | Approved |\n| --- | --- | --- |\n")
+	}
+	for _, idx := range order {
+		files := groups[idx]
+		sort.Strings(files)
+		for i, file := range files {
+			files[i] = "`" + cell(file) + "`"
+		}
+		owners, status := "_none_", ""
+		if idx >= 0 && len(co.patterns[idx].owners) > 0 {
+			owners = cell(strings.Join(co.patterns[idx].owners, " "))
+			status = ":x:"
+			for _, ownertext := range co.patterns[idx].owners {
+				if approved[ownertext] {
+					status = ":white_check_mark:"
+					break
+				}
+			}
+		}
+		fmt.Fprintf(&table, "| %v | %v |", strings.Join(files, "<br>"), owners)
+		if approved != nil {
+			fmt.Fprintf(&table, " %v |", status)
+		}
+		table.WriteString("\n")
+	}
+	return table.String()
+}
@@ -0,0 +1,142 @@
+package codeowners
+
+import (
+	"strings"
+)
+
+// MatcherKind chooses how paths are matched against the rules
+type MatcherKind int
+
+const (
+	// MatcherAuto matches linearly, which costs nothing up front, until the file has many rules
+	// or has answered many queries and then builds the index
+	MatcherAuto MatcherKind = iota
+	// MatcherLinear tries every rule against every path
+	MatcherLinear
+	// MatcherIndexed only tries the rules that could match the directories a path starts with
+	MatcherIndexed
+)
+
+// when MatcherAuto switches to the index
+const (
+	indexrules   = 256
+	indexqueries = 1024
+)
+
+// WithMatcher returns a copy of the code owners that uses the given kind of matcher instead of choosing one
+func (co CodeOwners) WithMatcher(kind MatcherKind) CodeOwners {
+	co.matcher = kind
+	return co
+}
+
+// index is a trie of the literal directories rules start with, a rule is kept at the node for its
+// pattern's leading literal segments so a lookup only tries the rules along the path's own directories
+// rules starting with a wildcard, or without a slash so they match at any depth, could match anything and are kept at the root
+type index struct {
+	root *indexnode
+}
+
+// indexnode holds the rules whose literal prefix ends at it, in file order
+type indexnode struct {
+	rules    []int
+	children map[string]*indexnode
+}
+
+// the first segment of a path or pattern
+func firstsegment(path string) string {
+	if split := strings.Index(path, "/"); split >= 0 {
+		return path[:split]
+	}
+	return path
+}
+
+func buildindex(patterns []CodeOwner, sem semantics) *index {
+	ix := &index{root: &indexnode{}}
+	for idx, pattern := range patterns {
+		node := ix.root
+		if trimmed, anchored := anchor(pattern.path, sem.anchoring); anchored && !strings.HasPrefix(pattern.path, "!") {
+			for _, segment := range strings.Split(trimmed, "/") {
+				if haswildcard(segment) {
+					break
+				}
+				child := node.children[segment]
+				if child == nil {
+					if node.children == nil {
+						node.children = make(map[string]*indexnode)
+					}
+					child = &indexnode{}
+					node.children[segment] = child
+				}
+				node = child
+			}
+		}
+		node.rules = append(node.rules, idx)
+	}
+	return ix
+}
+
+// finds the last matching rule by walking the candidate lists of the nodes along the path backwards together
+func (ix *index) match(patterns []CodeOwner, path string, sem semantics) int {
+	// most paths are shallow enough for their candidates to stay on the stack
+	var buffer [16][]int
+	candidates := append(buffer[:0], ix.root.rules)
+	node, rest := ix.root, path
+	for node.children != nil && rest != "" {
+		segment := firstsegment(rest)
+		if node = node.children[segment]; node == nil {
+			break
+		}
+		candidates = append(candidates, node.rules)
+		rest = rest[len(segment):]
+		rest = strings.TrimPrefix(rest, "/")
+	}
+	var split [32]string
+	segments := splitpath(path, split[:0])
+	for {
+		// the candidate list whose last rule is furthest down the file
+		best := -1
+		for list, rules := range candidates {
+			if len(rules) > 0 && (best < 0 || rules[len(rules)-1] > candidates[best][len(candidates[best])-1]) {
+				best = list
+			}
+		}
+		if best < 0 {
+			return -1
+		}
+		idx := candidates[best][len(candidates[best])-1]
+		candidates[best] = candidates[best][:len(candidates[best])-1]
+		if sem.matchsegments(patterns[idx], segments) {
+			return idx
+		}
+	}
+}
+
+// tries every rule from the bottom of the file up
+func linearmatch(patterns []CodeOwner, path string, sem semantics) int {
+	var split [32]string
+	segments := splitpath(path, split[:0])
+	for idx := len(patterns) - 1; idx >= 0; idx-- {
+		if sem.matchsegments(patterns[idx], segments) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// finds the last rule matching the path with whichever matcher has been chosen
+func (co CodeOwners) lookup(path string) int {
+	if co.memo == nil || co.matcher == MatcherLinear {
+		return linearmatch(co.patterns, path, co.semantics)
+	}
+	co.memo.lock.Lock()
+	co.memo.queries++
+	if co.memo.index == nil && (co.matcher == MatcherIndexed || len(co.patterns) >= indexrules || co.memo.queries >= indexqueries) {
+		co.memo.index = buildindex(co.patterns, co.semantics)
+	}
+	ix := co.memo.index
+	co.memo.lock.Unlock()
+	if ix == nil {
+		return linearmatch(co.patterns, path, co.semantics)
+	}
+	return ix.match(co.patterns, path, co.semantics)
+}
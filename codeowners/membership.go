@@ -0,0 +1,72 @@
+package codeowners
+
+import (
+	"context"
+	"github.com/google/go-github/github"
+)
+
+// Membership is a resolved user along with their role (admin or member) and state (active or pending)
+// in the organization that owns the repository
+type Membership struct {
+	User  *github.User
+	Role  string
+	State string
+}
+
+// Active reports whether the membership has been accepted, pending invitees can not yet review
+func (m Membership) Active() bool {
+	return m.State == "active"
+}
+
+// Memberships looks up the organization membership of users returned from Match, in the same order, making
+// as many lookups at once as the service allows, see WithMaxConcurrency
+// users without a login (those only known by email) can not be looked up and are skipped
+func (co CodeOwners) Memberships(ctx context.Context, users []*github.User) (memberships []Membership, error_slice []error) {
+	ctx = co.operation(ctx)
+	if co.service == nil || co.service.client == nil {
+		return nil, append(error_slice, nocall("Organizations.GetOrgMembership"))
+	}
+	w := newworkers(ctx, co.service.semaphore())
+	// the membership or error of each user, by index so they keep the order of the users
+	found := make([]*Membership, len(users))
+	errs := make([]error, len(users))
+	for idx, user := range users {
+		if user.Login == nil {
+			continue
+		}
+		idx, user := idx, user
+		w.spawn(func() {
+			var membership *github.Membership
+			_, err := co.service.call(ctx, "Organizations.GetOrgMembership", repoof(ctx), func() (resp *github.Response, err error) {
+				membership, resp, err = co.service.client.Organizations.GetOrgMembership(ctx, *user.Login, co.owner)
+				return resp, err
+			})
+			w.lock.Lock()
+			defer w.lock.Unlock()
+			if err != nil {
+				errs[idx] = apierror(err, CodeNotFound)
+				return
+			}
+			found[idx] = &Membership{
+				User:  user,
+				Role:  membership.GetRole(),
+				State: membership.GetState(),
+			}
+		})
+	}
+	w.wait()
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for idx := range users {
+		if errs[idx] != nil && ctx.Err() == nil {
+			error_slice = append(error_slice, errs[idx])
+		}
+		if found[idx] != nil {
+			memberships = append(memberships, *found[idx])
+		}
+	}
+	if ctx.Err() != nil {
+		error_slice = append(error_slice, canceled(ctx.Err()))
+	}
+	return memberships, error_slice
+}
@@ -0,0 +1,116 @@
+package codeowners
+
+import (
+	"strings"
+)
+
+// MergePrecedence chooses which of the documents given to Merge wins when they own the same paths
+type MergePrecedence int
+
+const (
+	// MergeLastWins puts the rules of each document after those of the one before, so later documents
+	// override earlier ones, eg Merge(opts, orgdefaults, repo)
+	MergeLastWins MergePrecedence = iota
+	// MergeFirstWins puts the rules of each document after those of the one after, so earlier documents
+	// override later ones
+	MergeFirstWins
+)
+
+// MergeOptions changes how Merge combines documents
+type MergeOptions struct {
+	Precedence MergePrecedence
+	// Deduplicate leaves out the rules of a document when a document that takes precedence writes the same pattern
+	Deduplicate bool
+}
+
+// MergeConflict is a pattern that more than one document writes with different owners
+type MergeConflict struct {
+	Pattern string
+	// Documents are the positions of the documents in the arguments to Merge, in order of precedence with the winner last
+	Documents []int
+	// Rules are the last rule for the pattern in each of those documents, with the line it was read from
+	Rules []CodeOwner
+}
+
+// Winner is the rule whose owners the merged rules give the pattern
+func (mc MergeConflict) Winner() CodeOwner {
+	return mc.Rules[len(mc.Rules)-1]
+}
+
+// Merge combines several documents, eg an org wide default and a repository's own file, into one set of rules
+// the rules are written one document after another in order of precedence and a conflict is reported for each
+// pattern the documents disagree about, the repository, client and matching choices come from the first document
+func Merge(opts MergeOptions, docs ...CodeOwners) (CodeOwners, []MergeConflict) {
+	order := make([]int, len(docs))
+	for idx := range docs {
+		order[idx] = idx
+		if opts.Precedence == MergeFirstWins {
+			order[idx] = len(docs) - 1 - idx
+		}
+	}
+	var merged CodeOwners
+	if len(docs) > 0 {
+		merged = docs[0]
+	}
+	// the last rule for each pattern in each document, and the last document writing each pattern
+	type written struct {
+		doc  int
+		rule CodeOwner
+	}
+	var patterns []string
+	writes := make(map[string][]written)
+	for _, doc := range order {
+		for _, rule := range docs[doc].patterns {
+			canonical := canonicalpattern(rule.path, merged.semantics.anchoring)
+			previous := writes[canonical]
+			switch {
+			case previous == nil:
+				patterns = append(patterns, canonical)
+				fallthrough
+			case previous[len(previous)-1].doc != doc:
+				writes[canonical] = append(previous, written{doc: doc, rule: rule})
+			default:
+				previous[len(previous)-1].rule = rule
+			}
+		}
+	}
+	var conflicts []MergeConflict
+	for _, canonical := range patterns {
+		docwrites := writes[canonical]
+		differ := false
+		for _, write := range docwrites[1:] {
+			if ownerset(write.rule.owners) != ownerset(docwrites[0].rule.owners) {
+				differ = true
+			}
+		}
+		if !differ {
+			continue
+		}
+		conflict := MergeConflict{Pattern: docwrites[0].rule.path}
+		for _, write := range docwrites {
+			conflict.Documents = append(conflict.Documents, write.doc)
+			conflict.Rules = append(conflict.Rules, write.rule)
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	merged.patterns = make([]CodeOwner, 0)
+	for _, doc := range order {
+		for _, rule := range docs[doc].patterns {
+			docwrites := writes[canonicalpattern(rule.path, merged.semantics.anchoring)]
+			if opts.Deduplicate && docwrites[len(docwrites)-1].doc != doc {
+				continue
+			}
+			rule.file = ""
+			rule.line = len(merged.patterns) + 1
+			merged.patterns = append(merged.patterns, rule)
+		}
+	}
+	var text []string
+	for _, rule := range merged.patterns {
+		text = append(text, rule.String())
+	}
+	merged.document = newdocument(strings.Join(text, "\n"))
+	merged.source = Source{}
+	merged.memo = &memo{rules: make(map[string]int)}
+	return merged, conflicts
+}
@@ -0,0 +1,32 @@
+package codeowners
+
+import (
+	"strings"
+)
+
+// Manifest renders the rules as a CODENOTIFY file so owners can get notifications for their paths
+// without review being required, when owners are given only those owners are kept on each rule and
+// rules left without any owner are dropped
+// note that every matching CODENOTIFY rule notifies, so an owner of a rule overridden further down
+// the CODEOWNERS file will still hear about those paths
+func (co CodeOwners) Manifest(owners ...string) string {
+	var lines []string
+	for _, pattern := range co.patterns {
+		kept := pattern.owners
+		if len(owners) > 0 {
+			kept = nil
+			for _, ownertext := range pattern.owners {
+				for _, wanted := range owners {
+					if strings.EqualFold(ownertext, wanted) {
+						kept = append(kept, ownertext)
+						break
+					}
+				}
+			}
+		}
+		if len(kept) > 0 {
+			lines = append(lines, CodeOwner{path: pattern.path, owners: kept}.String())
+		}
+	}
+	return strings.Join(lines, "\n")
+}
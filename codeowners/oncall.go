@@ -0,0 +1,73 @@
+package codeowners
+
+import (
+	"context"
+	"github.com/google/go-github/github"
+	"net/mail"
+	"strings"
+)
+
+// OnCallResolver finds who is currently on call for an owning team, it is the hook for
+// paging schedules such as PagerDuty or Opsgenie, team is written as in CODEOWNERS eg @org/team
+// a nil user without an error means nobody is on call for the team
+type OnCallResolver interface {
+	OnCall(ctx context.Context, team string) (*github.User, error)
+}
+
+// OnCallResolverFunc lets an ordinary function be used as an OnCallResolver
+type OnCallResolverFunc func(ctx context.Context, team string) (*github.User, error)
+
+// OnCall calls the function
+func (f OnCallResolverFunc) OnCall(ctx context.Context, team string) (*github.User, error) {
+	return f(ctx, team)
+}
+
+// OnCall finds who to page about a path, eg the file at the top of a stack trace
+// owning teams are handed to the resolver for their current on call engineer, or every member of the team when
+// nobody is on call, while owners who are individuals are returned as they are without looking up their profiles
+func (co CodeOwners) OnCall(ctx context.Context, path string, resolver OnCallResolver) (users []*github.User, error_slice []error) {
+	ctx = co.operation(ctx)
+	owners, err := co.owned(path)
+	if err != nil {
+		error_slice = append(error_slice, err)
+		return nil, error_slice
+	}
+	for _, ownertext := range owners {
+		switch {
+		case strings.HasPrefix(ownertext, "@") && strings.Contains(ownertext, "/"):
+			user, err := resolver.OnCall(ctx, ownertext)
+			if err != nil {
+				error_slice = append(error_slice, err)
+				continue
+			}
+			if user != nil {
+				users = append(users, user)
+				continue
+			}
+			if co.service == nil || co.service.client == nil {
+				error_slice = append(error_slice, noclient(ownertext))
+				continue
+			}
+			members, err := co.service.teammembers(ownertext, ctx)
+			if err != nil {
+				error_slice = append(error_slice, err)
+				continue
+			}
+			for _, member := range members {
+				login := member
+				users = append(users, &github.User{Login: &login})
+			}
+		case strings.HasPrefix(ownertext, "@"):
+			login := ownertext[1:]
+			users = append(users, &github.User{Login: &login})
+		default:
+			e, err := mail.ParseAddress(ownertext)
+			if err != nil {
+				error_slice = append(error_slice, err)
+				continue
+			}
+			users = append(users, &github.User{Email: &e.Address})
+		}
+	}
+	return users, error_slice
+}
@@ -0,0 +1,90 @@
+package codeowners
+
+import (
+	"strings"
+)
+
+// GetOption changes where Get looks for the file
+type GetOption func(*getoptions)
+
+// where a file is fetched from, the zero ref is the default branch
+type getoptions struct {
+	ref       string
+	locations []string
+	filename  string
+	// aliases is the path of an OWNERS_ALIASES file to read alongside
+	aliases string
+	// includes resolves #!include directives from the repository
+	includes bool
+	// previous is the source of an earlier read of the file to ask github whether it has changed, see GetCached
+	previous Source
+	// archive reads the file from the repository's tarball, see WithArchive
+	archive bool
+}
+
+// the directories github itself reads CODEOWNERS from
+var defaultlocations = []string{"", "docs/", ".github/"}
+
+// applies the options over the defaults for the named file
+func newgetoptions(filename string, opts []GetOption) getoptions {
+	options := getoptions{
+		locations: defaultlocations,
+		filename:  filename,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithRef reads the file at a branch, tag or commit rather than the default branch
+func WithRef(ref string) GetOption {
+	return func(options *getoptions) {
+		options.ref = ref
+	}
+}
+
+// WithLocations replaces the directories that are searched, in order, "" being the repository root
+func WithLocations(locations ...string) GetOption {
+	return func(options *getoptions) {
+		options.locations = make([]string, len(locations))
+		for idx, location := range locations {
+			if location != "" && !strings.HasSuffix(location, "/") {
+				location += "/"
+			}
+			options.locations[idx] = location
+		}
+	}
+}
+
+// WithFilename reads a file with another name, eg OWNERS, in place of CODEOWNERS or CODENOTIFY
+func WithFilename(filename string) GetOption {
+	return func(options *getoptions) {
+		options.filename = filename
+	}
+}
+
+// WithAliasesFile also reads an OWNERS_ALIASES file from the repository, at the same ref, and
+// expands the aliases it defines when matching, see Aliases
+func WithAliasesFile(path string) GetOption {
+	return func(options *getoptions) {
+		options.aliases = path
+	}
+}
+
+// WithIncludes also reads the files named by #!include directives from the repository, at the same ref,
+// and merges their rules in, see CodeOwners.Include
+func WithIncludes() GetOption {
+	return func(options *getoptions) {
+		options.includes = true
+	}
+}
+
+// WithArchive reads the file from the repository's tarball, so that the CodeOwners also knows every file in the
+// repository and FindUnowned and Impact at the same ref run without listing the tree, included and aliases
+// files are still read through the api
+func WithArchive() GetOption {
+	return func(options *getoptions) {
+		options.archive = true
+	}
+}
@@ -0,0 +1,203 @@
+package codeowners
+
+import (
+	"context"
+	"github.com/google/go-github/github"
+	"strings"
+)
+
+// Owner is a single owner of a path as returned from MatchOwners, one of UserOwner, TeamOwner or EmailOwner
+type Owner interface {
+	// Text is the owner as it was written in the CODEOWNERS file
+	Text() string
+	owner()
+}
+
+// UserOwner is a github user named by their login, eg @login
+type UserOwner struct {
+	Owner string
+	Login string
+}
+
+// EmailOwner is an owner named by email address, github has no way to look these up
+type EmailOwner struct {
+	Owner   string
+	Address string
+}
+
+// Text is the owner as it was written in the CODEOWNERS file
+func (uo UserOwner) Text() string {
+	return uo.Owner
+}
+
+// Text is the owner as it was written in the CODEOWNERS file
+func (eo EmailOwner) Text() string {
+	return eo.Owner
+}
+
+// Text is the owner as it was written in the CODEOWNERS file
+func (to TeamOwner) Text() string {
+	return to.Owner
+}
+
+func (uo UserOwner) owner()  {}
+func (eo EmailOwner) owner() {}
+func (to TeamOwner) owner()  {}
+
+// MatchOwners returns the owners of a path without flattening teams into their members, so a
+// review can be requested from a team rather than from each person in it
+// only teams are looked up on github, users and emails come straight from the file
+func (co CodeOwners) MatchOwners(ctx context.Context, path string) (owners []Owner, error_slice []error) {
+	ctx = co.operation(ctx)
+	texts, err := co.owned(path)
+	if err != nil {
+		error_slice = append(error_slice, err)
+		return nil, error_slice
+	}
+	for _, ownertext := range texts {
+		owner, err := co.ownerof(ctx, ownertext)
+		if err != nil {
+			error_slice = append(error_slice, err)
+			continue
+		}
+		owners = append(owners, owner)
+	}
+	return owners, error_slice
+}
+
+// the owner written as ownertext, teams are looked up on github
+func (co CodeOwners) ownerof(ctx context.Context, ownertext string) (Owner, error) {
+	if err := checkowner(ownertext); err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.Contains(ownertext, "/"):
+		team, err := co.teamowner(ctx, ownertext)
+		if err != nil {
+			return nil, err
+		}
+		return team, nil
+	case strings.HasPrefix(ownertext, "@"):
+		return UserOwner{Owner: ownertext, Login: ownertext[1:]}, nil
+	}
+	return EmailOwner{Owner: ownertext, Address: ownertext}, nil
+}
+
+// Expand is the opt in step that turns owners into github users, teams become their members
+// and users are fetched in full, as Match would do for the rule they came from
+func (co CodeOwners) Expand(ctx context.Context, owners ...Owner) (users []*github.User, error_slice []error) {
+	texts := make([]string, len(owners))
+	for idx, owner := range owners {
+		texts[idx] = owner.Text()
+	}
+	resolutions, error_slice := co.expand(ctx, texts)
+	for _, resolution := range resolutions {
+		if resolution.User != nil {
+			users = append(users, resolution.User)
+		}
+	}
+	return users, error_slice
+}
+
+// MatchLogins matches a file like Match but only returns the owners as text, without any api calls
+// users are returned as their login, teams as org/team and email owners as written, see WithMemberLogins
+// for the logins of the members of teams instead
+func (co CodeOwners) MatchLogins(ctx context.Context, path string) (logins []string, error_slice []error) {
+	ctx = co.operation(ctx)
+	texts, err := co.owned(path)
+	if err != nil {
+		error_slice = append(error_slice, err)
+		return nil, error_slice
+	}
+	seen := make(map[string]bool)
+	add := func(login string) {
+		if co.service.excluded(&github.User{Login: &login}) {
+			return
+		}
+		if !seen[login] {
+			seen[login] = true
+			logins = append(logins, login)
+		}
+	}
+	for _, ownertext := range texts {
+		if err := checkowner(ownertext); err != nil {
+			error_slice = append(error_slice, err)
+			continue
+		}
+		switch {
+		case strings.Contains(ownertext, "/") && (co.service == nil || !co.service.expansion.memberlogins):
+			if !seen[ownertext] {
+				seen[ownertext] = true
+				logins = append(logins, ownertext[1:])
+			}
+		case strings.Contains(ownertext, "/"):
+			if co.service.client == nil {
+				error_slice = append(error_slice, noclient(ownertext))
+				continue
+			}
+			members, err := co.service.teammembers(ownertext, ctx)
+			if err != nil {
+				error_slice = append(error_slice, err)
+				continue
+			}
+			for _, member := range members {
+				add(member)
+			}
+		case strings.HasPrefix(ownertext, "@"):
+			add(ownertext[1:])
+		default:
+			add(ownertext)
+		}
+	}
+	return logins, error_slice
+}
+
+// WithMemberLogins returns a copy of the code owners whose MatchLogins lists each team as the logins of its
+// members, which costs two api calls per team and still none per user
+func (co CodeOwners) WithMemberLogins() CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.expansion.memberlogins = true
+	})
+}
+
+// LazyMatch is a path matched to its owners without any lookups on github, see MatchLazy
+type LazyMatch struct {
+	// Rule is the rule that gave the owners
+	Rule CodeOwner
+	// Owners are references to the owners, teams are only named, their Team and Hierarchy are left empty
+	Owners []Owner
+	co     CodeOwners
+	texts  []string
+}
+
+// MatchLazy matches a file to its owners straight away without calling github, users are only looked up
+// if Resolve is called, so a pipeline that never needs their details pays nothing for them
+// owners that are not well formed are left out of Owners and reported by Resolve
+func (co CodeOwners) MatchLazy(path string) (LazyMatch, error) {
+	texts, err := co.owned(path)
+	if err != nil {
+		return LazyMatch{}, err
+	}
+	lazy := LazyMatch{co: co, texts: texts}
+	lazy.Rule, _ = co.RuleFor(path)
+	for _, ownertext := range texts {
+		if checkowner(ownertext) != nil {
+			continue
+		}
+		switch {
+		case strings.Contains(ownertext, "/"):
+			lazy.Owners = append(lazy.Owners, TeamOwner{Owner: ownertext})
+		case strings.HasPrefix(ownertext, "@"):
+			lazy.Owners = append(lazy.Owners, UserOwner{Owner: ownertext, Login: ownertext[1:]})
+		default:
+			lazy.Owners = append(lazy.Owners, EmailOwner{Owner: ownertext, Address: ownertext})
+		}
+	}
+	return lazy, nil
+}
+
+// Resolve looks the owners up on github as Match would have done, a user behind several owners is returned once
+func (lm LazyMatch) Resolve(ctx context.Context) (users []*github.User, error_slice []error) {
+	resolutions, error_slice := lm.co.expand(ctx, lm.texts)
+	return resolvedusers(resolutions), error_slice
+}
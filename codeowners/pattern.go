@@ -0,0 +1,317 @@
+package codeowners
+
+import (
+	"github.com/bmatcuk/doublestar"
+	"strings"
+	"unicode/utf8"
+)
+
+// AnchorMode chooses which patterns are matched from the root of the repository
+type AnchorMode int
+
+const (
+	// AnchorGitignore anchors any pattern with a slash at its start or in its middle, as .gitignore and github do,
+	// so /docs/*.md and docs/*.md both only match files directly in the docs directory at the root
+	AnchorGitignore AnchorMode = iota
+	// AnchorLeadingSlash only anchors patterns starting with a slash, so docs/*.md matches a docs
+	// directory at any depth while /docs/*.md still only matches the one at the root
+	AnchorLeadingSlash
+)
+
+// NegationMode chooses what a pattern starting with ! means
+type NegationMode int
+
+const (
+	// NegationStrict follows github, which does not support negation, so a negated rule never matches
+	// and ValidateBlob reports the line
+	NegationStrict NegationMode = iota
+	// NegationExtension honours negation as an extension to github, a negated rule owns every path
+	// its pattern does not match, eg !*.md @org/engineering owns everything but markdown
+	NegationExtension
+)
+
+// semantics are the choices that change which paths a pattern matches
+type semantics struct {
+	anchoring AnchorMode
+	negation  NegationMode
+}
+
+// WithAnchoring returns a copy of the code owners that anchors patterns the given way
+func (co CodeOwners) WithAnchoring(mode AnchorMode) CodeOwners {
+	co.semantics.anchoring = mode
+	// remembered answers were found with the old mode
+	co.memo = &memo{rules: make(map[string]int)}
+	return co
+}
+
+// WithNegation returns a copy of the code owners that treats negated patterns the given way
+func (co CodeOwners) WithNegation(mode NegationMode) CodeOwners {
+	co.semantics.negation = mode
+	co.memo = &memo{rules: make(map[string]int)}
+	return co
+}
+
+// matchpattern taking negation into account
+func (sem semantics) match(pattern string, path string) bool {
+	if strings.HasPrefix(pattern, "!") {
+		return sem.negation == NegationExtension && !matchpattern(pattern[1:], path, sem.anchoring)
+	}
+	return matchpattern(pattern, path, sem.anchoring)
+}
+
+// match for a rule, using the globs it was compiled to when it was parsed
+func (sem semantics) matchrule(rule CodeOwner, path string) bool {
+	var buffer [32]string
+	return sem.matchsegments(rule, splitpath(path, buffer[:0]))
+}
+
+// matchrule for a path that has already been split at its slashes, so that a path tried against
+// many rules is only split once
+func (sem semantics) matchsegments(rule CodeOwner, segments []string) bool {
+	g := rule.globs
+	if g == nil {
+		g = compileall(rule.path)
+	}
+	if strings.HasPrefix(rule.path, "!") {
+		return sem.negation == NegationExtension && !g[sem.anchoring].match(segments)
+	}
+	return g[sem.anchoring].match(segments)
+}
+
+// matchpattern for the semantics the code owners were set up with
+func (co CodeOwners) matches(pattern string, path string) bool {
+	return co.semantics.match(pattern, path)
+}
+
+// matchrule for the semantics the code owners were set up with
+func (co CodeOwners) matchesrule(rule CodeOwner, path string) bool {
+	return co.semantics.matchrule(rule, path)
+}
+
+// reports whether a CODEOWNERS pattern matches a path the way github does, which follows .gitignore
+// a pattern without a slash matches a file or directory of that name at any depth, eg *.js or docs,
+// otherwise the pattern is matched from the root of the repository, eg docs/* or /build/logs/, see AnchorMode
+// a trailing slash only matches directories, eg apps/ owns every file below any apps directory
+// a match on a directory owns everything inside it, except when the last part of the pattern is a
+// wildcard, so docs/* owns docs/readme.md but not docs/api/readme.md
+func matchpattern(pattern string, path string, mode AnchorMode) bool {
+	var buffer [32]string
+	return compile(pattern, mode).match(splitpath(path, buffer[:0]))
+}
+
+// glob is a pattern compiled for one AnchorMode, so that matching a path only compares its parts
+type glob struct {
+	// parts are the pattern split at its slashes, nil for a pattern that matches nothing
+	parts []globpart
+	// dironly is set by a trailing slash
+	dironly  bool
+	anchored bool
+	// relative is a pattern with several parts that is not anchored, so it is tried from every directory
+	relative bool
+	// cascade is whether matching a directory owns the files inside it
+	cascade bool
+}
+
+// globpart is the pattern for one part of a path
+type globpart struct {
+	text string
+	// literal parts are compared as they are rather than matched by doublestar
+	literal bool
+	// any is a ** part, which matches any number of parts
+	any bool
+	// simple parts only use * ? and escapes, so are matched without doublestar, which allocates
+	simple bool
+}
+
+// globs are the compiled forms of a pattern for each AnchorMode
+type globs [2]*glob
+
+// compiles a pattern, without any ! it is negated with, for every AnchorMode
+func compileall(pattern string) *globs {
+	pattern = strings.TrimPrefix(pattern, "!")
+	return &globs{AnchorGitignore: compile(pattern, AnchorGitignore), AnchorLeadingSlash: compile(pattern, AnchorLeadingSlash)}
+}
+
+// compiles a pattern to be matched the given way
+func compile(pattern string, mode AnchorMode) *glob {
+	g := &glob{dironly: strings.HasSuffix(pattern, "/")}
+	pattern, g.anchored = anchor(pattern, mode)
+	if pattern == "" {
+		return g
+	}
+	g.cascade = g.dironly || !haswildcard(pattern[strings.LastIndex(pattern, "/")+1:])
+	g.relative = !g.anchored && strings.Contains(pattern, "/")
+	for _, part := range splitglob(pattern) {
+		g.parts = append(g.parts, globpart{text: part, literal: !haswildcard(part), any: part == "**", simple: !strings.ContainsAny(part, "[{")})
+	}
+	return g
+}
+
+// reports whether the compiled pattern matches a path split at its slashes
+func (g *glob) match(segments []string) bool {
+	if g.parts == nil {
+		return false
+	}
+	if g.relative {
+		for from := range segments {
+			if g.matchfrom(segments[from:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if !g.anchored {
+		// a single part matches a file or directory of that name at any depth
+		if matchparts(g.parts, segments[len(segments)-1:]) && !g.dironly {
+			return true
+		}
+		if !g.cascade {
+			return false
+		}
+		for idx := range segments[:len(segments)-1] {
+			if matchparts(g.parts, segments[idx:idx+1]) {
+				return true
+			}
+		}
+		return false
+	}
+	return g.matchfrom(segments)
+}
+
+// matches the pattern against the path from its first segment, or against any of the directories it is in
+func (g *glob) matchfrom(segments []string) bool {
+	if matchparts(g.parts, segments) && !g.dironly {
+		return true
+	}
+	if !g.cascade {
+		return false
+	}
+	for end := 1; end < len(segments); end++ {
+		if matchparts(g.parts, segments[:end]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches the parts of a pattern against the segments of a path the way doublestar does
+func matchparts(parts []globpart, segments []string) bool {
+	if len(parts) == 0 || len(segments) == 0 {
+		return len(parts) == 0 && len(segments) == 0
+	}
+	for idx, part := range parts {
+		if idx >= len(segments) {
+			return false
+		}
+		if part.any {
+			if idx+1 == len(parts) {
+				return true
+			}
+			for from := idx; from < len(segments); from++ {
+				if matchparts(parts[idx+1:], segments[from:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if part.literal {
+			if part.text != segments[idx] {
+				return false
+			}
+		} else if part.simple {
+			if !matchsimple(part.text, segments[idx]) {
+				return false
+			}
+		} else if match, _ := doublestar.Match(part.text, segments[idx]); !match {
+			return false
+		}
+	}
+	return len(parts) == len(segments)
+}
+
+// matches a part of a pattern using only * ? and escapes against a segment of a path the way doublestar does
+func matchsimple(pattern string, name string) bool {
+	if name == "" {
+		return pattern == "" || pattern == "*"
+	}
+	for pattern != "" && name != "" {
+		switch pattern[0] {
+		case '\\':
+			_, size := utf8.DecodeRuneInString(pattern[1:])
+			if size == 0 || !strings.HasPrefix(name, pattern[1:1+size]) {
+				return false
+			}
+			pattern, name = pattern[1+size:], name[size:]
+		case '*':
+			if pattern = pattern[1:]; pattern == "" {
+				return true
+			}
+			for name != "" {
+				if matchsimple(pattern, name) {
+					return true
+				}
+				_, size := utf8.DecodeRuneInString(name)
+				name = name[size:]
+			}
+			return false
+		case '?':
+			_, size := utf8.DecodeRuneInString(name)
+			pattern, name = pattern[1:], name[size:]
+		default:
+			if pattern[0] != name[0] {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+		}
+	}
+	return pattern == "" && name == "" || name == "" && (pattern == "*" || pattern == "**")
+}
+
+// splits a path at its slashes into the given slice, which callers keep on the stack
+func splitpath(path string, into []string) []string {
+	for {
+		split := strings.IndexByte(path, '/')
+		if split < 0 {
+			return append(into, path)
+		}
+		into = append(into, path[:split])
+		path = path[split+1:]
+	}
+}
+
+// splits a pattern at its slashes, except those escaped with a backslash, as doublestar does
+func splitglob(pattern string) []string {
+	var parts []string
+	start := 0
+	for idx := 0; idx < len(pattern); idx++ {
+		if pattern[idx] == '/' && (idx == 0 || pattern[idx-1] != '\\') {
+			parts = append(parts, pattern[start:idx])
+			start = idx + 1
+		}
+	}
+	return append(parts, pattern[start:])
+}
+
+// strips the slashes from the ends of a pattern and reports whether it is matched from the root
+func anchor(pattern string, mode AnchorMode) (string, bool) {
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored := strings.HasPrefix(pattern, "/")
+	if mode == AnchorGitignore {
+		anchored = strings.Contains(pattern, "/")
+	}
+	return strings.TrimPrefix(pattern, "/"), anchored
+}
+
+// reports whether part of a pattern is a glob rather than a literal name
+func haswildcard(part string) bool {
+	return strings.ContainsAny(part, "*?[{\\")
+}
+
+// the index of the next slash in path after split, or -1
+func nextslash(path string, split int) int {
+	next := strings.Index(path[split+1:], "/")
+	if next < 0 {
+		return -1
+	}
+	return split + 1 + next
+}
@@ -0,0 +1,17 @@
+package codeowners
+
+import (
+	"context"
+)
+
+// Provider reads the CODEOWNERS and CODENOTIFY files of repositories, Service and CachedService are both
+// Providers, so code that only reads files can take either, or a fake in its tests
+type Provider interface {
+	Get(ctx context.Context, owner string, repo string, opts ...GetOption) (CodeOwners, error)
+	GetNotify(ctx context.Context, owner string, repo string, opts ...GetOption) (CodeOwners, error)
+}
+
+var (
+	_ Provider = (*Service)(nil)
+	_ Provider = (*CachedService)(nil)
+)
@@ -0,0 +1,477 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/github"
+	"sort"
+	"strings"
+)
+
+// approvalpolicy requires count distinct owners to approve changes to paths matching pattern
+type approvalpolicy struct {
+	pattern string
+	count   int
+}
+
+// WithApprovals returns a copy of the code owners where changes to paths matching pattern need approvals
+// from count distinct owners rather than github's default of one, the last matching policy wins
+func (co CodeOwners) WithApprovals(pattern string, count int) CodeOwners {
+	approvals := make([]approvalpolicy, len(co.approvals), len(co.approvals)+1)
+	copy(approvals, co.approvals)
+	co.approvals = append(approvals, approvalpolicy{pattern: pattern, count: count})
+	return co
+}
+
+// the number of distinct owner approvals a change to the path needs
+func (co CodeOwners) required(path string) int {
+	count := 1
+	for _, policy := range co.approvals {
+		if co.matches(policy.pattern, path) {
+			count = policy.count
+		}
+	}
+	return count
+}
+
+// lists the paths of every file changed in a pull request
+func (s *Service) changedfiles(ctx context.Context, owner string, repo string, number int) ([]string, error) {
+	var paths []string
+	opt := github.ListOptions{}
+	for {
+		var files []*github.CommitFile
+		resp, err := s.call(ctx, "PullRequests.ListFiles", owner+"/"+repo, func() (resp *github.Response, err error) {
+			files, resp, err = s.client.PullRequests.ListFiles(ctx, owner, repo, number, &opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			paths = append(paths, file.GetFilename())
+		}
+		if resp.NextPage == 0 {
+			return paths, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// lists the logins whose most recent decisive review of a pull request is an approval
+// comments do not change a reviewer's decision, but requesting changes or being dismissed withdraws an approval
+func (s *Service) approvers(ctx context.Context, owner string, repo string, number int) (map[string]bool, error) {
+	approved := make(map[string]bool)
+	opt := github.ListOptions{}
+	for {
+		var reviews []*github.PullRequestReview
+		resp, err := s.call(ctx, "PullRequests.ListReviews", owner+"/"+repo, func() (resp *github.Response, err error) {
+			reviews, resp, err = s.client.PullRequests.ListReviews(ctx, owner, repo, number, &opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, review := range reviews {
+			login := strings.ToLower(review.GetUser().GetLogin())
+			switch review.GetState() {
+			case "APPROVED":
+				approved[login] = true
+			case "CHANGES_REQUESTED", "DISMISSED":
+				delete(approved, login)
+			}
+		}
+		if resp.NextPage == 0 {
+			return approved, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// finds the approvers whose approval counts for the owner
+// team members are only looked up once per call through the teams map
+func (s *Service) satisfies(ctx context.Context, ownertext string, approved map[string]bool, teams map[string][]string) ([]string, error) {
+	var logins []string
+	switch {
+	case strings.HasPrefix(ownertext, "@") && strings.Contains(ownertext, "/"):
+		members, ok := teams[ownertext]
+		if !ok {
+			var err error
+			members, err = s.teammembers(ownertext, ctx)
+			if err != nil {
+				return nil, err
+			}
+			teams[ownertext] = members
+		}
+		for _, member := range members {
+			if approved[strings.ToLower(member)] {
+				logins = append(logins, strings.ToLower(member))
+			}
+		}
+	case strings.HasPrefix(ownertext, "@"):
+		if approved[strings.ToLower(ownertext[1:])] {
+			logins = append(logins, strings.ToLower(ownertext[1:]))
+		}
+	}
+	// github only credits an email owner once it has been linked to an account, which the api does not expose
+	return logins, nil
+}
+
+// RuleApproval is the approval progress of a rule that owns some of the files changed in a pull request
+type RuleApproval struct {
+	Pattern string
+	Files   []string
+	// Approved are the owners that have approved, a team counts once any of its members approves
+	Approved []string
+	// Pending are the owners that have not approved
+	Pending []string
+	// Approvers are the distinct users whose approvals count towards the rule
+	Approvers []string
+	// Required is how many distinct approvers the rule needs, see WithApprovals and CodeOwner.MinApprovals
+	Required int
+}
+
+// Satisfied reports whether the rule has been approved by enough of its owners
+func (ra RuleApproval) Satisfied() bool {
+	return len(ra.Approvers) >= ra.Required
+}
+
+// ApprovalProgress reports, for each rule owning a file changed in a pull request, which owners have approved and
+// which are still pending, in the order the rules appear in the file
+func (co CodeOwners) ApprovalProgress(ctx context.Context, number int) (progress []RuleApproval, error_slice []error) {
+	ctx = co.operation(ctx)
+	paths, err := co.service.changedfiles(ctx, co.owner, co.repo, number)
+	if err != nil {
+		return nil, append(error_slice, err)
+	}
+	approvals, err := co.service.approvers(ctx, co.owner, co.repo, number)
+	if err != nil {
+		return nil, append(error_slice, err)
+	}
+	files := make(map[int][]string)
+	for _, path := range paths {
+		for _, idx := range co.rulesfor(path) {
+			files[idx] = append(files[idx], path)
+		}
+	}
+	teams := make(map[string][]string)
+	for idx, pattern := range co.patterns {
+		// a rule without owners, or in an optional section, needs no approval
+		if files[idx] == nil || len(co.ruleowners(pattern)) == 0 || pattern.section.Optional {
+			continue
+		}
+		rule := RuleApproval{
+			Pattern:  pattern.path,
+			Files:    files[idx],
+			Required: max(pattern.section.Approvals, pattern.MinApprovals()),
+		}
+		for _, path := range rule.Files {
+			if count := co.required(path); count > rule.Required {
+				rule.Required = count
+			}
+		}
+		counted := make(map[string]bool)
+		for _, ownertext := range co.aliases.expand(co.ruleowners(pattern)) {
+			logins, err := co.service.satisfies(ctx, ownertext, approvals, teams)
+			if err != nil {
+				error_slice = append(error_slice, err)
+			}
+			if len(logins) == 0 {
+				rule.Pending = append(rule.Pending, ownertext)
+				continue
+			}
+			rule.Approved = append(rule.Approved, ownertext)
+			for _, login := range logins {
+				if !counted[login] {
+					counted[login] = true
+					rule.Approvers = append(rule.Approvers, login)
+				}
+			}
+		}
+		progress = append(progress, rule)
+	}
+	return progress, error_slice
+}
+
+// ApprovalSummary is whether the owners of the files changed in a pull request have approved it
+type ApprovalSummary struct {
+	// Approved is set when every rule owning a changed file is satisfied
+	Approved bool
+	// Satisfied and Unsatisfied are the rules owning changed files, in the order they appear in the file
+	Satisfied   []RuleApproval
+	Unsatisfied []RuleApproval
+	// Files says for each changed file that needs approval whether every rule owning it is satisfied,
+	// files that no rule owns, or whose rules have no owners, need no approval and are left out
+	Files map[string]bool
+	// Missing are the owners that could still approve an unsatisfied rule, in order
+	Missing []string
+}
+
+// ApprovalStatus evaluates the reviews of a pull request the way github's "require review from code owners" does,
+// a rule is satisfied once enough of its owners have approved (a team by any of its members) and a changed file is
+// approved once every rule owning it is, the owners of unsatisfied rules are reported as missing
+func (co CodeOwners) ApprovalStatus(ctx context.Context, number int) (summary ApprovalSummary, error_slice []error) {
+	ctx = co.operation(ctx)
+	progress, error_slice := co.ApprovalProgress(ctx, number)
+	if progress == nil && len(error_slice) > 0 {
+		return summary, error_slice
+	}
+	summary.Approved = len(error_slice) == 0
+	summary.Files = make(map[string]bool)
+	missing := make(map[string]bool)
+	for _, rule := range progress {
+		for _, path := range rule.Files {
+			if approved, ok := summary.Files[path]; !ok || approved {
+				summary.Files[path] = rule.Satisfied()
+			}
+		}
+		if rule.Satisfied() {
+			summary.Satisfied = append(summary.Satisfied, rule)
+			continue
+		}
+		summary.Unsatisfied = append(summary.Unsatisfied, rule)
+		summary.Approved = false
+		for _, ownertext := range rule.Pending {
+			missing[ownertext] = true
+		}
+		// a team that has approved can still supply the further approvals a rule needs
+		for _, ownertext := range rule.Approved {
+			if strings.Contains(ownertext, "/") {
+				missing[ownertext] = true
+			}
+		}
+	}
+	for ownertext := range missing {
+		summary.Missing = append(summary.Missing, ownertext)
+	}
+	sort.Strings(summary.Missing)
+	return summary, error_slice
+}
+
+// IsApprovedByOwners checks whether every changed file in a pull request has been approved by at least one of its owners
+// (or as many as WithApprovals asks for) the owners that could still approve an unsatisfied rule are returned,
+// files that no rule owns need no approval, see ApprovalStatus for which rules and files are approved
+func (co CodeOwners) IsApprovedByOwners(ctx context.Context, number int) (approved bool, outstanding []string, error_slice []error) {
+	summary, error_slice := co.ApprovalStatus(ctx, number)
+	return summary.Approved, summary.Missing, error_slice
+}
+
+// fetches a pull request
+func (s *Service) pullrequest(ctx context.Context, owner string, repo string, number int) (*github.PullRequest, error) {
+	var pull *github.PullRequest
+	_, err := s.call(ctx, "PullRequests.Get", owner+"/"+repo, func() (resp *github.Response, err error) {
+		pull, resp, err = s.client.PullRequests.Get(ctx, owner, repo, number)
+		return resp, err
+	})
+	return pull, err
+}
+
+// ChangeOwners is who owns a set of changed files
+type ChangeOwners struct {
+	// File is the file the changed files were matched against
+	File CodeOwners
+	// Files are the changed files that a rule matches, with their owners
+	Files map[string]MatchResult
+	// Owners are the owners of all the changed files as written in the file, in the order they are first met
+	Owners []string
+	// Users are the users of all the changed files, each once
+	Users []*github.User
+}
+
+// matches the changed files, resolving each owner once, the union is in the order of the paths
+func (co CodeOwners) changeowners(ctx context.Context, paths []string) (result ChangeOwners, error_slice []error) {
+	result.File = co
+	result.Files, error_slice = co.MatchMany(ctx, paths)
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		match, ok := result.Files[path]
+		if !ok {
+			continue
+		}
+		for _, ownertext := range co.ownersfor(path) {
+			if !seen[strings.ToLower(ownertext)] {
+				seen[strings.ToLower(ownertext)] = true
+				result.Owners = append(result.Owners, ownertext)
+			}
+		}
+		result.Users = append(result.Users, match.Users...)
+	}
+	result.Users = distinctusers(result.Users)
+	return result, error_slice
+}
+
+// PullRequestOwners is who owns the files changed in a pull request, File is the file of its base branch
+type PullRequestOwners struct {
+	PullRequest *github.PullRequest
+	ChangeOwners
+}
+
+// ForPullRequest is shorthand for NewService(cl).ForPullRequest
+func ForPullRequest(ctx context.Context, cl *github.Client, owner string, repo string, number int, opts ...GetOption) (PullRequestOwners, []error) {
+	return NewService(cl).ForPullRequest(ctx, owner, repo, number, opts...)
+}
+
+// ForPullRequest matches every file changed in a pull request against the file of its base branch, as github does
+// when requesting reviews, the options are as for Get except that the file is always read at the base branch
+// changed files are listed in the order github lists them, and the users of the union are in that order too
+func (s *Service) ForPullRequest(ctx context.Context, owner string, repo string, number int, opts ...GetOption) (result PullRequestOwners, error_slice []error) {
+	ctx = withrepo(s.operation(ctx), owner, repo)
+	pull, err := s.pullrequest(ctx, owner, repo, number)
+	if err != nil {
+		return result, append(error_slice, err)
+	}
+	result.PullRequest = pull
+	result.File, err = s.Get(ctx, owner, repo, append(append([]GetOption{}, opts...), WithRef(pull.GetBase().GetRef()))...)
+	if err != nil {
+		return result, append(error_slice, err)
+	}
+	paths, err := s.changedfiles(ctx, owner, repo, number)
+	if err != nil {
+		return result, append(error_slice, err)
+	}
+	result.ChangeOwners, error_slice = result.File.changeowners(ctx, paths)
+	return result, error_slice
+}
+
+// the most changed files github lists for a comparison
+const comparefilelimit = 300
+
+// ForCompare is shorthand for NewService(cl).ForCompare
+func ForCompare(ctx context.Context, cl *github.Client, owner string, repo string, base string, head string, opts ...GetOption) (ChangeOwners, []error) {
+	return NewService(cl).ForCompare(ctx, owner, repo, base, head, opts...)
+}
+
+// ForCompare matches every file changed between two refs, eg the last release tag and a release branch, against
+// the file at base, so that the teams who need to sign off a release can be found, the options are as for Get except
+// that the file is always read at base, github lists at most 300 changed files for a comparison so a larger one is
+// worked out by diffing the trees of head and the merge base, when that fails too the owners of the files github did
+// list are returned along with a CodeTruncated warning
+func (s *Service) ForCompare(ctx context.Context, owner string, repo string, base string, head string, opts ...GetOption) (result ChangeOwners, error_slice []error) {
+	ctx = withrepo(s.operation(ctx), owner, repo)
+	var comparison *github.CommitsComparison
+	_, err := s.call(ctx, "Repositories.CompareCommits", owner+"/"+repo, func() (resp *github.Response, err error) {
+		comparison, resp, err = s.client.Repositories.CompareCommits(ctx, owner, repo, base, head)
+		return resp, err
+	})
+	if err != nil {
+		return result, append(error_slice, err)
+	}
+	file, err := s.Get(ctx, owner, repo, append(append([]GetOption{}, opts...), WithRef(base))...)
+	if err != nil {
+		return result, append(error_slice, err)
+	}
+	paths := make([]string, len(comparison.Files))
+	for idx, changed := range comparison.Files {
+		paths[idx] = changed.GetFilename()
+	}
+	if len(comparison.Files) >= comparefilelimit {
+		mergebase := comparison.GetMergeBaseCommit().GetSHA()
+		if mergebase == "" {
+			mergebase = base
+		}
+		diffed, err := s.treediff(ctx, owner, repo, mergebase, head)
+		if err != nil {
+			error_slice = append(error_slice, &Error{
+				Code:     CodeTruncated,
+				Message:  fmt.Sprintf("Only the first %v files changed between %v and %v were matched: %v", len(paths), base, head, err),
+				Severity: SeverityWarning,
+				Err:      err,
+			})
+		} else {
+			paths = diffed
+		}
+	}
+	result, errs := file.changeowners(ctx, paths)
+	return result, append(error_slice, errs...)
+}
+
+// lists the logins of the users asked to review a pull request who have not yet reviewed it
+func (s *Service) requestedreviewers(ctx context.Context, owner string, repo string, number int) (map[string]bool, error) {
+	requested := make(map[string]bool)
+	opt := github.ListOptions{}
+	for {
+		var reviewers *github.Reviewers
+		resp, err := s.call(ctx, "PullRequests.ListReviewers", owner+"/"+repo, func() (resp *github.Response, err error) {
+			reviewers, resp, err = s.client.PullRequests.ListReviewers(ctx, owner, repo, number, &opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range reviewers.Users {
+			requested[strings.ToLower(user.GetLogin())] = true
+		}
+		if resp.NextPage == 0 {
+			return requested, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// ReviewerOptions changes how SuggestReviewers picks reviewers
+type ReviewerOptions struct {
+	// MaxPerRule caps how many owners of each rule are involved in the review, counting those already asked to
+	// review or who have approved, so a rule owned by a big team doesn't pull in all of it, zero is no cap
+	MaxPerRule int
+	// GetOptions are how the file is read, see ForPullRequest
+	GetOptions []GetOption
+}
+
+// SuggestReviewers is shorthand for NewService(cl).SuggestReviewers
+func SuggestReviewers(ctx context.Context, cl *github.Client, owner string, repo string, number int, opts ReviewerOptions) ([]*github.User, []error) {
+	return NewService(cl).SuggestReviewers(ctx, owner, repo, number, opts)
+}
+
+// SuggestReviewers suggests owners of the files changed in a pull request to ask for review, leaving out the author,
+// the users already asked to review and those who have approved, the users are in the order of the rules they own
+// as matched by ForPullRequest, and within a rule in the order Match returns them
+func (s *Service) SuggestReviewers(ctx context.Context, owner string, repo string, number int, opts ReviewerOptions) (suggested []*github.User, error_slice []error) {
+	ctx = withrepo(s.operation(ctx), owner, repo)
+	result, error_slice := s.ForPullRequest(ctx, owner, repo, number, opts.GetOptions...)
+	if result.Files == nil {
+		return nil, error_slice
+	}
+	requested, err := s.requestedreviewers(ctx, owner, repo, number)
+	if err != nil {
+		return nil, append(error_slice, err)
+	}
+	approved, err := s.approvers(ctx, owner, repo, number)
+	if err != nil {
+		return nil, append(error_slice, err)
+	}
+	author := strings.ToLower(result.PullRequest.GetUser().GetLogin())
+	// the users of each rule owning a changed file, in file order
+	rules := make(map[int][]*github.User)
+	var order []int
+	for path, match := range result.Files {
+		idx := result.File.rule(path)
+		if _, ok := rules[idx]; !ok {
+			order = append(order, idx)
+		}
+		rules[idx] = append(rules[idx], match.Users...)
+	}
+	sort.Ints(order)
+	chosen := make(map[string]bool)
+	for _, idx := range order {
+		users := distinctusers(rules[idx])
+		involved := 0
+		for _, user := range users {
+			login := strings.ToLower(user.GetLogin())
+			if login != author && (requested[login] || approved[login] || chosen[login]) {
+				involved++
+			}
+		}
+		for _, user := range users {
+			login := strings.ToLower(user.GetLogin())
+			if opts.MaxPerRule > 0 && involved >= opts.MaxPerRule {
+				break
+			}
+			if login == "" || login == author || requested[login] || approved[login] || chosen[login] {
+				continue
+			}
+			involved++
+			chosen[login] = true
+			suggested = append(suggested, user)
+		}
+	}
+	return suggested, error_slice
+}
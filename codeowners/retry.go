@@ -0,0 +1,180 @@
+package codeowners
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-github/github"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy says how api calls that hit a github rate limit or a transient failure are retried
+// a primary rate limit is waited out until it resets, a secondary rate limit until its Retry-After,
+// or with an exponential backoff from Backoff when github does not say how long to wait, which is
+// also how long to wait after a failure that Retryable accepts
+type RetryPolicy struct {
+	// MaxRetries is how many times a call is retried, zero never retries
+	MaxRetries int
+	// Backoff is the first wait when github gives no time, it doubles with each retry
+	Backoff time.Duration
+	// Jitter is the fraction of a backoff that is added or taken away at random, eg 0.2 for up to 20%,
+	// so that many clients failing together don't all retry at the same moment
+	Jitter float64
+	// MaxWait is the longest a single wait can be, a limit that resets later is returned as an error, zero for no longest
+	MaxWait time.Duration
+	// Retryable reports whether a failure other than a rate limit is worth retrying, RetryTransient when nil
+	// calls that change a repository, such as Save, are never retried after such a failure as the change
+	// may have been made before it
+	Retryable func(resp *github.Response, err error) bool
+}
+
+// DefaultRetryPolicy is used by services that have not been given one with WithRetry
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 3, Backoff: time.Second, Jitter: 0.2, MaxWait: time.Minute}
+
+// RetryTransient retries server errors and requests that failed to get any response, but not the context ending
+func RetryTransient(resp *github.Response, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if resp != nil && resp.Response != nil {
+		return resp.StatusCode >= http.StatusInternalServerError
+	}
+	var neterr net.Error
+	return errors.As(err, &neterr)
+}
+
+// the operations that change a repository or its pull requests
+var writes = map[string]bool{
+	"Repositories.UpdateFile":       true,
+	"Git.CreateRef":                 true,
+	"PullRequests.Create":           true,
+	"PullRequests.RequestReviewers": true,
+}
+
+// the wait before a retry, from the backoff for the attempt with the jitter applied
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	wait := policy.Backoff << uint(attempt)
+	if policy.Jitter > 0 {
+		wait += time.Duration(float64(wait) * policy.Jitter * (2*rand.Float64() - 1))
+	}
+	return wait
+}
+
+// reports whether a failure that isn't a rate limit is worth retrying
+func (policy RetryPolicy) retryable(resp *github.Response, err error) bool {
+	if policy.Retryable == nil {
+		return RetryTransient(resp, err)
+	}
+	return policy.Retryable(resp, err)
+}
+
+// WithRetry returns a copy of the service that retries rate limited calls by the policy
+// WithRetry(RetryPolicy{}) turns retrying off so rate limits are returned straight away
+func (s *Service) WithRetry(policy RetryPolicy) *Service {
+	return s.with(func(s *Service) {
+		s.retry = &policy
+	})
+}
+
+// WithRetry returns a copy of the code owners that retries rate limited calls, see Service.WithRetry
+func (co CodeOwners) WithRetry(policy RetryPolicy) CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.retry = &policy
+	})
+}
+
+// the retry policy of the service
+func (s *Service) policy() RetryPolicy {
+	if s == nil || s.retry == nil {
+		return DefaultRetryPolicy
+	}
+	return *s.retry
+}
+
+// makes an api request, auditing each attempt and retrying it by the service's policy while it is rate limited
+// or fails in a way the policy finds retryable, without a client, eg for a file from Parse, it fails straight away
+// the request returns the response so that its status can be audited and its pages followed
+func (s *Service) call(ctx context.Context, operation string, repo string, request func() (*github.Response, error)) (*github.Response, error) {
+	if s == nil || s.client == nil {
+		return nil, nocall(operation)
+	}
+	policy := s.policy()
+	for attempt := 0; ; attempt++ {
+		if err := s.breaker.allow(operation); err != nil {
+			return nil, err
+		}
+		if err := spend(ctx, operation); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		resp, err := request()
+		s.audit(operation, repo, start, resp, err)
+		ratelimit(ctx, operation, resp)
+		s.breaker.record(resp, err)
+		if err == nil || attempt >= policy.MaxRetries {
+			return resp, err
+		}
+		wait, ok := retryafter(err, policy.backoff(attempt))
+		if !ok && !writes[operation] && policy.retryable(resp, err) {
+			wait, ok = policy.backoff(attempt), true
+		}
+		if !ok || (policy.MaxWait > 0 && wait > policy.MaxWait) {
+			return resp, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		}
+	}
+}
+
+// how long to wait before retrying a call that failed with err, backoff is used when github does not say
+// and false when the error is not a rate limit
+func retryafter(err error, backoff time.Duration) (time.Duration, bool) {
+	var ratelimit *github.RateLimitError
+	var abuse *github.AbuseRateLimitError
+	var response *github.ErrorResponse
+	switch {
+	case errors.As(err, &ratelimit):
+		return time.Until(ratelimit.Rate.Reset.Time), true
+	case errors.As(err, &abuse):
+		if abuse.RetryAfter != nil {
+			return *abuse.RetryAfter, true
+		}
+		return backoff, true
+	case errors.As(err, &response) && secondarylimit(response):
+		if seconds, err := strconv.Atoi(response.Response.Header.Get("Retry-After")); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if response.Response.Header.Get("X-RateLimit-Remaining") == "0" {
+			if reset, err := strconv.ParseInt(response.Response.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+				return time.Until(time.Unix(reset, 0)), true
+			}
+		}
+		return backoff, true
+	}
+	return 0, false
+}
+
+// reports whether an error response is a secondary rate limit, which go-github only recognises by an
+// old documentation url so newer responses arrive as a plain ErrorResponse
+func secondarylimit(response *github.ErrorResponse) bool {
+	if response.Response == nil {
+		return false
+	}
+	switch response.Response.StatusCode {
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return strings.Contains(strings.ToLower(response.Message), "secondary rate limit") || response.Response.Header.Get("Retry-After") != ""
+	}
+	return false
+}
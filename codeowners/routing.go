@@ -0,0 +1,114 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/github"
+	"log"
+	"strings"
+)
+
+// RoutingMode is how AssignReviewers treats teams that have github's code review assignment turned on
+type RoutingMode int
+
+const (
+	// RoutingIgnore asks members of every team chosen by the Strategy, whatever the team's settings
+	RoutingIgnore RoutingMode = iota
+	// RoutingDelegate asks a team with review assignment turned on itself, leaving github to pick the members
+	RoutingDelegate
+	// RoutingEmulate picks as many members of a team with review assignment as the team is set to, with the
+	// Strategy, which should match the team's algorithm, eg NewRoundRobin for RoutingRoundRobin, and also asks
+	// the team when it is set to notify the whole team
+	RoutingEmulate
+)
+
+// the algorithms github routes reviews with
+const (
+	RoutingRoundRobin  = "ROUND_ROBIN"
+	RoutingLoadBalance = "LOAD_BALANCE"
+)
+
+// TeamRouting is a team's code review assignment settings
+type TeamRouting struct {
+	Enabled bool `json:"reviewRequestDelegationEnabled"`
+	// Algorithm is RoutingRoundRobin or RoutingLoadBalance
+	Algorithm string `json:"reviewRequestDelegationAlgorithm"`
+	// MemberCount is how many members github asks
+	MemberCount int `json:"reviewRequestDelegationMemberCount"`
+	// NotifyTeam is set when the whole team is still told of the request
+	NotifyTeam bool `json:"reviewRequestDelegationNotifyTeam"`
+}
+
+// the query for the review assignment settings of a team, which the rest api does not have
+const teamroutingquery = `query($org: String!, $slug: String!) {
+  organization(login: $org) {
+    team(slug: $slug) {
+      reviewRequestDelegationEnabled
+      reviewRequestDelegationAlgorithm
+      reviewRequestDelegationMemberCount
+      reviewRequestDelegationNotifyTeam
+    }
+  }
+}`
+
+// the settings of a team as graphql returns them
+type graphqlrouting struct {
+	Data struct {
+		Organization *struct {
+			Team *TeamRouting `json:"team"`
+		} `json:"organization"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// TeamRouting reads the code review assignment settings of a team written as @org/team
+func (s *Service) TeamRouting(ctx context.Context, fullteam string) (TeamRouting, error) {
+	ctx = s.operation(ctx)
+	var routing TeamRouting
+	key := cachekey("routing", fullteam)
+	if s.cached(ctx, key, &routing) {
+		return routing, nil
+	}
+	split := strings.Index(fullteam, "/")
+	if !strings.HasPrefix(fullteam, "@") || split < 0 {
+		return routing, &Error{Code: CodeInvalidOwner, Message: fmt.Sprintf("%v is not a team", fullteam)}
+	}
+	variables := map[string]interface{}{"org": fullteam[1:split], "slug": fullteam[split+1:]}
+	var response graphqlrouting
+	_, err := s.call(ctx, "GraphQL", repoof(ctx), func() (*github.Response, error) {
+		req, err := s.client.NewRequest("POST", s.graphqlendpoint(), map[string]interface{}{"query": teamroutingquery, "variables": variables})
+		if err != nil {
+			return nil, err
+		}
+		return s.client.Do(ctx, req, &response)
+	})
+	if err != nil {
+		return routing, err
+	}
+	organization := response.Data.Organization
+	if organization == nil || organization.Team == nil {
+		message := fmt.Sprintf("Failed to find team matching %v", fullteam[split+1:])
+		if len(response.Errors) > 0 {
+			message += ": " + response.Errors[0].Message
+		}
+		return routing, unknownowner(message, ErrTeamNotFound, nil)
+	}
+	routing = *organization.Team
+	s.store(key, routing)
+	return routing, nil
+}
+
+// the settings of a team for AssignReviewers, a team whose settings can't be read is taken to have none
+func (s *Service) routingfor(ctx context.Context, fullteam string, mode RoutingMode) TeamRouting {
+	if mode == RoutingIgnore {
+		return TeamRouting{}
+	}
+	routing, err := s.TeamRouting(ctx, fullteam)
+	if err != nil {
+		log.Print("Asking members of ", fullteam, " without its review assignment settings ", err)
+		return TeamRouting{}
+	}
+	return routing
+}
@@ -0,0 +1,95 @@
+package codeowners
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// the parts of the SARIF 2.1.0 format that are needed to report errors against a file
+type sariflog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifrun `json:"runs"`
+}
+
+type sarifrun struct {
+	Tool    sariftool     `json:"tool"`
+	Results []sarifresult `json:"results"`
+}
+
+type sariftool struct {
+	Driver sarifdriver `json:"driver"`
+}
+
+type sarifdriver struct {
+	Name           string `json:"name"`
+	InformationURI string `json:"informationUri"`
+}
+
+type sarifresult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifmessage    `json:"message"`
+	Locations []sariflocation `json:"locations"`
+}
+
+type sarifmessage struct {
+	Text string `json:"text"`
+}
+
+type sariflocation struct {
+	PhysicalLocation sarifphysical `json:"physicalLocation"`
+}
+
+type sarifphysical struct {
+	ArtifactLocation sarifartifact `json:"artifactLocation"`
+	Region           *sarifregion  `json:"region,omitempty"`
+}
+
+type sarifartifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifregion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// SARIF renders errors as a SARIF 2.1.0 log for code scanning tools, each result uses the Code of
+// its error as the rule and points at its line and column of the file named by uri when it has one
+func SARIF(uri string, errs []error) ([]byte, error) {
+	run := sarifrun{
+		Tool: sariftool{Driver: sarifdriver{
+			Name:           "go-github-codeowners",
+			InformationURI: "https://github.com/ddub/go-github-codeowners",
+		}},
+		Results: []sarifresult{},
+	}
+	for _, err := range errs {
+		result := sarifresult{
+			RuleID:  string(CodeOf(err)),
+			Level:   "error",
+			Message: sarifmessage{Text: err.Error()},
+		}
+		location := sariflocation{PhysicalLocation: sarifphysical{ArtifactLocation: sarifartifact{URI: uri}}}
+		var coded *Error
+		if errors.As(err, &coded) {
+			if coded == err {
+				result.Message.Text = coded.Message
+			}
+			if coded.Severity == SeverityWarning {
+				result.Level = "warning"
+			}
+			if coded.Line > 0 {
+				location.PhysicalLocation.Region = &sarifregion{StartLine: coded.Line, StartColumn: coded.Column}
+			}
+		}
+		result.Locations = []sariflocation{location}
+		run.Results = append(run.Results, result)
+	}
+	return json.Marshal(sariflog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifrun{run},
+	})
+}
@@ -0,0 +1,157 @@
+package codeowners
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/google/go-github/github"
+	"net/http"
+)
+
+// SaveOptions describes the commit Save makes
+type SaveOptions struct {
+	// Branch is committed to, it is created from the branch the file was read from if it does not exist
+	// when empty the commit goes straight onto the branch the file was read from
+	Branch string
+	// Message is the commit message, "Update CODEOWNERS" when empty
+	Message string
+	// PullRequest opens a pull request from Branch into the branch the file was read from when set
+	PullRequest *PullRequestOptions
+}
+
+// PullRequestOptions describes the pull request Save opens
+type PullRequestOptions struct {
+	Title string
+	Body  string
+}
+
+// SaveResult is what Save committed
+type SaveResult struct {
+	// Commit is the sha of the new commit
+	Commit string
+	// Source is where the saved file now lives, Get with its Ref reads it back
+	Source Source
+	// PullRequest is the pull request that was opened, if one was asked for
+	PullRequest *github.PullRequest
+}
+
+// the branch a file was read from, looking up the default branch when it was read without a ref
+func (s *Service) basebranch(ctx context.Context, owner string, repo string, ref string) (string, error) {
+	if ref != "" {
+		return ref, nil
+	}
+	var repository *github.Repository
+	_, err := s.call(ctx, "Repositories.Get", owner+"/"+repo, func() (resp *github.Response, err error) {
+		repository, resp, err = s.client.Repositories.Get(ctx, owner, repo)
+		return resp, err
+	})
+	if err != nil {
+		return "", apierror(err, CodeNotFound)
+	}
+	return repository.GetDefaultBranch(), nil
+}
+
+// creates a branch from the head of base unless it already exists
+func (s *Service) ensurebranch(ctx context.Context, owner string, repo string, branch string, base string) error {
+	_, err := s.call(ctx, "Repositories.GetBranch", owner+"/"+repo, func() (resp *github.Response, err error) {
+		_, resp, err = s.client.Repositories.GetBranch(ctx, owner, repo, branch)
+		return resp, err
+	})
+	if err == nil || apicode(err, CodeNotFound) != CodeNotFound {
+		return apierror(err, CodeNotFound)
+	}
+	var head *github.Branch
+	_, err = s.call(ctx, "Repositories.GetBranch", owner+"/"+repo, func() (resp *github.Response, err error) {
+		head, resp, err = s.client.Repositories.GetBranch(ctx, owner, repo, base)
+		return resp, err
+	})
+	if err != nil {
+		return apierror(err, CodeNotFound)
+	}
+	ref := "refs/heads/" + branch
+	_, err = s.call(ctx, "Git.CreateRef", owner+"/"+repo, func() (resp *github.Response, err error) {
+		_, resp, err = s.client.Git.CreateRef(ctx, owner, repo, &github.Reference{
+			Ref:    &ref,
+			Object: &github.GitObject{SHA: head.GetCommit().SHA},
+		})
+		return resp, err
+	})
+	return apierror(err, CodeNotFound)
+}
+
+// Save commits the file, with any edits, back to the repository it was read from
+// the commit is refused with ErrConflict if the file on the branch has changed since it was read,
+// in which case Get it again, reapply the edits and save that instead
+func (co CodeOwners) Save(ctx context.Context, opts SaveOptions) (SaveResult, error) {
+	ctx = co.operation(ctx)
+	if co.service == nil || co.service.client == nil || co.owner == "" {
+		return SaveResult{}, &Error{Code: CodeAPI, Message: "Only files read with Get can be saved"}
+	}
+	s := co.service
+	base, err := s.basebranch(ctx, co.owner, co.repo, co.source.Ref)
+	if err != nil {
+		return SaveResult{}, err
+	}
+	branch := opts.Branch
+	if branch == "" {
+		branch = base
+	} else if err := s.ensurebranch(ctx, co.owner, co.repo, branch, base); err != nil {
+		return SaveResult{}, err
+	}
+	// the file on the branch has to be the one that was read or someone else's change would be lost
+	var current *github.RepositoryContent
+	resp, err := s.call(ctx, "Repositories.GetContents", co.owner+"/"+co.repo, func() (resp *github.Response, err error) {
+		current, _, resp, err = s.client.Repositories.GetContents(ctx, co.owner, co.repo, co.source.Path, &github.RepositoryContentGetOptions{Ref: branch})
+		return resp, err
+	})
+	if err != nil {
+		return SaveResult{}, apierror(err, CodeNotFound)
+	}
+	if current.GetSHA() != co.source.SHA {
+		return SaveResult{}, &Error{Code: CodeConflict, Message: fmt.Sprintf("%v on %v has changed since it was read", co.source.Path, branch)}
+	}
+	message := opts.Message
+	if message == "" {
+		message = "Update CODEOWNERS"
+	}
+	var content bytes.Buffer
+	co.WriteTo(&content)
+	var written *github.RepositoryContentResponse
+	resp, err = s.call(ctx, "Repositories.UpdateFile", co.owner+"/"+co.repo, func() (resp *github.Response, err error) {
+		written, resp, err = s.client.Repositories.UpdateFile(ctx, co.owner, co.repo, co.source.Path, &github.RepositoryContentFileOptions{
+			Message: &message,
+			Content: content.Bytes(),
+			SHA:     &co.source.SHA,
+			Branch:  &branch,
+		})
+		return resp, err
+	})
+	if resp != nil && resp.Response != nil && resp.StatusCode == http.StatusConflict {
+		return SaveResult{}, &Error{Code: CodeConflict, Message: fmt.Sprintf("%v on %v has changed since it was read", co.source.Path, branch), Err: err}
+	}
+	if err != nil {
+		return SaveResult{}, apierror(err, CodeNotFound)
+	}
+	result := SaveResult{
+		Commit: written.Commit.GetSHA(),
+		Source: Source{
+			Path:    co.source.Path,
+			SHA:     written.Content.GetSHA(),
+			HTMLURL: written.Content.GetHTMLURL(),
+			Ref:     branch,
+		},
+	}
+	if opts.PullRequest == nil || branch == base {
+		return result, nil
+	}
+	resp, err = s.call(ctx, "PullRequests.Create", co.owner+"/"+co.repo, func() (resp *github.Response, err error) {
+		result.PullRequest, resp, err = s.client.PullRequests.Create(ctx, co.owner, co.repo, &github.NewPullRequest{
+			Title: &opts.PullRequest.Title,
+			Body:  &opts.PullRequest.Body,
+			Head:  &branch,
+			Base:  &base,
+		})
+		return resp, err
+	})
+	return result, apierror(err, CodeAPI)
+}
@@ -0,0 +1,133 @@
+package codeowners
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-github/github"
+	"net/http"
+	"sync"
+)
+
+// reasons a repository is skipped during an org scan
+const (
+	SkipArchived     = "archived"
+	SkipEmpty        = "empty"
+	SkipAccessDenied = "access denied"
+)
+
+// RepoScan is the outcome of reading the CODEOWNERS file of one repository in an org scan
+type RepoScan struct {
+	Repo   string
+	Owners CodeOwners
+	// Skipped is why the repository was not read (SkipArchived, SkipEmpty or SkipAccessDenied), empty when it was
+	Skipped string
+	// Err is any other failure, including a repository without a CODEOWNERS file
+	Err error
+}
+
+// the reason to skip a repository given the error from fetching its CODEOWNERS, if it is one worth skipping
+func skipreason(err error) string {
+	var e *github.ErrorResponse
+	if !errors.As(err, &e) || e.Response == nil {
+		return ""
+	}
+	switch e.Response.StatusCode {
+	case http.StatusForbidden:
+		return SkipAccessDenied
+	case http.StatusConflict:
+		// github answers 409 Git Repository is empty
+		return SkipEmpty
+	}
+	return ""
+}
+
+// ScanOrg is shorthand for NewService(cl).ScanOrg
+func ScanOrg(ctx context.Context, cl *github.Client, org string) ([]RepoScan, error) {
+	return NewService(cl).ScanOrg(ctx, org)
+}
+
+// ScanOrg reads the CODEOWNERS file of every repository in an org
+// archived, empty and inaccessible repositories are reported as skipped with a reason rather than as errors
+func (s *Service) ScanOrg(ctx context.Context, org string) ([]RepoScan, error) {
+	ctx = s.operation(ctx)
+	var repos []*github.Repository
+	opt := github.RepositoryListByOrgOptions{}
+	for {
+		var page []*github.Repository
+		resp, err := s.call(ctx, "Repositories.ListByOrg", org, func() (resp *github.Response, err error) {
+			page, resp, err = s.client.Repositories.ListByOrg(ctx, org, &opt)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	scans := make([]RepoScan, len(repos))
+	for idx, repo := range repos {
+		scans[idx].Repo = repo.GetName()
+		switch {
+		case repo.GetArchived():
+			scans[idx].Skipped = SkipArchived
+		case repo.GetSize() == 0:
+			scans[idx].Skipped = SkipEmpty
+		default:
+			scans[idx].Owners, scans[idx].Err = s.Get(ctx, org, repo.GetName())
+			if reason := skipreason(scans[idx].Err); reason != "" {
+				scans[idx].Skipped, scans[idx].Err = reason, nil
+			}
+		}
+	}
+	return scans, nil
+}
+
+// RepoRef names a repository for GetAll
+type RepoRef struct {
+	Owner string
+	Repo  string
+}
+
+// RepoResult is the outcome of reading the CODEOWNERS file of one repository in GetAll
+type RepoResult struct {
+	RepoRef
+	Owners CodeOwners
+	// Err is why the file could not be read, a CodeCanceled error for a repository that was never tried
+	// because the context ended first
+	Err error
+}
+
+// GetAll is shorthand for NewService(cl).GetAll
+func GetAll(ctx context.Context, cl *github.Client, repos []RepoRef, opts ...GetOption) []RepoResult {
+	return NewService(cl).GetAll(ctx, repos, opts...)
+}
+
+// GetAll reads the CODEOWNERS file of many repositories at once, each with Get and the same options
+// the repositories are read concurrently, as many at a time as the service makes lookups, see WithMaxConcurrency,
+// and share its cache, retries and circuit breaker, each read is its own operation for WithMaxAPIRequests
+// there is a result for every repository, in the order they were given
+func (s *Service) GetAll(ctx context.Context, repos []RepoRef, opts ...GetOption) []RepoResult {
+	results := make([]RepoResult, len(repos))
+	slots := s.semaphore()
+	var wait sync.WaitGroup
+	for idx, repo := range repos {
+		results[idx].RepoRef = repo
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[idx].Err = canceled(ctx.Err())
+			continue
+		}
+		wait.Add(1)
+		go func(result *RepoResult) {
+			defer wait.Done()
+			defer func() { <-slots }()
+			result.Owners, result.Err = s.Get(ctx, result.Owner, result.Repo, opts...)
+		}(&results[idx])
+	}
+	wait.Wait()
+	return results
+}
@@ -0,0 +1,151 @@
+package codeowners
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SectionMode chooses whether lines like [Documentation] start a section, as in files written for gitlab
+type SectionMode int
+
+const (
+	// SectionsNone follows github, which has no sections, a [Documentation] line is a pattern like any other
+	SectionsNone SectionMode = iota
+	// SectionsGitLab reads gitlab section headers, every section is matched on its own so a path gets the
+	// owners of the last matching rule in each section rather than only of the last rule in the file
+	//
+	//	[Documentation] @org/writers
+	//	docs/
+	//	^[Optional][2] @alice
+	//	*.go
+	//
+	// a rule without owners takes the default owners written after its section header, ^ marks a section
+	// whose approval is optional and [2] asks for two approvals
+	SectionsGitLab
+)
+
+// Section is the gitlab section a rule is written in, the zero Section is the part of the file before any header
+type Section struct {
+	Name string
+	// Optional sections list owners but do not need their approval
+	Optional bool
+	// Approvals is how many owner approvals the section asks for, zero when the header does not say
+	Approvals int
+	// Owners are the default owners of rules in the section that do not name any
+	Owners []string
+	// Line is where the header is in the file, counting from 1
+	Line int
+}
+
+// a section header, eg ^[Optional][2] @alice
+var sectionheader = regexp.MustCompile(`^(\^)?\[([^\]]+)\](?:\[(\d+)\])?(?:\s+(.*))?$`)
+
+// Section is the section the rule is written in, see SectionsGitLab
+func (co CodeOwner) Section() Section {
+	return co.section
+}
+
+// reads a section header, if the line is one
+func header(line string) (Section, bool) {
+	rule, _ := splitcomment(line)
+	parts := sectionheader.FindStringSubmatch(strings.TrimSpace(rule))
+	if parts == nil {
+		return Section{}, false
+	}
+	section := Section{
+		Name:     strings.TrimSpace(parts[2]),
+		Optional: parts[1] != "",
+		Owners:   strings.Fields(parts[4]),
+	}
+	section.Approvals, _ = strconv.Atoi(parts[3])
+	return section, true
+}
+
+// WithSections returns a copy of the code owners that reads sections the given way
+// the rules are read again from the file, so any Include has to come after it
+func (co CodeOwners) WithSections(mode SectionMode) CodeOwners {
+	co.sections = mode
+	co.memo = &memo{rules: make(map[string]int)}
+	if co.document.lines != nil {
+		co.patterns = co.sectioned(parse(strings.Join(co.document.lines, "\n")))
+	}
+	return co
+}
+
+// takes the section headers out of the rules and records the section on each rule below one
+// rules that were included from another file belong to the section they were included in
+func (co CodeOwners) sectioned(patterns []CodeOwner) []CodeOwner {
+	if co.sections != SectionsGitLab {
+		return patterns
+	}
+	kept := make([]CodeOwner, 0, len(patterns))
+	current := Section{}
+	for _, rule := range patterns {
+		if rule.file == "" && rule.line > 0 && rule.line <= len(co.document.lines) {
+			if section, ok := header(co.document.lines[rule.line-1]); ok {
+				section.Line = rule.line
+				current = section
+				continue
+			}
+		}
+		rule.section = current
+		kept = append(kept, rule)
+	}
+	return kept
+}
+
+// the owners a rule gives, which are the section defaults when the rule names none
+func (co CodeOwners) ruleowners(rule CodeOwner) []string {
+	if len(rule.owners) == 0 && co.sections == SectionsGitLab {
+		return rule.section.Owners
+	}
+	return rule.owners
+}
+
+// the indexes of the rules that own a path, the last matching rule of each section in file order
+// or just the last matching rule when there are no sections
+func (co CodeOwners) rulesfor(path string) []int {
+	if co.sections != SectionsGitLab {
+		if idx := co.rule(path); idx >= 0 {
+			return []int{idx}
+		}
+		return nil
+	}
+	var order []string
+	last := make(map[string]int)
+	for idx, rule := range co.patterns {
+		if !co.matchesrule(rule, path) {
+			continue
+		}
+		name := strings.ToLower(rule.section.Name)
+		if _, ok := last[name]; !ok {
+			order = append(order, name)
+		}
+		last[name] = idx
+	}
+	rules := make([]int, len(order))
+	for idx, name := range order {
+		rules[idx] = last[name]
+	}
+	return rules
+}
+
+// the owners from each section that has a rule matching the path, nil when no rule matches
+func (co CodeOwners) sectionowners(path string) []string {
+	rules := co.rulesfor(path)
+	if rules == nil {
+		return nil
+	}
+	owners := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, idx := range rules {
+		for _, ownertext := range co.aliases.expand(co.ruleowners(co.patterns[idx])) {
+			if !seen[ownertext] {
+				seen[ownertext] = true
+				owners = append(owners, ownertext)
+			}
+		}
+	}
+	return owners
+}
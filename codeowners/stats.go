@@ -0,0 +1,83 @@
+package codeowners
+
+import (
+	"context"
+	"github.com/google/go-github/github"
+	"strings"
+	"sync"
+)
+
+// Stats is how much of the github api an operation used, for logging and alerting on consumption
+type Stats struct {
+	// Requests is how many requests were made, retries included
+	Requests int
+	// CacheHits is how many lookups were answered by the cache, or by owners resolved by an earlier Match, instead
+	CacheHits int
+	// RateLimit is the core rate limit as of the last response, zero when no request was made
+	RateLimit github.Rate
+}
+
+// usage is what an operation in progress has used, it is kept in the context so that every call the
+// operation makes, however deep, adds to the same one
+type usage struct {
+	lock sync.Mutex
+	// limit is how many requests the operation can make, see WithMaxAPIRequests
+	limit int
+	stats Stats
+}
+
+// the context key of the usage of the operation in progress
+type usagekey struct{}
+
+// the context for an operation, which records its usage unless it is part of an operation that already does
+func (s *Service) operation(ctx context.Context) context.Context {
+	if usageof(ctx) != nil {
+		return ctx
+	}
+	u := &usage{}
+	if s != nil {
+		u.limit = s.maxrequests
+	}
+	return context.WithValue(ctx, usagekey{}, u)
+}
+
+// the usage of the operation the context is for, nil outside of one
+func usageof(ctx context.Context) *usage {
+	u, _ := ctx.Value(usagekey{}).(*usage)
+	return u
+}
+
+// what the operation the context is for has used so far
+func statsof(ctx context.Context) Stats {
+	u := usageof(ctx)
+	if u == nil {
+		return Stats{}
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return u.stats
+}
+
+// counts lookups that did not need a request
+func hits(ctx context.Context, n int) {
+	if u := usageof(ctx); u != nil && n > 0 {
+		u.lock.Lock()
+		u.stats.CacheHits += n
+		u.lock.Unlock()
+	}
+}
+
+// keeps the rate limit of a response, concurrent responses can arrive out of order so the lowest remaining
+// count within the latest reset window is the most recent, graphql and search have limits of their own
+func ratelimit(ctx context.Context, operation string, resp *github.Response) {
+	u := usageof(ctx)
+	if u == nil || resp == nil || resp.Rate.Limit == 0 || operation == "GraphQL" || strings.HasPrefix(operation, "Search.") {
+		return
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	current := u.stats.RateLimit
+	if current.Limit == 0 || resp.Rate.Reset.After(current.Reset.Time) || (resp.Rate.Reset.Equal(current.Reset) && resp.Rate.Remaining < current.Remaining) {
+		u.stats.RateLimit = resp.Rate
+	}
+}
@@ -0,0 +1,101 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/github"
+	"log"
+	"strings"
+)
+
+// WithGraphQLTeams returns a copy of the code owners that lists the members of a team with a graphql query
+// rather than listing every team in the org and then the members of each team, child teams are included by
+// github itself with WithChildTeams, and the members come with their details so a team is expanded in one or
+// two queries, when graphql fails the rest api is used instead
+func (co CodeOwners) WithGraphQLTeams() CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.expansion.graphqlteams = true
+	})
+}
+
+// the query for a page of the members of a team
+const teammembersquery = `query($org: String!, $slug: String!, $membership: TeamMembershipType, $role: TeamMemberRole, $cursor: String) {
+  organization(login: $org) {
+    team(slug: $slug) {
+      members(first: 100, after: $cursor, membership: $membership, role: $role) {
+        pageInfo { hasNextPage endCursor }
+        nodes { login name email databaseId avatarUrl url }
+      }
+    }
+  }
+}`
+
+// a page of the members of a team as graphql returns it
+type graphqlmembers struct {
+	Data struct {
+		Organization *struct {
+			Team *struct {
+				Members struct {
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+					Nodes []graphqluser `json:"nodes"`
+				} `json:"members"`
+			} `json:"team"`
+		} `json:"organization"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// fetches the logins of the members of a team with graphql, keeping their details in the cache for hydrate
+// a team graphql can't find is unknown, any other failure falls back to the rest api
+func (s *Service) graphqlmembers(fullteam string, ctx context.Context) ([]string, error) {
+	split := strings.Index(fullteam, "/")
+	variables := map[string]interface{}{
+		"org":        fullteam[1:split],
+		"slug":       fullteam[split+1:],
+		"membership": "IMMEDIATE",
+	}
+	if s.expansion.childteams {
+		variables["membership"] = "ALL"
+	}
+	if s.expansion.role != "" && s.expansion.role != TeamRoleAll {
+		variables["role"] = strings.ToUpper(string(s.expansion.role))
+	}
+	logins := make([]string, 0)
+	for {
+		var response graphqlmembers
+		// the request is made afresh for every attempt as sending it uses up its body
+		_, err := s.call(ctx, "GraphQL", repoof(ctx), func() (*github.Response, error) {
+			req, err := s.client.NewRequest("POST", s.graphqlendpoint(), map[string]interface{}{"query": teammembersquery, "variables": variables})
+			if err != nil {
+				return nil, err
+			}
+			return s.client.Do(ctx, req, &response)
+		})
+		if err != nil {
+			log.Print("Falling back to listing team members with the rest api ", err)
+			return s.restmembers(fullteam, ctx)
+		}
+		organization := response.Data.Organization
+		if organization == nil || organization.Team == nil {
+			message := fmt.Sprintf("Failed to find team matching %v", fullteam[split+1:])
+			if len(response.Errors) > 0 {
+				message += ": " + response.Errors[0].Message
+			}
+			return nil, unknownowner(message, ErrTeamNotFound, nil)
+		}
+		members := organization.Team.Members
+		for _, member := range members.Nodes {
+			logins = append(logins, member.Login)
+			s.store(cachekey("user", member.Login), member.user())
+		}
+		if !members.PageInfo.HasNextPage {
+			return logins, nil
+		}
+		variables["cursor"] = members.PageInfo.EndCursor
+	}
+}
@@ -0,0 +1,171 @@
+package codeowners
+
+import (
+	"context"
+	"github.com/google/go-github/github"
+	"strings"
+)
+
+// TeamOwner is a team that owns a path, kept whole rather than flattened into its members
+type TeamOwner struct {
+	// Owner is the team as it was written in the CODEOWNERS file, eg @org/team
+	Owner string
+	Team  *github.Team
+	// Hierarchy runs from the top level parent team down to Team itself
+	Hierarchy []*github.Team
+}
+
+// Parent is the team directly above this one, or nil for a top level team
+func (to TeamOwner) Parent() *github.Team {
+	if len(to.Hierarchy) < 2 {
+		return nil
+	}
+	return to.Hierarchy[len(to.Hierarchy)-2]
+}
+
+// Path joins the slugs of the hierarchy, eg engineering/platform/backend
+func (to TeamOwner) Path() string {
+	slugs := make([]string, len(to.Hierarchy))
+	for idx, team := range to.Hierarchy {
+		slugs[idx] = team.GetSlug()
+	}
+	return strings.Join(slugs, "/")
+}
+
+// walk from a team up through its parents using the list of every team in the org
+func hierarchy(team *github.Team, teams []*github.Team) []*github.Team {
+	byid := make(map[int64]*github.Team, len(teams))
+	for _, t := range teams {
+		byid[t.GetID()] = t
+	}
+	chain := []*github.Team{team}
+	seen := map[int64]bool{team.GetID(): true}
+	for parent := team.Parent; parent != nil && !seen[parent.GetID()]; {
+		seen[parent.GetID()] = true
+		if full, ok := byid[parent.GetID()]; ok {
+			parent = full
+		}
+		chain = append([]*github.Team{parent}, chain...)
+		parent = parent.Parent
+	}
+	return chain
+}
+
+// the choices that change which users a team is expanded into
+type expansion struct {
+	childteams bool
+	role       TeamRoleFilter
+	// emails are searched for on github, see WithEmailLookup
+	emails bool
+	// graphqlusers fetches the owners written as logins in batches, see WithGraphQLUsers
+	graphqlusers bool
+	// graphqlteams lists the members of teams with graphql, see WithGraphQLTeams
+	graphqlteams bool
+	// filters leave users out of the expansion, see WithFilters
+	filters []ResolutionFilter
+	// memberlogins lists teams as the logins of their members in MatchLogins, see WithMemberLogins
+	memberlogins bool
+}
+
+// TeamRoleFilter chooses which members of a team it is expanded into by their role in the team
+type TeamRoleFilter string
+
+// the roles a team can be filtered to, the zero TeamRoleFilter is TeamRoleAll
+const (
+	TeamRoleAll        TeamRoleFilter = "all"
+	TeamRoleMember     TeamRoleFilter = "member"
+	TeamRoleMaintainer TeamRoleFilter = "maintainer"
+)
+
+// a copy of the service with a change made to it, a nil service is a new one without a client
+func (s *Service) with(change func(*Service)) *Service {
+	if s == nil {
+		s = NewService(nil)
+	}
+	copied := *s
+	change(&copied)
+	return &copied
+}
+
+// a copy of the code owners using a changed copy of its service, owners it already resolved are forgotten
+func (co CodeOwners) withservice(change func(*Service)) CodeOwners {
+	co.service = co.service.with(change)
+	co.memo = &memo{rules: make(map[string]int)}
+	return co
+}
+
+// WithChildTeams returns a copy of the code owners that expands a team into the members of its child teams
+// as well as its own, at every depth, which is the membership github itself counts for review
+func (co CodeOwners) WithChildTeams() CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.expansion.childteams = true
+	})
+}
+
+// WithTeamRole returns a copy of the code owners that expands teams into only their members with the role,
+// eg TeamRoleMaintainer to escalate to the maintainers of an owning team rather than everyone in it
+func (co CodeOwners) WithTeamRole(role TeamRoleFilter) CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.expansion.role = role
+	})
+}
+
+// every team below a team, using the list of every team in the org
+// a team is only visited once so a loop in the parents can't recurse forever
+func children(team *github.Team, teams []*github.Team) []*github.Team {
+	var found []*github.Team
+	seen := map[int64]bool{team.GetID(): true}
+	queue := []int64{team.GetID()}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, child := range teams {
+			if child.Parent != nil && child.Parent.GetID() == parent && !seen[child.GetID()] {
+				seen[child.GetID()] = true
+				found = append(found, child)
+				queue = append(queue, child.GetID())
+			}
+		}
+	}
+	return found
+}
+
+// Teams returns the teams that own a path without expanding them into users
+// each team carries its place in the org's team hierarchy so ownership can be rolled up
+// logins and email owners of the matching rule are ignored
+func (co CodeOwners) Teams(ctx context.Context, path string) (teams []TeamOwner, error_slice []error) {
+	ctx = co.operation(ctx)
+	owners, err := co.owned(path)
+	if err != nil {
+		error_slice = append(error_slice, err)
+		return nil, error_slice
+	}
+	for _, ownertext := range owners {
+		if !strings.HasPrefix(ownertext, "@") || !strings.Contains(ownertext, "/") {
+			continue
+		}
+		team, err := co.teamowner(ctx, ownertext)
+		if err != nil {
+			error_slice = append(error_slice, err)
+			continue
+		}
+		teams = append(teams, team)
+	}
+	return teams, error_slice
+}
+
+// looks up a team written as @org/slug along with its place in the hierarchy
+func (co CodeOwners) teamowner(ctx context.Context, ownertext string) (TeamOwner, error) {
+	if co.service == nil || co.service.client == nil {
+		return TeamOwner{}, noclient(ownertext)
+	}
+	team, all, err := co.service.findteam(ownertext, ctx)
+	if err != nil {
+		return TeamOwner{}, err
+	}
+	return TeamOwner{
+		Owner:     ownertext,
+		Team:      team,
+		Hierarchy: hierarchy(team, all),
+	}, nil
+}
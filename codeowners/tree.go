@@ -0,0 +1,275 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/github"
+	"sort"
+	"strings"
+)
+
+// lists every file in the repository at a ref using the recursive git tree, an empty ref is the default branch
+func (s *Service) treefiles(ctx context.Context, owner string, repo string, ref string) ([]string, error) {
+	if ref == "" {
+		var repository *github.Repository
+		_, err := s.call(ctx, "Repositories.Get", owner+"/"+repo, func() (resp *github.Response, err error) {
+			repository, resp, err = s.client.Repositories.Get(ctx, owner, repo)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		ref = repository.GetDefaultBranch()
+	}
+	var files []string
+	err := s.walktree(ctx, owner, repo, ref, "", func(path string, entry github.TreeEntry) {
+		files = append(files, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// lists the files that differ between the trees of two commits, in order of path, including those added or deleted
+// it reads both whole trees so it is only used when github cuts a comparison short
+func (s *Service) treediff(ctx context.Context, owner string, repo string, base string, head string) ([]string, error) {
+	blobs := make(map[string]string)
+	err := s.walktree(ctx, owner, repo, base, "", func(path string, entry github.TreeEntry) {
+		blobs[path] = entry.GetSHA()
+	})
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	err = s.walktree(ctx, owner, repo, head, "", func(path string, entry github.TreeEntry) {
+		sha, ok := blobs[path]
+		if !ok || sha != entry.GetSHA() {
+			paths = append(paths, path)
+		}
+		delete(blobs, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for path := range blobs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// a git tree as the api returns it, go-github leaves out whether the listing was truncated
+type gittree struct {
+	Entries   []github.TreeEntry `json:"tree"`
+	Truncated bool               `json:"truncated"`
+}
+
+// fetches a tree, which may be a ref, listing everything below it when recursive
+func (s *Service) gettree(ctx context.Context, owner string, repo string, sha string, recursive bool) (*gittree, error) {
+	path := fmt.Sprintf("repos/%v/%v/git/trees/%v", owner, repo, sha)
+	if recursive {
+		path += "?recursive=1"
+	}
+	tree := new(gittree)
+	_, err := s.call(ctx, "Git.GetTree", owner+"/"+repo, func() (*github.Response, error) {
+		req, err := s.client.NewRequest("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+		return s.client.Do(ctx, req, tree)
+	})
+	return tree, err
+}
+
+// calls visit with the path of each file below a tree, github truncates the recursive listing of very large trees,
+// in which case the tree is listed a level at a time and each of its subtrees walked in turn
+func (s *Service) walktree(ctx context.Context, owner string, repo string, sha string, prefix string, visit func(path string, entry github.TreeEntry)) error {
+	tree, err := s.gettree(ctx, owner, repo, sha, true)
+	if err != nil {
+		return err
+	}
+	if !tree.Truncated {
+		for _, entry := range tree.Entries {
+			if entry.GetType() == "blob" {
+				visit(prefix+entry.GetPath(), entry)
+			}
+		}
+		return nil
+	}
+	tree, err = s.gettree(ctx, owner, repo, sha, false)
+	if err != nil {
+		return err
+	}
+	for _, entry := range tree.Entries {
+		switch entry.GetType() {
+		case "blob":
+			visit(prefix+entry.GetPath(), entry)
+		case "tree":
+			err = s.walktree(ctx, owner, repo, entry.GetSHA(), prefix+entry.GetPath()+"/", visit)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RuleImpact is how much of the repository tree a rule reaches
+type RuleImpact struct {
+	Pattern string
+	Owners  []string
+	// Matched counts every file the pattern matches
+	Matched int
+	// Owned counts the files where this rule is the last match and so decides the owners
+	Owned int
+}
+
+// Impact ranks the rules by how many files they own in the tree at ref (or the default branch when ref is empty)
+// so that over broad rules, which drown their owners in review requests, stand out as candidates for narrowing
+func (co CodeOwners) Impact(ctx context.Context, ref string) ([]RuleImpact, error) {
+	ctx = co.operation(ctx)
+	files, err := co.files(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	impact := make([]RuleImpact, len(co.patterns))
+	for idx, pattern := range co.patterns {
+		impact[idx] = RuleImpact{Pattern: pattern.path, Owners: pattern.owners}
+	}
+	for _, file := range files {
+		last := -1
+		for idx, pattern := range co.patterns {
+			if co.matchesrule(pattern, file) {
+				impact[idx].Matched++
+				last = idx
+			}
+		}
+		if last >= 0 {
+			impact[last].Owned++
+		}
+	}
+	sort.SliceStable(impact, func(i, j int) bool {
+		if impact[i].Owned != impact[j].Owned {
+			return impact[i].Owned > impact[j].Owned
+		}
+		return impact[i].Matched > impact[j].Matched
+	})
+	return impact, nil
+}
+
+// OwnershipMap returns the owners of every file in the tree at ref (or the default branch when ref is empty),
+// trees too large for github to list in one go are walked a directory at a time, a file no rule matches has nil
+// owners and one whose rule has no owners an empty slice, each owner is looked up once however many files it owns
+// and owners that can't be looked up are left out and reported once in the errors
+func (co CodeOwners) OwnershipMap(ctx context.Context, ref string) (ownership map[string][]Owner, error_slice []error) {
+	ctx = co.operation(ctx)
+	files, err := co.files(ctx, ref)
+	if err != nil {
+		return nil, append(error_slice, err)
+	}
+	resolved := make(map[string]Owner)
+	failed := make(map[string]bool)
+	ownership = make(map[string][]Owner, len(files))
+	for _, file := range files {
+		texts := co.ownersfor(file)
+		if texts == nil {
+			ownership[file] = nil
+			continue
+		}
+		owners := make([]Owner, 0, len(texts))
+		for _, ownertext := range texts {
+			owner, ok := resolved[ownertext]
+			if !ok && !failed[ownertext] {
+				owner, err = co.ownerof(ctx, ownertext)
+				if err != nil {
+					failed[ownertext] = true
+					error_slice = append(error_slice, err)
+				} else {
+					resolved[ownertext], ok = owner, true
+				}
+			}
+			if ok {
+				owners = append(owners, owner)
+			}
+		}
+		ownership[file] = owners
+	}
+	return ownership, error_slice
+}
+
+// OwnerLoad is how much of the repository tree an owner is responsible for
+type OwnerLoad struct {
+	// Owner is written as in the file, the first spelling when it appears with different cases
+	Owner string
+	// Rules counts the rules that name the owner, whether or not they match any file
+	Rules int
+	// Files counts the files the owner owns
+	Files int
+	// Share is the fraction of the files in the tree the owner owns, shares add up to more than one when files
+	// have several owners
+	Share float64
+}
+
+// OwnerStats counts the rules and files of every owner in the tree at ref (or the default branch when ref is empty)
+// busiest first, so that teams drowning in review requests, and those with next to none, stand out
+// owners are counted as written, teams are not expanded into their members
+func (co CodeOwners) OwnerStats(ctx context.Context, ref string) ([]OwnerLoad, error) {
+	ctx = co.operation(ctx)
+	files, err := co.files(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	var loads []OwnerLoad
+	index := make(map[string]int)
+	load := func(owner string) *OwnerLoad {
+		key := strings.ToLower(owner)
+		idx, ok := index[key]
+		if !ok {
+			idx = len(loads)
+			index[key] = idx
+			loads = append(loads, OwnerLoad{Owner: owner})
+		}
+		return &loads[idx]
+	}
+	for _, pattern := range co.patterns {
+		for _, owner := range distinctowners(pattern.owners) {
+			load(owner).Rules++
+		}
+	}
+	for _, file := range files {
+		for _, owner := range distinctowners(co.ownersfor(file)) {
+			load(owner).Files++
+		}
+	}
+	for idx := range loads {
+		if len(files) > 0 {
+			loads[idx].Share = float64(loads[idx].Files) / float64(len(files))
+		}
+	}
+	sort.SliceStable(loads, func(i, j int) bool {
+		if loads[i].Files != loads[j].Files {
+			return loads[i].Files > loads[j].Files
+		}
+		return loads[i].Rules > loads[j].Rules
+	})
+	return loads, nil
+}
+
+// the owners without those repeated in another case
+func distinctowners(owners []string) []string {
+	distinct := make([]string, 0, len(owners))
+	for _, owner := range owners {
+		seen := false
+		for _, other := range distinct {
+			if strings.EqualFold(owner, other) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			distinct = append(distinct, owner)
+		}
+	}
+	return distinct
+}
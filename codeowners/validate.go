@@ -0,0 +1,134 @@
+package codeowners
+
+import (
+	"fmt"
+	"github.com/bmatcuk/doublestar"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	loginsyntax = regexp.MustCompile(`^@[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?$`)
+	teamsyntax  = regexp.MustCompile(`^@[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?/[A-Za-z0-9_.-]+$`)
+)
+
+// Snapshot is an offline record of the users and teams that exist, so a file can be checked without
+// calling github, logins are written without the @ and teams as org/slug, both in lower case
+// a nil map skips the check for that kind of owner
+type Snapshot struct {
+	Users map[string]bool
+	Teams map[string]bool
+}
+
+// checks an owner is written as a @login, an @org/team or an email address
+func checkowner(ownertext string) *Error {
+	switch {
+	case teamsyntax.MatchString(ownertext), loginsyntax.MatchString(ownertext):
+		return nil
+	case !strings.HasPrefix(ownertext, "@") && strings.Contains(ownertext, "@"):
+		if _, err := mail.ParseAddress(ownertext); err == nil {
+			return nil
+		}
+	}
+	return &Error{Code: CodeInvalidOwner, Message: fmt.Sprintf("Do not understand user specification %v", ownertext)}
+}
+
+// ValidateBlob checks the content of a CODEOWNERS file without any network access, which makes it fast
+// enough to reject a bad push from a pre-receive hook, patterns must be valid globs, each owner must be
+// well formed and, when the snapshot knows about that kind of owner, must exist
+// each error names the line it was found on, warnings such as rules without owners are left out
+func ValidateBlob(content string, snapshot Snapshot) (error_slice []error) {
+	for _, diagnostic := range diagnose(lines(content), snapshot) {
+		if diagnostic.Severity != SeverityWarning {
+			error_slice = append(error_slice, diagnostic)
+		}
+	}
+	return error_slice
+}
+
+// Validate checks the rules without any network access and returns a diagnostic, with its line,
+// column and severity, for each problem, so that editors and linters can point at it
+func (co CodeOwners) Validate() []*Error {
+	text := co.document.lines
+	if text == nil {
+		text = lines(co.String())
+	}
+	if co.sections == SectionsGitLab {
+		text = append([]string(nil), text...)
+		for idx, line := range text {
+			if _, ok := header(line); ok {
+				text[idx] = ""
+			}
+		}
+	}
+	return diagnose(text, Snapshot{})
+}
+
+// the words of a line along with the column each starts at, counting from 1
+func fieldsat(line string) (words []string, columns []int) {
+	start := -1
+	for idx := 0; idx <= len(line); idx++ {
+		space := idx == len(line) || line[idx] == ' ' || line[idx] == '\t'
+		switch {
+		case space && start >= 0:
+			words = append(words, line[start:idx])
+			columns = append(columns, start+1)
+			start = -1
+		case !space && start < 0:
+			start = idx
+		}
+	}
+	return words, columns
+}
+
+// finds the problems in the lines of a file
+func diagnose(text []string, snapshot Snapshot) (diagnostics []*Error) {
+	report := func(diagnostic *Error, line int, column int) {
+		diagnostic.Line, diagnostic.Column = line, column
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	for idx, line := range text {
+		rule, _ := splitcomment(line)
+		words, columns := fieldsat(rule)
+		if len(words) == 0 {
+			continue
+		}
+		pattern := words[0]
+		if strings.HasPrefix(pattern, "!") {
+			report(&Error{Code: CodeNegation, Message: fmt.Sprintf("%v uses negation, which github does not support", pattern)}, idx+1, columns[0])
+			pattern = pattern[1:]
+		}
+		if trimmed, _ := anchor(pattern, AnchorGitignore); trimmed != "" {
+			// doublestar only notices a bad pattern when it gets that far into the name
+			if _, err := doublestar.Match(trimmed, trimmed); err != nil {
+				report(&Error{Code: CodeInvalidPattern, Message: fmt.Sprintf("%v is not a valid pattern", words[0]), Err: err}, idx+1, columns[0])
+			}
+		}
+		if value, ok := annotations(text, idx)[minapprovals]; ok {
+			if count, err := strconv.Atoi(value); err != nil || count < 1 {
+				report(&Error{Code: CodeInvalidAnnotation, Message: fmt.Sprintf("%v: %v is not a number of approvals", minapprovals, value)}, idx+1, columns[0])
+			}
+		}
+		if len(words) == 1 {
+			report(&Error{Code: CodeMissingOwners, Message: fmt.Sprintf("%v has no owners, so it clears ownership", words[0]), Severity: SeverityWarning}, idx+1, columns[0])
+		}
+		for idx2, ownertext := range words[1:] {
+			column := columns[idx2+1]
+			if err := checkowner(ownertext); err != nil {
+				report(err, idx+1, column)
+				continue
+			}
+			name := strings.ToLower(strings.TrimPrefix(ownertext, "@"))
+			switch {
+			case !strings.HasPrefix(ownertext, "@"):
+			case strings.Contains(name, "/") && snapshot.Teams != nil && !snapshot.Teams[name]:
+				report(unknownowner(fmt.Sprintf("unknown team %v", ownertext), ErrTeamNotFound, nil), idx+1, column)
+			case !strings.Contains(name, "/") && snapshot.Users != nil && !snapshot.Users[name]:
+				report(unknownowner(fmt.Sprintf("unknown user %v", ownertext), ErrUserNotFound, nil), idx+1, column)
+			}
+		}
+	}
+	return diagnostics
+}
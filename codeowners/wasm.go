@@ -0,0 +1,74 @@
+//go:build js && wasm
+// +build js,wasm
+
+package codeowners
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+// converts a list of strings into something javascript can hold
+func jsstrings(list []string) []interface{} {
+	values := make([]interface{}, len(list))
+	for idx, item := range list {
+		values[idx] = item
+	}
+	return values
+}
+
+// a javascript Error for a call without the n strings it takes, otherwise nil, the callbacks return it rather than
+// indexing past the arguments they were given, which would panic the whole runtime
+func jsarguments(name string, args []js.Value, n int) interface{} {
+	if len(args) < n {
+		return js.Global().Get("Error").New(fmt.Sprintf("codeowners.%v takes %v arguments, got %v", name, n, len(args)))
+	}
+	for idx, arg := range args[:n] {
+		if arg.Type() != js.TypeString {
+			return js.Global().Get("Error").New(fmt.Sprintf("codeowners.%v takes strings, argument %v is a %v", name, idx+1, arg.Type()))
+		}
+	}
+	return nil
+}
+
+// RegisterJS exposes the offline parts of the package to javascript as a global codeowners object
+//
+//	codeowners.validate(content) returns a list of problems, each naming its line
+//	codeowners.owners(content, path) returns the owners of the path as written in the file
+//	codeowners.conflicts(content) returns the patterns written more than once with different owners
+//
+// none of them talk to github so they work in a browser without credentials, called without the strings they take
+// they return an Error rather than a list
+func RegisterJS() {
+	api := map[string]interface{}{
+		"validate": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			if err := jsarguments("validate", args, 1); err != nil {
+				return err
+			}
+			var problems []string
+			for _, err := range ValidateBlob(args[0].String(), Snapshot{}) {
+				problems = append(problems, err.Error())
+			}
+			return jsstrings(problems)
+		}),
+		"owners": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			if err := jsarguments("owners", args, 2); err != nil {
+				return err
+			}
+			co := ParseString(args[0].String())
+			return jsstrings(co.ownersfor(args[1].String()))
+		}),
+		"conflicts": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			if err := jsarguments("conflicts", args, 1); err != nil {
+				return err
+			}
+			co := ParseString(args[0].String())
+			var patterns []string
+			for _, conflict := range co.Conflicts() {
+				patterns = append(patterns, conflict.Pattern)
+			}
+			return jsstrings(patterns)
+		}),
+	}
+	js.Global().Set("codeowners", js.ValueOf(api))
+}
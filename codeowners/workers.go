@@ -0,0 +1,146 @@
+package codeowners
+
+import (
+	"context"
+	"golang.org/x/sync/errgroup"
+	"sync"
+)
+
+// how many lookups expansions make at once unless WithMaxConcurrency says otherwise
+const expandconcurrency = 10
+
+// WithMaxConcurrency returns a copy of the service that makes at most n lookups at once while expanding
+// owners, across every Match and other call sharing it, so big teams don't trip github's abuse detection
+// GetAll reads at most n repositories at once the same way, n below 1 means the default of 10
+func (s *Service) WithMaxConcurrency(n int) *Service {
+	return s.with(func(s *Service) {
+		s.slots = newslots(n)
+	})
+}
+
+// WithMaxConcurrency returns a copy of the code owners whose lookups are limited, see Service.WithMaxConcurrency
+func (co CodeOwners) WithMaxConcurrency(n int) CodeOwners {
+	return co.withservice(func(s *Service) {
+		s.slots = newslots(n)
+	})
+}
+
+// a semaphore with n slots
+func newslots(n int) chan struct{} {
+	if n < 1 {
+		n = expandconcurrency
+	}
+	return make(chan struct{}, n)
+}
+
+// the semaphore the lookups of an expansion take a slot from, a service without one gets its own
+func (s *Service) semaphore() chan struct{} {
+	if s == nil || s.slots == nil {
+		return newslots(expandconcurrency)
+	}
+	return s.slots
+}
+
+// workers runs the lookups of an expansion on an errgroup of at most as many goroutines as there are slots,
+// and collects the resolutions and errors the tasks find, each task also holds a slot of the semaphore while
+// it runs, which other expansions may share, so waiting for a slot is the only thing a task blocks on
+type workers struct {
+	ctx   context.Context
+	group *errgroup.Group
+	slots chan struct{}
+	lock  sync.Mutex
+	// done is closed once the group has finished
+	done        chan struct{}
+	resolutions []Resolution
+	errs        []error
+	// counts is how many resolutions each owner that expands into several users should send, see expect
+	counts map[string]int
+}
+
+// a pool for expanding with the context
+func newworkers(ctx context.Context, slots chan struct{}) *workers {
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(cap(slots))
+	return &workers{ctx: ctx, group: group, slots: slots, done: make(chan struct{})}
+}
+
+// runs a task on the group once a goroutine is free, it is only called by the expansion itself, as a task
+// waiting for a goroutine could be waiting on itself, see fork
+func (w *workers) spawn(task func()) {
+	w.group.Go(w.slotted(task))
+}
+
+// runs a task from inside another on the group when a goroutine is free, otherwise straight away
+// under the slot of the task calling it
+func (w *workers) fork(task func()) {
+	if !w.group.TryGo(w.slotted(task)) && w.ctx.Err() == nil {
+		task()
+	}
+}
+
+// the task holding a slot, it is skipped once the context has ended
+func (w *workers) slotted(task func()) func() error {
+	return func() error {
+		select {
+		case w.slots <- struct{}{}:
+			if w.ctx.Err() == nil {
+				task()
+			}
+			<-w.slots
+		case <-w.ctx.Done():
+		}
+		return nil
+	}
+}
+
+// waits until every task is done or the context ends, a caller that stops waiting doesn't strand any goroutine
+// as nothing blocks on sending a result
+func (w *workers) wait() ([]Resolution, []error) {
+	go func() {
+		w.group.Wait()
+		close(w.done)
+	}()
+	select {
+	case <-w.done:
+	case <-w.ctx.Done():
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return append([]Resolution(nil), w.resolutions...), append([]error(nil), w.errs...)
+}
+
+// records a resolution
+func (w *workers) send(resolution Resolution) {
+	w.lock.Lock()
+	w.resolutions = append(w.resolutions, resolution)
+	w.lock.Unlock()
+}
+
+// records an error, those of lookups the end of the context cut short are left out as the expansion
+// reports the context error itself
+func (w *workers) fail(err error) {
+	if w.ctx.Err() != nil {
+		return
+	}
+	w.lock.Lock()
+	w.errs = append(w.errs, err)
+	w.lock.Unlock()
+}
+
+// records how many resolutions an owner is going to send, so an expansion cut short can tell it is missing some
+func (w *workers) expect(ownertext string, n int) {
+	w.lock.Lock()
+	if w.counts == nil {
+		w.counts = make(map[string]int)
+	}
+	w.counts[ownertext] = n
+	w.lock.Unlock()
+}
+
+// how many resolutions an owner is going to send, if that is known
+func (w *workers) expected(ownertext string) (int, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	n, ok := w.counts[ownertext]
+	return n, ok
+}
@@ -24,17 +24,17 @@ func main() {
 	tc := oauth2.NewClient(ctx, ts)
 
 	client := github.NewClient(tc)
-	owners, err := codeowners.Get(ctx, client, "GoogleCloudPlatform", "google-cloud-python")
+	owners, err := codeowners.NewService(client).Get(ctx, "GoogleCloudPlatform", "google-cloud-python")
 	if err != nil {
 		panic(fmt.Sprintf("error: %v\n", err))
 	}
 
-	users, match_err := owners.Match(ctx, "*")
+	result, match_err := owners.Lookup(ctx, "*")
 	if match_err != nil {
 		panic(fmt.Sprintf("error: %v\n", match_err))
 	}
 
-	for _, user := range users {
+	for _, user := range result.Users {
 		fmt.Printf("%v\n", github.Stringify(user))
 	}
 }
@@ -0,0 +1,17 @@
+module github.com/ddub/go-github-codeowners
+
+go 1.21
+
+require (
+	github.com/bmatcuk/doublestar v1.1.1
+	github.com/google/go-github v15.0.0+incompatible
+	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
+	golang.org/x/sync v0.10.0
+)
+
+require (
+	github.com/golang/protobuf v1.2.0 // indirect
+	github.com/google/go-querystring v1.0.0 // indirect
+	golang.org/x/net v0.0.0-20180826012351-8a410e7b638d // indirect
+	google.golang.org/appengine v1.1.0 // indirect
+)
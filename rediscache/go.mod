@@ -0,0 +1,17 @@
+module github.com/ddub/go-github-codeowners/rediscache
+
+go 1.21
+
+require (
+	github.com/ddub/go-github-codeowners v0.0.0
+	github.com/gomodule/redigo v1.9.2
+)
+
+require (
+	github.com/bmatcuk/doublestar v1.1.1 // indirect
+	github.com/google/go-github v15.0.0+incompatible // indirect
+	github.com/google/go-querystring v1.0.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+)
+
+replace github.com/ddub/go-github-codeowners => ../
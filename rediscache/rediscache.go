@@ -0,0 +1,117 @@
+// Copyright 2017 The go-github-codeowners AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rediscache is a codeowners.Cache kept in redis, so a fleet of services answering ownership
+// questions share the teams, users and files they look up, it is a module of its own so that only
+// those who use it depend on a redis client
+//
+//	cache := rediscache.New(&redis.Pool{Dial: func() (redis.Conn, error) { return redis.Dial("tcp", "localhost:6379") }}, "codeowners")
+//	svc := codeowners.NewService(client).WithCache(cache, time.Hour)
+package rediscache
+
+import (
+	"fmt"
+	"github.com/ddub/go-github-codeowners/codeowners"
+	"github.com/gomodule/redigo/redis"
+	"strings"
+	"time"
+)
+
+// Cache is a codeowners.Cache kept in redis, it is safe for concurrent use
+// the keys codeowners uses start with the api url and cache scope of the service, then the kind of lookup and
+// the org, repo or team it is for, eg teams:org, members:@org/team:all:true, user:login or file:org/repo@ref:...,
+// and are kept under namespace: in redis
+type Cache struct {
+	pool      *redis.Pool
+	namespace string
+}
+
+var _ codeowners.Cache = (*Cache)(nil)
+
+// New returns a Cache that keeps its keys under the namespace using connections from the pool
+func New(pool *redis.Pool, namespace string) *Cache {
+	return &Cache{pool: pool, namespace: namespace}
+}
+
+// the redis key for a cache key
+func (c *Cache) key(key string) string {
+	return c.namespace + ":" + key
+}
+
+// Get returns the value for the key if it was set and has not expired, redis being unavailable is a miss
+func (c *Cache) Get(key string) ([]byte, bool) {
+	conn := c.pool.Get()
+	defer conn.Close()
+	value, err := redis.Bytes(conn.Do("GET", c.key(key)))
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Set keeps the value for the key for ttl, which redis expires itself, failures are ignored as
+// the value is simply looked up again
+func (c *Cache) Set(key string, value []byte, ttl time.Duration) {
+	if ttl < time.Millisecond {
+		return
+	}
+	conn := c.pool.Get()
+	defer conn.Close()
+	conn.Do("SET", c.key(key), value, "PX", int64(ttl/time.Millisecond))
+}
+
+// Delete removes the value for the key
+func (c *Cache) Delete(key string) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("DEL", c.key(key))
+	return err
+}
+
+// InvalidateOrg removes the teams of the org and their members, eg after its teams have changed,
+// users are kept as they belong to no one org, the org is invalidated for every host and scope
+func (c *Cache) InvalidateOrg(org string) error {
+	org = escape(strings.ToLower(org))
+	if err := c.deletematching(c.key("* teams:" + org)); err != nil {
+		return err
+	}
+	return c.deletematching(c.key("* members:@" + org + "/*"))
+}
+
+// InvalidateRepo removes the files read from the repository, eg after a push that changed them,
+// for every host and scope
+func (c *Cache) InvalidateRepo(owner string, repo string) error {
+	return c.deletematching(c.key(fmt.Sprintf("* file:%v/%v@*", escape(strings.ToLower(owner)), escape(strings.ToLower(repo)))))
+}
+
+// removes every key matching the pattern, scanning rather than using KEYS so redis is not blocked
+func (c *Cache) deletematching(pattern string) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+	cursor := "0"
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", 100))
+		if err != nil {
+			return err
+		}
+		var keys []string
+		if _, err := redis.Scan(values, &cursor, &keys); err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if _, err := conn.Do("DEL", redis.Args{}.AddFlat(keys)...); err != nil {
+				return err
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// escapes the characters redis treats as a pattern
+func escape(name string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`).Replace(name)
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 The go-github-codeowners AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rediscache
+
+import (
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fakeconn answers the commands the cache uses from memory
+type fakeconn struct {
+	data    map[string][]byte
+	expires map[string]time.Duration
+}
+
+func (f *fakeconn) Close() error { return nil }
+func (f *fakeconn) Err() error   { return nil }
+func (f *fakeconn) Send(command string, args ...interface{}) error {
+	return fmt.Errorf("Send is not faked")
+}
+func (f *fakeconn) Flush() error                  { return nil }
+func (f *fakeconn) Receive() (interface{}, error) { return nil, fmt.Errorf("Receive is not faked") }
+
+func (f *fakeconn) Do(command string, args ...interface{}) (interface{}, error) {
+	switch command {
+	case "GET":
+		value, ok := f.data[args[0].(string)]
+		if !ok {
+			return nil, nil
+		}
+		return value, nil
+	case "SET":
+		f.data[args[0].(string)] = args[1].([]byte)
+		f.expires[args[0].(string)] = time.Duration(args[3].(int64)) * time.Millisecond
+		return "OK", nil
+	case "DEL":
+		for _, key := range args {
+			delete(f.data, key.(string))
+		}
+		return int64(len(args)), nil
+	case "SCAN":
+		pattern := globexp(args[2].(string))
+		var keys []interface{}
+		for key := range f.data {
+			if pattern.MatchString(key) {
+				keys = append(keys, []byte(key))
+			}
+		}
+		return []interface{}{[]byte("0"), keys}, nil
+	}
+	return nil, fmt.Errorf("%v is not faked", command)
+}
+
+// the regexp for a redis pattern, only * ? and escapes are faked
+func globexp(pattern string) *regexp.Regexp {
+	expr := "^"
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			expr += ".*"
+		case '?':
+			expr += "."
+		case '\\':
+			i++
+			expr += regexp.QuoteMeta(pattern[i : i+1])
+		default:
+			expr += regexp.QuoteMeta(pattern[i : i+1])
+		}
+	}
+	return regexp.MustCompile(expr + "$")
+}
+
+func TestCache(t *testing.T) {
+	conn := &fakeconn{data: make(map[string][]byte), expires: make(map[string]time.Duration)}
+	cache := New(&redis.Pool{Dial: func() (redis.Conn, error) { return conn, nil }}, "co")
+	const host = "https://api.github.com/ scope "
+	cache.Set(host+"teams:example", []byte(`[]`), time.Minute)
+	cache.Set(host+"members:@example/team:all:false", []byte(`[]`), time.Minute)
+	cache.Set("https://github.example.com/api/v3/  members:@example/team:all:false", []byte(`[]`), time.Minute)
+	cache.Set(host+"members:@other/team:all:false", []byte(`[]`), time.Minute)
+	cache.Set(host+"file:example/repo@:,docs/,.github//CODEOWNERS", []byte(`{}`), time.Minute)
+	cache.Set(host+"user:juan", []byte(`{}`), time.Hour)
+	cache.Set(host+"user:joe", []byte(`{}`), 0)
+	if value, ok := cache.Get(host + "user:juan"); !ok || string(value) != "{}" || conn.expires["co:"+host+"user:juan"] != time.Hour {
+		t.Errorf("Expected juan to be kept for an hour got %q and %v", value, conn.expires["co:"+host+"user:juan"])
+	}
+	if _, ok := cache.Get(host + "user:joe"); ok {
+		t.Error("Expected a value without a ttl not to be kept")
+	}
+	if err := cache.InvalidateOrg("Example"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.InvalidateRepo("example", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for key := range conn.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if fmt.Sprint(keys) != "[co:"+host+"members:@other/team:all:false co:"+host+"user:juan]" {
+		t.Errorf("Expected only the other org and the user to be kept got %v", keys)
+	}
+}
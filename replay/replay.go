@@ -0,0 +1,150 @@
+// Copyright 2017 The go-github-codeowners AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package replay records live github api interactions into fixture files and serves them back
+// so tests can use real shaped data without network access
+//
+// record once against the real api
+//
+//	client := github.NewClient(&http.Client{Transport: &replay.Recorder{Dir: "testdata/github"}})
+//
+// and from then on replay
+//
+//	client := github.NewClient(&http.Client{Transport: &replay.Replayer{Dir: "testdata/github"}})
+//
+// the codeowners tests replay their recordings from codeowners/testdata the same way
+package replay
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// interaction is what is saved for each request, only the response is replayed
+// the request is kept so that fixtures can be read and edited by hand
+type interaction struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+// fixtures are named after the method, path, query and body of the request but not the host
+// so they replay against any base url, and never after headers which carry credentials
+func fixture(dir string, req *http.Request) (string, []byte, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	key := fmt.Sprintf("%v %v\n%s", req.Method, req.URL.RequestURI(), body)
+	return filepath.Join(dir, fmt.Sprintf("%x.json", sha1.Sum([]byte(key)))), body, nil
+}
+
+// Recorder is an http.RoundTripper that passes requests on to Transport and saves every response in Dir
+// a request is saved under its method, path, query and body, so when the same request is made again its response
+// overwrites the earlier one and only the last is replayed, a test that expects a request to get a different
+// answer the second time, eg after a write, can not be recorded
+type Recorder struct {
+	// Transport makes the real requests, http.DefaultTransport when nil
+	Transport http.RoundTripper
+	Dir       string
+}
+
+// RoundTrip makes the request and records the response
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	name, _, err := fixture(r.Dir, req)
+	if err != nil {
+		return nil, err
+	}
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	header := resp.Header
+	if header.Get("Set-Cookie") != "" {
+		header = make(http.Header, len(resp.Header))
+		for key, values := range resp.Header {
+			header[key] = values
+		}
+		header.Del("Set-Cookie")
+	}
+	saved, err := json.MarshalIndent(interaction{
+		Method: req.Method,
+		URL:    req.URL.RequestURI(),
+		Status: resp.StatusCode,
+		Header: header,
+		Body:   string(body),
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(r.Dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(name, saved, 0644); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Replayer is an http.RoundTripper that answers requests from the fixtures a Recorder saved in Dir
+// without touching the network, a request that was never recorded fails
+type Replayer struct {
+	Dir string
+}
+
+// RoundTrip answers the request from its fixture
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	name, _, err := fixture(r.Dir, req)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, errors.New(fmt.Sprintf("No recording of %v %v", req.Method, req.URL.RequestURI()))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var recorded interaction
+	if err := json.Unmarshal(saved, &recorded); err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(recorded.Body))),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 The go-github-codeowners AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/github"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func client(transport http.RoundTripper, base string) *github.Client {
+	cl := github.NewClient(&http.Client{Transport: transport})
+	url, _ := url.Parse(base + "/")
+	cl.BaseURL = url
+	return cl
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.Header().Set("Set-Cookie", "session=secret")
+		fmt.Fprint(w, `{"login": "juan", "name": "Juan"}`)
+	}))
+	recording := client(&Recorder{Dir: dir}, server.URL)
+	user, _, err := recording.Users.Get(context.TODO(), "juan")
+	if err != nil || user.GetName() != "Juan" {
+		t.Fatalf("Expected to record juan got %v %v", user, err)
+	}
+	server.Close()
+
+	replaying := client(&Replayer{Dir: dir}, "http://replay.invalid")
+	user, resp, err := replaying.Users.Get(context.TODO(), "juan")
+	if err != nil || user.GetName() != "Juan" {
+		t.Fatalf("Expected to replay juan got %v %v", user, err)
+	}
+	if resp.Rate.Remaining != 4999 || resp.Header.Get("Set-Cookie") != "" {
+		t.Errorf("Expected headers to be replayed without cookies got %v", resp.Header)
+	}
+	if _, _, err := replaying.Users.Get(context.TODO(), "joe"); err == nil {
+		t.Errorf("Expected an error for a request that was never recorded")
+	}
+	if requests != 1 {
+		t.Errorf("Expected a single live request got %v", requests)
+	}
+}